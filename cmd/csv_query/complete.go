@@ -0,0 +1,225 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+)
+
+// tableRefs finds the tables of FROM and JOIN in an incomplete statement:
+// the name or path, quoted or not, and the alias.
+var tableRefs = regexp.MustCompile("(?i)\\b(?:FROM|JOIN)\\s+(`[^`]*`|'[^']*'|\"[^\"]*\"|[^\\s,;()]+)(?:\\s+(?:AS\\s+)?([\\pL_][\\pL\\pN_]*))?")
+
+// complete returns the words completing the one ending at pos in the text: table
+// names and csv files after FROM and JOIN, otherwise keywords and the columns
+// of the tables of the statement or of the [head] table, qualified if the word is.
+// Meta-commands and their arguments are completed too.
+func (s *session) complete(text string, pos int) (int, []string) {
+	stmt := text
+	text = text[:pos]
+	if meta := strings.TrimLeft(text, " \t\n"); isMetaCommand(meta) {
+		return s.completeMeta(meta, len(text)-len(meta))
+	}
+	start := len(text)
+	for start > 0 {
+		r := rune(text[start-1])
+		if r < 0x80 && !isWordPart(r) {
+			break
+		}
+		start--
+	}
+	word := text[start:]
+	var candidates []string
+	if fields := strings.Fields(text[:start]); len(fields) > 0 &&
+		(strings.EqualFold(fields[len(fields)-1], "FROM") || strings.EqualFold(fields[len(fields)-1], "JOIN")) {
+		candidates = s.tableNames(word)
+	} else {
+		candidates = s.columnNames(stmt, word)
+		if !strings.Contains(word, ".") {
+			candidates = append(candidates, keywords(word)...)
+		}
+	}
+	sort.Strings(candidates)
+	return start, candidates
+}
+
+// completeMeta completes the name of a meta-command starting at offset, a table
+// name for \d and a file name for \i and \o.
+func (s *session) completeMeta(line string, offset int) (int, []string) {
+	args := strings.Fields(line)
+	if len(args) == 1 && !strings.HasSuffix(line, " ") {
+		var names []string
+		for _, name := range metaCommands {
+			if strings.HasPrefix(name, line) {
+				names = append(names, name)
+			}
+		}
+		return offset, names
+	}
+	word := ""
+	if !strings.HasSuffix(line, " ") {
+		word = args[len(args)-1]
+	}
+	start := offset + len(line) - len(word)
+	switch args[0] {
+	case `\d`:
+		names := s.tableNames(word)
+		sort.Strings(names)
+		return start, names
+	case `\i`, `\o`:
+		paths, _ := filepath.Glob(word + "*")
+		for i, path := range paths {
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				paths[i] = path + "/"
+			}
+		}
+		return start, paths
+	}
+	return start, nil
+}
+
+// isWordPart tells if the ASCII character r can be a part of a word completed:
+// a name, a qualified name, a file path or a quoted name.
+func isWordPart(r rune) bool {
+	return r == '_' || r == '.' || r == '/' || r == '-' || r == '`' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// keywords returns the keywords starting with the word, lower-cased if the word is.
+func keywords(word string) []string {
+	lower := word != "" && word == strings.ToLower(word)
+	var words []string
+	for _, kw := range csv.Keywords() {
+		if !hasPrefixFold(kw, word) {
+			continue
+		}
+		if lower {
+			kw = strings.ToLower(kw)
+		}
+		words = append(words, kw)
+	}
+	return words
+}
+
+// tableNames returns the tables of the config and the csv files and directories starting with the word.
+func (s *session) tableNames(word string) []string {
+	var names []string
+	for name := range s.config.Tables {
+		if hasPrefixFold(name, word) {
+			names = append(names, name)
+		}
+	}
+	paths, _ := filepath.Glob(word + "*")
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+		case info.IsDir():
+			names = append(names, path+"/")
+		case strings.EqualFold(filepath.Ext(path), ".csv"):
+			names = append(names, path)
+		}
+	}
+	return names
+}
+
+// columnNames returns the columns of the tables of the statement starting with
+// the word. A qualified word is completed with the columns of the table it names.
+func (s *session) columnNames(text, word string) []string {
+	qualifier := ""
+	if i := strings.LastIndexByte(word, '.'); i >= 0 {
+		qualifier, word = word[:i], word[i+1:]
+	}
+	var names []string
+	for _, head := range s.statementHeads(text) {
+		for _, f := range head.Fields {
+			if qualifier != "" && !strings.EqualFold(f.Table, qualifier) {
+				continue
+			}
+			name := quoteName(f.Name)
+			if !hasPrefixFold(name, word) && !hasPrefixFold(f.Name, word) {
+				continue
+			}
+			if qualifier != "" {
+				name = qualifier + "." + name
+			}
+			names = append(names, name)
+		}
+	}
+	return unique(names)
+}
+
+// statementHeads returns the heads of the tables named in the text, qualified
+// by their name or alias. Without tables it is the [head] table.
+func (s *session) statementHeads(text string) []csv.Head {
+	var refs []*csv.TableRef
+	for _, m := range tableRefs.FindAllStringSubmatch(text, -1) {
+		ref := &csv.TableRef{Name: strings.Trim(m[1], "`'\""), Alias: m[2]}
+		if isKeyword(ref.Alias) {
+			ref.Alias = ""
+		}
+		refs = append(refs, ref)
+	}
+	if len(refs) == 0 {
+		refs = append(refs, nil)
+	}
+	var heads []csv.Head
+	for _, ref := range refs {
+		table, err := tableHead(s.config, ref)
+		if err != nil {
+			continue
+		}
+		head, err := fileHead(s.config, table)
+		if err != nil {
+			continue
+		}
+		if ref != nil {
+			head.Qualify(ref.Qualifier())
+		}
+		heads = append(heads, head)
+	}
+	return heads
+}
+
+func isKeyword(word string) bool {
+	for _, kw := range csv.Keywords() {
+		if strings.EqualFold(kw, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteName encloses the column name in backticks unless it is a plain identifier.
+func quoteName(name string) string {
+	plain := name != "" && !isKeyword(name)
+	for i, r := range name {
+		if !(r == '_' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)) {
+			plain = false
+		}
+	}
+	if plain {
+		return name
+	}
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func unique(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	var out []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComplete(t *testing.T) {
+	s, _, dir := newTestSession(t)
+	regions := filepath.Join(dir, "regions.csv")
+	assert.NoError(t, os.WriteFile(regions, []byte("region,population\nAsia,4600\n"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "report.sql"), []byte("SELECT 1;\n"), 0o600))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "reports"), 0o700))
+	s.config.Tables = map[string]csv.Head{"regions": {Path: regions}}
+	// csv files and scripts are completed relative to the working directory
+	wd, err := os.Getwd()
+	if !assert.NoError(t, err) || !assert.NoError(t, os.Chdir(dir)) {
+		return
+	}
+	defer func() { assert.NoError(t, os.Chdir(wd)) }()
+
+	tests := []struct {
+		name string
+		// pending is the text of the previous lines of a statement, pos is the
+		// cursor in the line, -1 for its end
+		pending, line string
+		pos           int
+		start         int
+		want          []string
+	}{
+		{"keyword", "", "SELECT count(*) FR", -1, 16, []string{"FROM"}},
+		{"lower-case keyword", "", "select name fr", -1, 12, []string{"from"}},
+		{"column of [head]", "", "SELECT na", -1, 7, []string{"name"}},
+		{"column and keyword", "", "SELECT I", -1, 7, []string{"IF", "IN", "INNER", "INTO", "IS", "id"}},
+		{"table", "", "SELECT * FROM re", -1, 14, []string{"regions", "regions.csv", "reports/"}},
+		{"table after JOIN", "", "SELECT * FROM data.csv d JOIN d", -1, 30, []string{"data.csv"}},
+		{"column of FROM", "", "SELECT pop FROM regions", 10, 7, []string{"population"}},
+		{"qualified column", "", "SELECT r.r FROM data.csv d JOIN regions r ON d.name = r.region", 10, 7, []string{"r.region"}},
+		{"columns of an alias", "", "SELECT d. FROM data.csv AS d JOIN regions r ON d.name = r.region", 9, 7, []string{"d.id", "d.name"}},
+		{"unknown alias", "", "SELECT x. FROM data.csv d", 9, 7, nil},
+		{"cursor in the middle", "", "SELECT id, pop FROM regions WHERE id = 1", 14, 11, []string{"population"}},
+		{"pending lines", "SELECT *\nFROM regions r\n", "WHERE r.p", -1, 6, []string{"r.population"}},
+		{"pending FROM", "SELECT region\nFROM\n", "reg", -1, 0, []string{"regions", "regions.csv"}},
+		{"meta-command", "", `\ti`, -1, 0, []string{`\timing`}},
+		{"meta-commands", "", `\d`, -1, 0, []string{`\d`, `\dt`}},
+		{"table of \\d", "", `\d reg`, -1, 3, []string{"regions", "regions.csv"}},
+		{"script of \\i", "", `\i rep`, -1, 3, []string{"report.sql", "reports/"}},
+		{"file of \\o", "", `\o dat`, -1, 3, []string{"data.csv"}},
+		{"no argument", "", `\timing o`, -1, 8, nil},
+	}
+	for _, tt := range tests {
+		pos := tt.pos
+		if pos < 0 {
+			pos = len(tt.line)
+		}
+		// the REPL completes the whole statement and shifts the start to the line
+		start, got := s.complete(tt.pending+tt.line, len(tt.pending)+pos)
+		assert.Equal(t, tt.start, start-len(tt.pending), tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+}
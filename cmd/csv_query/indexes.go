@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"go.uber.org/zap"
+)
+
+// IndexConfig - индекс по полю таблицы, строится при запуске и перестраивается
+// перед запросом, если файл таблицы изменился
+type IndexConfig struct {
+	// Table - имя таблицы из [tables] или путь к файлу, по умолчанию [head]
+	Table  string `json:"table" yaml:"table"`
+	Column string `json:"column" yaml:"column"`
+	// Type - тип индекса: btree (=, <, >, IN) или hash (=, IN)
+	Type string `json:"type" yaml:"type"`
+}
+
+// tableIndex is an index opened at startup, it is reopened when its file changes.
+type tableIndex struct {
+	csv.Index
+	Path      string
+	File      string
+	BuildTime time.Duration
+	// config is the [[index]] of the index, size and modTime describe its file when it was opened
+	config  IndexConfig
+	size    int64
+	modTime time.Time
+}
+
+// indexes holds the indexes of [[index]] in the order of config.
+var indexes []tableIndex
+
+// tableIndexes returns the indexes of the file. An index whose file has changed
+// since it was opened is rebuilt with the header read again, or skipped if it
+// can't be. An index whose column is gone from the file is dropped.
+func tableIndexes(config *Config, logger *zap.Logger, path string) []csv.Index {
+	var res []csv.Index
+	kept := indexes[:0]
+	for _, idx := range indexes {
+		if idx.Path == path && !idx.fresh() {
+			reopened, err := reopenIndex(config, idx)
+			if errors.Is(err, errColumnGone) {
+				logger.Error(fmt.Sprintf("index on %s column %s dropped: %s", idx.Path, idx.Column(), err))
+				continue
+			}
+			if err != nil {
+				logger.Error(fmt.Sprintf("index on %s column %s: %s", idx.Path, idx.Column(), err))
+				kept = append(kept, idx)
+				continue
+			}
+			logger.Info(fmt.Sprintf("index %s on %s column %s rebuilt: %d keys in %s",
+				reopened.Kind(), reopened.Path, reopened.Column(), reopened.Len(), reopened.BuildTime))
+			idx = reopened
+		}
+		kept = append(kept, idx)
+		if idx.Path == path {
+			res = append(res, idx.Index)
+		}
+	}
+	indexes = kept
+	return res
+}
+
+// errColumnGone is returned by reopenIndex when the column is not in the file any more.
+var errColumnGone = errors.New("column not found in the header")
+
+// reopenIndex rebuilds the index of a changed file, the header of the file is read
+// again so the index is built over the column wherever it is now.
+func reopenIndex(config *Config, idx tableIndex) (tableIndex, error) {
+	head, err := indexHead(config, idx.config)
+	if err != nil {
+		return idx, err
+	}
+	if head.FieldIndex(idx.config.Column) < 0 {
+		return idx, errColumnGone
+	}
+	return openIndex(config, head, idx.config)
+}
+
+// fresh tells if the file of the index has not changed since the index was opened.
+func (idx *tableIndex) fresh() bool {
+	stat, err := os.Stat(idx.Path)
+	return err == nil && stat.Size() == idx.size && stat.ModTime().Equal(idx.modTime)
+}
+
+// openIndex opens the index of [[index]] on the table, building it if it is missing or stale.
+func openIndex(config *Config, head csv.Head, ic IndexConfig) (tableIndex, error) {
+	stat, err := os.Stat(head.Path)
+	if err != nil {
+		return tableIndex{}, err
+	}
+	start := time.Now()
+	idx, err := csv.OpenIndex(ic.Type, &head, ic.Column, config.readerOptions())
+	if err != nil {
+		return tableIndex{}, err
+	}
+	return tableIndex{
+		Index:     idx,
+		Path:      head.Path,
+		File:      csv.IndexPath(head.Path, idx.Column(), idx.Kind()),
+		BuildTime: time.Since(start),
+		config:    ic,
+		size:      stat.Size(),
+		modTime:   stat.ModTime(),
+	}, nil
+}
+
+// buildIndexes opens the configured indexes in parallel, building the ones missing or stale.
+// An index that can't be built is logged and skipped, queries just scan the file.
+func buildIndexes(config *Config, logger *zap.Logger) {
+	heads := make([]csv.Head, len(config.Index))
+	errs := make([]error, len(config.Index))
+	built := make([]tableIndex, len(config.Index))
+	// tableHead caches inferred schemas, so heads are resolved before the build starts
+	for i, ic := range config.Index {
+		heads[i], errs[i] = indexHead(config, ic)
+	}
+	var wg sync.WaitGroup
+	for i, ic := range config.Index {
+		if errs[i] != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, ic IndexConfig) {
+			defer wg.Done()
+			built[i], errs[i] = openIndex(config, heads[i], ic)
+		}(i, ic)
+	}
+	wg.Wait()
+
+	for i, ic := range config.Index {
+		if errs[i] != nil {
+			logger.Error(fmt.Sprintf("index on %s column %s: %s", ic.Table, ic.Column, errs[i]))
+			continue
+		}
+		idx := built[i]
+		logger.Info(fmt.Sprintf("index %s on %s column %s: %d keys in %s", idx.Kind(), idx.Path, idx.Column(), idx.Len(), idx.BuildTime))
+		indexes = append(indexes, idx)
+	}
+}
+
+func indexHead(config *Config, ic IndexConfig) (csv.Head, error) {
+	var ref *csv.TableRef
+	if ic.Table != "" {
+		ref = &csv.TableRef{Name: ic.Table}
+	}
+	table, err := tableHead(config, ref)
+	if err != nil {
+		return table, err
+	}
+	return fileHead(config, table)
+}
+
+// printIndexes prints the indexes for the \indexes command.
+func printIndexes(w io.Writer) {
+	if len(indexes) == 0 {
+		fmt.Fprintln(w, "no indexes, see [[index]] in config.toml")
+		return
+	}
+	fmt.Fprintf(w, "%-40s %-20s %-6s %10s %12s %12s\n", "file", "column", "type", "keys", "size", "build time")
+	for _, idx := range indexes {
+		size := "-"
+		if stat, err := os.Stat(idx.File); err == nil {
+			size = fmt.Sprintf("%d B", stat.Size())
+		}
+		fmt.Fprintf(w, "%-40s %-20s %-6s %10d %12s %12s\n",
+			idx.Path, idx.Column(), idx.Kind(), idx.Len(), size, idx.BuildTime.Round(time.Microsecond))
+	}
+}
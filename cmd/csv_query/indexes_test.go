@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTableIndexesStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if !assert.NoError(t, os.WriteFile(path, []byte("id,name\n1,a\n2,b\n"), 0o600)) {
+		return
+	}
+	config := &Config{
+		Head:  csv.Head{Path: path, Fields: []csv.Field{{Name: "id", Type: csv.TypeInt}}},
+		Index: []IndexConfig{{Column: "name", Type: "hash"}},
+	}
+	defer func() { indexes = nil }()
+	buildIndexes(config, zap.NewNop())
+	got := tableIndexes(config, zap.NewNop(), path)
+	if !assert.Len(t, got, 1) {
+		return
+	}
+	assert.Equal(t, 2, got[0].Len())
+
+	// the file changes after startup, the index is rebuilt before the next query
+	assert.NoError(t, os.WriteFile(path, []byte("id,name\n1,a\n2,b\n3,c\n"), 0o600))
+	later := time.Now().Add(time.Second)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	got = tableIndexes(config, zap.NewNop(), path)
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, 3, got[0].Len())
+	}
+
+	// an index that can't be rebuilt is skipped
+	assert.NoError(t, os.Remove(path))
+	assert.Empty(t, tableIndexes(config, zap.NewNop(), path))
+}
+
+func TestTableIndexesHeaderChanged(t *testing.T) {
+	s, out, dir := newTestSession(t)
+	path := filepath.Join(dir, "kv.csv")
+	if !assert.NoError(t, os.WriteFile(path, []byte("k,v\na,1\nb,2\n"), 0o600)) {
+		return
+	}
+	s.config.Head = csv.Head{Path: path}
+	s.config.Index = []IndexConfig{{Column: "k", Type: "hash"}}
+	defer func() { indexes = nil }()
+	buildIndexes(s.config, zap.NewNop())
+	if !assert.Len(t, indexes, 1) {
+		return
+	}
+
+	// a column is added before k, the rebuilt index must read k from its new place
+	assert.NoError(t, os.WriteFile(path, []byte("x,k,v\nb,a,1\na,b,2\n"), 0o600))
+	later := time.Now().Add(time.Second)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	assert.NoError(t, s.execute(context.Background(), "SELECT v WHERE k='b'"))
+	assert.Equal(t, "v\n2\n", out.String())
+	if assert.Len(t, indexes, 1) {
+		assert.Equal(t, 2, indexes[0].Len())
+	}
+
+	// k is gone from the file, the index is dropped
+	assert.NoError(t, os.WriteFile(path, []byte("x,v\nb,1\n"), 0o600))
+	later = later.Add(time.Second)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	assert.Empty(t, tableIndexes(s.config, zap.NewNop(), path))
+	assert.Empty(t, indexes)
+}
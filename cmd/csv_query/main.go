@@ -1,28 +1,51 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/signal"
 	"strings"
-	"sync"
-	"syscall"
 	"time"
 
 	"github.com/AleksandrMac/csv_query/pkg/csv"
 	"github.com/AleksandrMac/csv_query/pkg/log"
 	toml "github.com/pelletier/go-toml"
 	"github.com/spf13/afero"
-	"go.uber.org/zap"
 )
 
 type Config struct {
-	Head    csv.Head      `json:"head" yaml:"head"`
-	Sep     string        `json:"sep" yaml:"sep"`
+	Head csv.Head `json:"head" yaml:"head"`
+	// Tables - таблицы, к которым можно обращаться по имени в FROM
+	Tables map[string]csv.Head `json:"tables" yaml:"tables"`
+	Sep    string              `json:"sep" yaml:"sep"`
+	// Quote, Escape - символы кавычки и экранирования, по умолчанию '"' и удвоенная кавычка
+	Quote         string `json:"quote" yaml:"quote"`
+	Escape        string `json:"escape" yaml:"escape"`
+	LazyQuotes    bool   `json:"lazyQuotes" yaml:"lazyQuotes"`
+	MaxRecordSize int    `json:"maxRecordSize" yaml:"maxRecordSize"`
+	// InferRows - число строк, по которым определяются типы полей, если в [head] нет fields
+	InferRows int `json:"inferRows" yaml:"inferRows"`
+	// TimeOut - время выполнения запроса в секундах, 0 или отсутствие - без ограничения
 	TimeOut time.Duration `json:"timeOut" yaml:"timeOut"`
 	Log     log.Config    `json:"log" yaml:"log"`
+	// SortMemory - объем памяти в байтах для ORDER BY, сверх него строки сортируются
+	// частями во временных файлах каталога TempDir (по умолчанию системный)
+	SortMemory int64  `json:"sortMemory" yaml:"sortMemory"`
+	TempDir    string `json:"tempDir" yaml:"tempDir"`
+	// Index - индексы, используемые для условий вида field = 'value', field > 10, field IN (...)
+	Index []IndexConfig `json:"index" yaml:"index"`
+	// Workers - число горутин, разбирающих и фильтрующих строки (по умолчанию GOMAXPROCS),
+	// ChunkSize - размер части файла в байтах, которую обрабатывает одна горутина
+	Workers   int `json:"workers" yaml:"workers"`
+	ChunkSize int `json:"chunkSize" yaml:"chunkSize"`
+	// Format - формат вывода результата: table, csv, tsv, json, ndjson, markdown
+	Format string `json:"format" yaml:"format"`
+	// Output - файл, в который записывается результат каждого запроса вместо терминала,
+	// формат определяется по расширению (.csv, .json, ...), .gz - сжатие gzip
+	Output string `json:"output" yaml:"output"`
 	// OutputPaths      []string `json:"outputPaths" yaml:"outputPaths"`
 	// ErrorOutputPaths []string `json:"errorOutputPaths" yaml:"errorOutputPaths"`
 	// Log     zap.Config    `json:"log" yaml:"log"`
@@ -34,166 +57,185 @@ var (
 	GitHashCommit string
 )
 
-type OutMessage struct {
-	Err chan error
-	Inf chan string
-	Row chan string
+func (c *Config) readerOptions() csv.ReaderOptions {
+	return csv.ReaderOptions{
+		Sep:           c.Sep,
+		Quote:         c.Quote,
+		Escape:        c.Escape,
+		LazyQuotes:    c.LazyQuotes,
+		MaxRecordSize: c.MaxRecordSize,
+	}
 }
 
-func main() {
-	var (
-		err    error
-		buf    []byte
-		logger *zap.Logger
-		path   string
-	)
+// Exit codes of the program.
+const (
+	exitOK = iota
+	// exitQuery - синтаксическая или иная ошибка запроса
+	exitQuery
+	// exitUsage - неверные флаги или конфигурация
+	exitUsage
+	// exitTimeout - запрос не уложился в timeOut
+	exitTimeout
+	// exitIO - ошибка чтения или записи файла
+	exitIO
+	// exitInterrupted - выполнение прервано сигналом SIGINT или SIGTERM
+	exitInterrupted = 130
+)
+
+// options are the command line flags.
+type options struct {
+	config string
+	file   string
+	exec   string
+	script string
+	format string
+}
 
-	fs := afero.NewOsFs()
+func parseFlags() options {
+	var opts options
+	flag.StringVar(&opts.config, "c", "configs/config.toml", "path of the configuration file")
+	flag.StringVar(&opts.file, "f", "", "CSV file queried when the query has no FROM, [head] of the config by default")
+	flag.StringVar(&opts.exec, "e", "", "execute the queries separated by ';' and exit")
+	flag.StringVar(&opts.script, "q", "", "execute the queries of the file and exit, - reads them from stdin")
+	flag.StringVar(&opts.format, "format", "", "output format: "+strings.Join(csv.FormatNames(), ", "))
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Without -e and -q queries are read from stdin, interactively if it is a terminal.")
+		fmt.Fprintf(flag.CommandLine.Output(), "Exit codes: %d query error, %d usage, %d timeout, %d I/O error, %d interrupted.\n\n",
+			exitQuery, exitUsage, exitTimeout, exitIO, exitInterrupted)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	return opts
+}
 
-	if buf, err = afero.ReadFile(fs, "configs/config.toml"); err != nil {
-		panic(fmt.Errorf("configuration error: %w", err).Error())
+// loadConfig reads the configuration file and applies the flags to it.
+func loadConfig(opts options) (Config, error) {
+	var config Config
+	buf, err := afero.ReadFile(afero.NewOsFs(), opts.config)
+	if err != nil {
+		return config, err
 	}
 	if err = toml.Unmarshal(buf, &config); err != nil {
-		panic(fmt.Errorf("configuration error: %w", err).Error())
+		return config, err
 	}
-
-	if logger, err = log.New(config.Log); err != nil {
-		panic(fmt.Errorf("logger created error: %w", err).Error())
+	if opts.file != "" && opts.file != config.Head.Path {
+		config.Head = csv.Head{Path: opts.file, Strict: config.Head.Strict, IgnoreCase: config.Head.IgnoreCase}
 	}
-	defer func() {
-		if errLog := logger.Sync(); errLog != nil {
-			fmt.Println(errLog)
-			return
+	if err = config.Head.ParseLayouts(); err != nil {
+		return config, fmt.Errorf("head: %w", err)
+	}
+	for name, head := range config.Tables {
+		if err = head.ParseLayouts(); err != nil {
+			return config, fmt.Errorf("table %q: %w", name, err)
 		}
-	}()
-
-	if path, err = os.Getwd(); err != nil {
-		logger.Fatal(err.Error())
 	}
-
-	fmt.Println("Working directory: ", path)
-	fmt.Println("GitCommit: ", GitCommit)
-	fmt.Println("GitHashCommit: ", GitHashCommit)
-
-	ctxMain, cancelMain := context.WithCancel(context.Background())
-	defer cancelMain()
-	outMessage := OutMessage{
-		Err: make(chan error),
-		Inf: make(chan string),
+	if opts.format != "" {
+		config.Format = opts.format
 	}
-
-	go watchSignals(cancelMain, outMessage)
-	go func() {
-		for {
-			select {
-			case <-ctxMain.Done():
-				return
-			default:
-				outMessage.Row = make(chan string)
-				linesMatcher(ctxMain, &config, &outMessage, config.TimeOut)
-			}
-		}
-	}()
-	for {
-		select {
-		case <-ctxMain.Done():
-			return
-		case err := <-outMessage.Err:
-			logger.Error(err.Error())
-		case message := <-outMessage.Inf:
-			logger.Info(message)
-		}
+	if _, err = csv.NewRowWriter(config.Format, io.Discard, nil); err != nil {
+		return config, err
 	}
+	return config, nil
 }
 
-func watchSignals(cancel context.CancelFunc, outMessage OutMessage) {
-	osSignalChan := make(chan os.Signal, 1)
-
-	signal.Notify(osSignalChan,
-		syscall.SIGINT)
-	sig := <-osSignalChan
-	outMessage.Err <- fmt.Errorf("got signal %q", sig.String())
+// exitCode returns the exit code for the error of a query.
+func exitCode(err error) int {
+	var pathErr *os.PathError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	case errors.As(err, &pathErr), errors.Is(err, csv.ErrQuote), errors.Is(err, csv.ErrBareQuote),
+		errors.Is(err, csv.ErrRecordTooLarge), errors.Is(err, io.ErrUnexpectedEOF):
+		return exitIO
+	default:
+		return exitQuery
+	}
+}
 
-	// если сигнал получен, отменяем контекст работы
-	cancel()
+func main() {
+	os.Exit(run())
 }
 
-func fileReader(ctx context.Context, path string, outMessage *OutMessage) {
-	defer close(outMessage.Row)
-	file, err := os.Open(path)
+// run executes the queries of the flags, a script or the REPL and returns the exit code.
+func run() int {
+	opts := parseFlags()
+	var err error
+	if config, err = loadConfig(opts); err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("configuration error: %w", err))
+		return exitUsage
+	}
+	logger, err := log.New(config.Log)
 	if err != nil {
-		outMessage.Err <- fmt.Errorf("file open error: %w", err)
-		return
+		fmt.Fprintln(os.Stderr, fmt.Errorf("logger created error: %w", err))
+		return exitUsage
 	}
-	defer file.Close()
-
-	reader := bufio.NewScanner(file)
-	for reader.Scan() {
-		select {
-		case <-ctx.Done():
-			outMessage.Err <- ctx.Err()
-			return
-		default:
-			outMessage.Row <- reader.Text()
+	defer func() {
+		if errLog := logger.Sync(); errLog != nil {
+			fmt.Fprintln(os.Stderr, errLog)
 		}
-	}
-}
+	}()
 
-func linesMatcher(ctxParent context.Context, config *Config, outMessage *OutMessage, timeOut time.Duration) {
-	sc := bufio.NewScanner(os.Stdin)
-	var answer string = "y"
-
-	if config.Head.Fields == nil {
-		fmt.Printf(`
-В config.toml не найдена информация о названиях полей.
-Использовать первую строку в файле %s для инициализации полей?
-	
-Нажмите Y(да)/N(нет, завершить)`, config.Head.Path)
-		if sc.Scan() {
-			answer = sc.Text()
+	stat, err := os.Stdin.Stat()
+	interactive := opts.exec == "" && opts.script == "" && err == nil && stat.Mode()&os.ModeCharDevice != 0
+	if interactive {
+		path, err := os.Getwd()
+		if err != nil {
+			logger.Error(err.Error())
+			return exitIO
 		}
-	}
-	fmt.Print("csv_query>> ")
-
-	var query string = "continent='Asia' and date='2020-04-14'"
-	if sc.Scan() {
-		query = sc.Text()
-		outMessage.Inf <- query
+		fmt.Println("Working directory: ", path)
+		fmt.Println("GitCommit: ", GitCommit)
+		fmt.Println("GitHashCommit: ", GitHashCommit)
 	}
 
-	// nolint:govet
-	ctx, _ := context.WithTimeout(ctxParent, timeOut*time.Second)
-	go fileReader(ctx, config.Head.Path, outMessage)
+	buildIndexes(&config, logger)
 
-	switch answer {
-	case "Y", "y":
-		var str string = <-outMessage.Row
-		config.Head.Fields = csv.GetFields(str, config.Sep)
-	default:
-		return
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &session{config: &config, logger: logger, timeout: config.TimeOut * time.Second, out: os.Stdout}
+	if interactive {
+		s.interrupts = make(chan struct{}, 1)
 	}
+	go s.watchSignals(cancel)
+	return s.start(ctx, opts, interactive)
+}
 
-	var wgInside sync.WaitGroup
-	for val := range outMessage.Row {
-		select {
-		case <-ctx.Done():
-			outMessage.Err <- ctx.Err()
-			return
-		default:
-			wgInside.Add(1)
-			go func(value string) {
-				defer wgInside.Done()
-				if len(value) > 0 {
-					row := config.Head.NewRow()
-					row.Values = strings.Split(value, config.Sep)
-					if row.IsMatch(query) {
-						fmt.Println(row.Values)
-					}
-				}
-			}(val)
+// start executes the queries of the flags, a script or the REPL and returns the exit code.
+func (s *session) start(ctx context.Context, opts options, interactive bool) int {
+	switch {
+	case opts.exec != "":
+		return s.script(ctx, opts.exec)
+	case opts.script != "":
+		var (
+			buf []byte
+			err error
+		)
+		if opts.script == "-" {
+			buf, err = io.ReadAll(os.Stdin)
+		} else {
+			buf, err = os.ReadFile(opts.script)
+		}
+		if err != nil {
+			s.fail(err)
+			return exitIO
 		}
+		return s.script(ctx, string(buf))
+	case !interactive:
+		buf, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			s.fail(err)
+			return exitIO
+		}
+		return s.script(ctx, string(buf))
+	default:
+		s.repl(ctx, os.Stdin)
+		return exitOK
 	}
-	wgInside.Wait()
 }
 
 // export GIT_COMMIT=$(git rev-list -1 HEAD) && \ go build -ldflags "-X main.GitCommit=$GIT_COMMIT"
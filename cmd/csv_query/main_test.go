@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	_, openErr := os.Open("missing.csv")
+	_, syntaxErr := csv.ParseStatement("SELECT FROM")
+	assert.Error(t, syntaxErr)
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"ok", nil, exitOK},
+		{"syntax", syntaxErr, exitQuery},
+		{"query", errors.New(`unknown column "x"`), exitQuery},
+		{"timeout", fmt.Errorf("query timed out after 1s: %w", context.DeadlineExceeded), exitTimeout},
+		{"interrupt", fmt.Errorf("query interrupted: %w", context.Canceled), exitInterrupted},
+		{"open", fmt.Errorf("file open error: %w", openErr), exitIO},
+		{"quote", fmt.Errorf("data.csv: %w", csv.ErrQuote), exitIO},
+		{"bare quote", fmt.Errorf("data.csv: %w", csv.ErrBareQuote), exitIO},
+		{"record too large", csv.ErrRecordTooLarge, exitIO},
+		{"truncated", io.ErrUnexpectedEOF, exitIO},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, exitCode(tt.err), tt.name)
+	}
+}
+
+func TestScriptExitCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		timeout time.Duration
+		want    int
+	}{
+		{"ok", "SELECT name WHERE id = 1; SELECT count(*)", 5 * time.Second, exitOK},
+		{"syntax", "SELECT name WHERE id = = 1", 5 * time.Second, exitQuery},
+		{"unknown column", "SELECT nope", 5 * time.Second, exitQuery},
+		{"missing file", "SELECT * FROM missing.csv", 5 * time.Second, exitIO},
+		{"timeout", "SELECT count(*)", time.Nanosecond, exitTimeout},
+		{"stops at the first error", "SELECT nope; SELECT * FROM missing.csv", 5 * time.Second, exitQuery},
+	}
+	for _, tt := range tests {
+		s, _, dir := newTestSession(t)
+		s.timeout = tt.timeout
+		// FROM paths are relative to the working directory
+		wd, err := os.Getwd()
+		if !assert.NoError(t, err) || !assert.NoError(t, os.Chdir(dir)) {
+			return
+		}
+		got := s.script(context.Background(), tt.script)
+		assert.NoError(t, os.Chdir(wd))
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+}
+
+func TestLoadConfigFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if !assert.NoError(t, os.WriteFile(path, []byte("format = \"csv\"\n[head]\npath = \"data.csv\"\n"), 0o600)) {
+		return
+	}
+	config, err := loadConfig(options{config: path, format: "JSON"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "JSON", config.Format)
+	}
+	// run exits with exitUsage on any error of loadConfig
+	_, err = loadConfig(options{config: path, format: "xml"})
+	assert.Error(t, err)
+	_, err = loadConfig(options{config: filepath.Join(filepath.Dir(path), "missing.toml")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+)
+
+func isMetaCommand(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), `\`)
+}
+
+// errQuit is returned by \q to end the REPL or the script.
+var errQuit = errors.New("quit")
+
+// metaCommands are the names of the backslash commands, completed in the REPL.
+var metaCommands = []string{`\d`, `\dt`, `\schema`, `\indexes`, `\timing`, `\format`, `\o`, `\i`, `\set`, `\q`, `\?`}
+
+// maxIncludes bounds the nesting of scripts run by \i.
+const maxIncludes = 16
+
+// metaHelp describes the backslash commands for \?.
+const metaHelp = `\d [table]          columns and types of the table, by default the [head] one
+\dt                 tables of the config
+\schema [toml]      inferred schema of the [head] table
+\indexes            indexes of the config
+\timing [on|off]    toggle the time of queries
+\format [name]      output format of results
+\o [file]           write the following results to the file, to the terminal without one
+\i file             execute the statements of the file
+\set [name value]   set timeout (5s, 0 for none) or workers, print the settings without a name
+\q                  quit
+\?                  this help
+`
+
+// metaCommand executes a backslash command of the REPL.
+func (s *session) metaCommand(ctx context.Context, line string) error {
+	config := s.config
+	line = strings.TrimSpace(line)
+	args := strings.Fields(line)
+	switch args[0] {
+	case `\d`:
+		return describeTable(s.out, config, args[1:])
+	case `\dt`:
+		printTables(s.out, config)
+		return nil
+	case `\schema`:
+		fields, err := inferSchema(config, config.Head.Path)
+		if err != nil {
+			return err
+		}
+		if len(args) > 1 && args[1] == "toml" {
+			fmt.Fprint(s.out, csv.SchemaTOML(config.Head.Path, fields))
+			return nil
+		}
+		for _, field := range fields {
+			fmt.Fprintf(s.out, "%-40s %-8s %s\n", field.Name, field.Type, field.Layout)
+		}
+		return nil
+	case `\indexes`:
+		printIndexes(s.out)
+		return nil
+	case `\timing`:
+		return s.setTiming(args[1:])
+	case `\format`:
+		return setFormat(s.out, args[1:], config)
+	case `\o`:
+		return s.setOutput(strings.TrimSpace(strings.TrimPrefix(line, `\o`)))
+	case `\i`:
+		return s.include(ctx, strings.TrimSpace(strings.TrimPrefix(line, `\i`)))
+	case `\set`:
+		return s.set(args[1:])
+	case `\q`:
+		return errQuit
+	case `\?`:
+		fmt.Fprint(s.out, metaHelp)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %s, \\? for help", args[0])
+	}
+}
+
+// describeTable prints the columns of the table named or of the [head] table.
+func describeTable(w io.Writer, config *Config, args []string) error {
+	var ref *csv.TableRef
+	if len(args) > 0 {
+		ref = &csv.TableRef{Name: args[0]}
+	}
+	table, err := tableHead(config, ref)
+	if err != nil {
+		return err
+	}
+	head, err := fileHead(config, table)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "table %s\n", head.Path)
+	fmt.Fprintf(w, "%-40s %-8s %s\n", "column", "type", "layout")
+	for _, field := range head.Fields {
+		fmt.Fprintf(w, "%-40s %-8s %s\n", field.Name, field.Type, field.Layout)
+	}
+	return nil
+}
+
+// printTables prints the [head] table and the tables of [tables].
+func printTables(w io.Writer, config *Config) {
+	if config.Head.Path == "" && len(config.Tables) == 0 {
+		fmt.Fprintln(w, "no tables, see [head] and [tables] in config.toml")
+		return
+	}
+	fmt.Fprintf(w, "%-20s %s\n", "table", "path")
+	if config.Head.Path != "" {
+		fmt.Fprintf(w, "%-20s %s\n", "[head]", config.Head.Path)
+	}
+	names := make([]string, 0, len(config.Tables))
+	for name := range config.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%-20s %s\n", name, config.Tables[name].Path)
+	}
+}
+
+// setTiming switches printing the time of queries, without an argument it toggles it.
+func (s *session) setTiming(args []string) error {
+	switch {
+	case len(args) == 0:
+		s.timing = !s.timing
+	case strings.EqualFold(args[0], "on"):
+		s.timing = true
+	case strings.EqualFold(args[0], "off"):
+		s.timing = false
+	default:
+		return fmt.Errorf("\\timing: expected on or off, got %q", args[0])
+	}
+	if s.timing {
+		fmt.Fprintln(s.out, "timing is on")
+	} else {
+		fmt.Fprintln(s.out, "timing is off")
+	}
+	return nil
+}
+
+// include executes the statements of the script file until one fails.
+func (s *session) include(ctx context.Context, path string) error {
+	if path == "" {
+		return errors.New("\\i: file name expected")
+	}
+	if s.includes >= maxIncludes {
+		return fmt.Errorf("\\i %s: scripts nested too deep", path)
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s.includes++
+	defer func() { s.includes-- }()
+	stmts, _ := csv.SplitScript(string(buf) + "\n;")
+	for _, stmt := range stmts {
+		if err = s.execute(ctx, stmt); err != nil {
+			if errors.Is(err, errQuit) {
+				return err
+			}
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// set changes a setting of the session or prints them without arguments.
+func (s *session) set(args []string) error {
+	switch {
+	case len(args) == 0:
+		workers := "auto"
+		if s.config.Workers > 0 {
+			workers = strconv.Itoa(s.config.Workers)
+		}
+		timeout := "none"
+		if s.timeout > 0 {
+			timeout = s.timeout.String()
+		}
+		fmt.Fprintf(s.out, "timeout %s\nworkers %s\n", timeout, workers)
+		return nil
+	case len(args) != 2:
+		return errors.New("\\set: expected name and value")
+	}
+	switch name, value := strings.ToLower(args[0]), args[1]; name {
+	case "timeout":
+		timeout, err := time.ParseDuration(value)
+		if n, errInt := strconv.Atoi(value); errInt == nil {
+			timeout, err = time.Duration(n)*time.Second, nil
+		}
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("\\set timeout: invalid duration %q", value)
+		}
+		s.timeout = timeout
+	case "workers":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("\\set workers: invalid number %q", value)
+		}
+		s.config.Workers = n
+	default:
+		return fmt.Errorf("\\set: unknown setting %q, expected timeout or workers", name)
+	}
+	return nil
+}
+
+// setFormat switches the output format of the following queries
+// or prints the current one if there is no argument.
+func setFormat(w io.Writer, args []string, config *Config) error {
+	if len(args) == 0 {
+		format := config.Format
+		if format == "" {
+			format = csv.FormatTable
+		}
+		fmt.Fprintf(w, "format %s, available: %s\n", format, strings.Join(csv.FormatNames(), ", "))
+		return nil
+	}
+	if _, err := csv.NewRowWriter(args[0], io.Discard, nil); err != nil {
+		return err
+	}
+	config.Format = strings.ToLower(args[0])
+	return nil
+}
+
+// setOutput writes the result of each following query to the file, replacing
+// it when the query completes. Without a path the results are printed to the
+// terminal again.
+func (s *session) setOutput(path string) error {
+	s.config.Output = path
+	if path == "" {
+		fmt.Fprintln(s.out, "output to the terminal")
+		return nil
+	}
+	format := csv.FormatOf(path)
+	if format == "" {
+		format = s.config.Format
+	}
+	if format == "" {
+		format = csv.FormatTable
+	}
+	fmt.Fprintf(s.out, "output to %s as %s\n", path, format)
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// newTestSession returns a session over a small table in a temporary directory
+// writing csv to the buffer.
+func newTestSession(t *testing.T) (*session, *bytes.Buffer, string) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.csv")
+	assert.NoError(t, os.WriteFile(path, []byte("id,name\n1,a\n2,b\n3,c\n"), 0o600))
+	var out bytes.Buffer
+	s := &session{
+		config:  &Config{Head: csv.Head{Path: path}, Format: csv.FormatCSV},
+		logger:  zap.NewNop(),
+		timeout: 5 * time.Second,
+		out:     &out,
+	}
+	return s, &out, dir
+}
+
+func TestMetaSet(t *testing.T) {
+	s, out, _ := newTestSession(t)
+	ctx := context.Background()
+	assert.NoError(t, s.execute(ctx, `\set`))
+	assert.Equal(t, "timeout 5s\nworkers auto\n", out.String())
+
+	assert.NoError(t, s.execute(ctx, `\set timeout 2`))
+	assert.Equal(t, 2*time.Second, s.timeout)
+	assert.NoError(t, s.execute(ctx, `\set TIMEOUT 150ms`))
+	assert.Equal(t, 150*time.Millisecond, s.timeout)
+	assert.NoError(t, s.execute(ctx, `\set workers 3`))
+	assert.Equal(t, 3, s.config.Workers)
+	out.Reset()
+	assert.NoError(t, s.execute(ctx, `\set`))
+	assert.Equal(t, "timeout 150ms\nworkers 3\n", out.String())
+
+	for _, line := range []string{`\set timeout -1s`, `\set timeout x`, `\set workers -1`, `\set workers`, `\set depth 1`} {
+		assert.Error(t, s.execute(ctx, line), line)
+	}
+	assert.Equal(t, 150*time.Millisecond, s.timeout)
+	assert.Equal(t, 3, s.config.Workers)
+
+	// a zero timeout, the default without timeOut in the config, is no deadline
+	assert.NoError(t, s.execute(ctx, `\set timeout 0`))
+	out.Reset()
+	assert.NoError(t, s.execute(ctx, `\set`))
+	assert.Equal(t, "timeout none\nworkers 3\n", out.String())
+	out.Reset()
+	assert.NoError(t, s.execute(ctx, "SELECT count(*)"))
+	assert.Equal(t, "COUNT(*)\n3\n", out.String())
+}
+
+func TestMetaTiming(t *testing.T) {
+	s, out, _ := newTestSession(t)
+	ctx := context.Background()
+	for _, tt := range []struct {
+		line   string
+		timing bool
+	}{
+		{`\timing`, true},
+		{`\timing`, false},
+		{`\timing ON`, true},
+		{`\timing on`, true},
+		{`\timing off`, false},
+	} {
+		out.Reset()
+		assert.NoError(t, s.execute(ctx, tt.line), tt.line)
+		assert.Equal(t, tt.timing, s.timing, tt.line)
+		if tt.timing {
+			assert.Equal(t, "timing is on\n", out.String(), tt.line)
+		} else {
+			assert.Equal(t, "timing is off\n", out.String(), tt.line)
+		}
+	}
+	assert.Error(t, s.execute(ctx, `\timing maybe`))
+	assert.False(t, s.timing)
+}
+
+func TestMetaDescribe(t *testing.T) {
+	s, out, dir := newTestSession(t)
+	ctx := context.Background()
+	assert.NoError(t, s.execute(ctx, `\d`))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Len(t, lines, 4) {
+		assert.Equal(t, "table "+s.config.Head.Path, lines[0])
+		assert.Equal(t, []string{"column", "type", "layout"}, strings.Fields(lines[1]))
+		assert.Equal(t, []string{"id", "int"}, strings.Fields(lines[2]))
+		assert.Equal(t, []string{"name", "string"}, strings.Fields(lines[3]))
+	}
+
+	other := filepath.Join(dir, "other.csv")
+	assert.NoError(t, os.WriteFile(other, []byte("day\n2020-04-14\n"), 0o600))
+	s.config.Tables = map[string]csv.Head{"days": {Path: other}}
+	out.Reset()
+	assert.NoError(t, s.execute(ctx, `\d days`))
+	assert.Contains(t, out.String(), "table "+other+"\n")
+	assert.Equal(t, []string{"day", "date", "2006-01-02"}, strings.Fields(strings.Split(out.String(), "\n")[2]))
+
+	out.Reset()
+	assert.NoError(t, s.execute(ctx, `\dt`))
+	assert.Equal(t, []string{"[head]", s.config.Head.Path}, strings.Fields(strings.Split(out.String(), "\n")[1]))
+	assert.Equal(t, []string{"days", other}, strings.Fields(strings.Split(out.String(), "\n")[2]))
+
+	assert.Error(t, s.execute(ctx, `\d missing`))
+	assert.Error(t, s.execute(ctx, `\nope`))
+	assert.True(t, errors.Is(s.execute(ctx, `\q`), errQuit))
+}
+
+func TestMetaInclude(t *testing.T) {
+	s, out, dir := newTestSession(t)
+	ctx := context.Background()
+	script := filepath.Join(dir, "script.sql")
+	assert.NoError(t, os.WriteFile(script, []byte("\\set workers 2\nSELECT name WHERE id > 1;\nSELECT count(*)"), 0o600))
+	assert.NoError(t, s.execute(ctx, `\i `+script))
+	assert.Equal(t, 2, s.config.Workers)
+	assert.Equal(t, "name\nb\nc\nCOUNT(*)\n3\n", out.String())
+
+	// the statements after \q are not executed
+	assert.NoError(t, os.WriteFile(script, []byte("\\q\nSELECT name;"), 0o600))
+	out.Reset()
+	assert.True(t, errors.Is(s.execute(ctx, `\i `+script), errQuit))
+	assert.Empty(t, out.String())
+
+	// a failing statement stops the script and is reported with its path
+	assert.NoError(t, os.WriteFile(script, []byte("SELECT nope;\nSELECT name;"), 0o600))
+	out.Reset()
+	err := s.execute(ctx, `\i `+script)
+	assert.True(t, err != nil && strings.HasPrefix(err.Error(), script+": "), err)
+	assert.Empty(t, out.String())
+
+	assert.NoError(t, os.WriteFile(script, []byte(`\i `+script), 0o600))
+	err = s.execute(ctx, `\i `+script)
+	assert.True(t, err != nil && strings.Contains(err.Error(), "nested too deep"), err)
+	assert.Zero(t, s.includes)
+
+	assert.Error(t, s.execute(ctx, `\i`))
+	assert.Error(t, s.execute(ctx, `\i `+filepath.Join(dir, "missing.sql")))
+}
+
+func TestMetaOutput(t *testing.T) {
+	s, out, dir := newTestSession(t)
+	ctx := context.Background()
+	path := filepath.Join(dir, "out.json")
+	assert.NoError(t, s.execute(ctx, `\o `+path))
+	assert.Equal(t, "output to "+path+" as json\n", out.String())
+
+	// each result replaces the file as soon as its query completes,
+	// so the file is always a single valid document
+	var rows []map[string]interface{}
+	assert.NoError(t, s.execute(ctx, "SELECT name WHERE id = 1"))
+	data, err := os.ReadFile(path)
+	if assert.NoError(t, err) && assert.NoError(t, json.Unmarshal(data, &rows)) {
+		assert.Equal(t, []map[string]interface{}{{"name": "a"}}, rows)
+	}
+	assert.NoError(t, s.execute(ctx, "SELECT id WHERE id > 1"))
+	data, err = os.ReadFile(path)
+	rows = nil
+	if assert.NoError(t, err) && assert.NoError(t, json.Unmarshal(data, &rows)) {
+		assert.Equal(t, []map[string]interface{}{{"id": 2.0}, {"id": 3.0}}, rows)
+	}
+
+	out.Reset()
+	assert.NoError(t, s.execute(ctx, `\o`))
+	assert.Equal(t, "output to the terminal\n", out.String())
+	out.Reset()
+	assert.NoError(t, s.execute(ctx, "SELECT count(*)"))
+	assert.Equal(t, "COUNT(*)\n3\n", out.String())
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "[\n{\"id\":2},\n{\"id\":3}\n]\n", string(data))
+
+	// the format of a file without a known extension is the one of the session
+	other := filepath.Join(dir, "out.dat")
+	assert.NoError(t, s.execute(ctx, `\o `+other))
+	assert.NoError(t, s.execute(ctx, "SELECT name WHERE id = 3"))
+	data, err = os.ReadFile(other)
+	assert.NoError(t, err)
+	assert.Equal(t, "name\nc\n", string(data))
+}
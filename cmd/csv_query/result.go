@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+)
+
+// errLimit stops the scan when LIMIT rows are printed.
+var errLimit = errors.New("limit reached")
+
+// result collects the rows matching a query and writes them to the terminal
+// or to the file of INTO or \o applying GROUP BY, ORDER BY, OFFSET and LIMIT.
+// Rows are projected concurrently and emitted one by one in the order of the input.
+type result struct {
+	query  *csv.Query
+	writer csv.RowWriter
+	file   *csv.OutputFile
+	// target is the path of the file, empty for the terminal
+	target   string
+	agg      *csv.Aggregator
+	sorter   *csv.Sorter
+	produced int64
+}
+
+// newResult writes the result to out in the format of the config, a file is
+// written in the format of its extension if it is known.
+func newResult(q *csv.Query, config *Config, out io.Writer) (*result, error) {
+	r := &result{query: q}
+	w := out
+	format := config.Format
+	path := q.Statement.Into
+	if path == "" {
+		path = config.Output
+	}
+	if path != "" {
+		if f := csv.FormatOf(path); f != "" {
+			format = f
+		}
+		file, err := csv.CreateOutput(path)
+		if err != nil {
+			return nil, err
+		}
+		r.file, r.target, w = file, path, file
+	}
+	var err error
+	if r.writer, err = csv.NewRowWriter(format, w, q.Columns); err != nil {
+		r.close()
+		return nil, err
+	}
+	if q.Grouped() {
+		r.agg = csv.NewAggregator(q)
+	}
+	if q.Ordered() {
+		r.sorter = csv.NewSorter(q, csv.SortOptions{Memory: config.SortMemory, TempDir: config.TempDir})
+	}
+	return r, nil
+}
+
+// project returns the result values of a row matching WHERE, nil with GROUP BY
+// where they are known after the scan. It is safe for concurrent use.
+func (r *result) project(row *csv.Row) ([]csv.Value, error) {
+	if r.agg != nil {
+		return nil, nil
+	}
+	return r.query.Project(row)
+}
+
+// emit takes a row matching WHERE and its values in the order of the input,
+// it returns errLimit when no more rows are needed.
+func (r *result) emit(row *csv.Row, values []csv.Value) error {
+	if r.agg != nil {
+		return r.agg.Add(row)
+	}
+	return r.output(row, values)
+}
+
+// output passes a result row to the sorter or writes it.
+func (r *result) output(row *csv.Row, values []csv.Value) error {
+	if r.sorter != nil {
+		return r.sorter.Add(row, values)
+	}
+	stmt := r.query.Statement
+	if stmt.Limit != nil && r.produced >= stmt.Offset+*stmt.Limit {
+		return errLimit
+	}
+	if r.produced++; r.produced > stmt.Offset {
+		if err := r.writer.WriteRow(values); err != nil {
+			return err
+		}
+	}
+	if stmt.Limit != nil && r.produced >= stmt.Offset+*stmt.Limit {
+		return errLimit
+	}
+	return nil
+}
+
+// flush writes the groups and the sorted rows after the scan and completes the output.
+func (r *result) flush(ctx context.Context) error {
+	var err error
+	if r.agg != nil {
+		err = r.agg.Each(func(row *csv.Row, values []csv.Value) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return r.output(row, values)
+		})
+	}
+	if err == nil && r.sorter != nil {
+		err = r.sorter.Each(func(values []csv.Value) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return r.writer.WriteRow(values)
+		})
+	}
+	if err != nil && err != errLimit {
+		return err
+	}
+	if err = r.writer.Flush(); err != nil || r.file == nil {
+		return err
+	}
+	err = r.file.Commit()
+	r.file = nil
+	return err
+}
+
+// close removes temporary files of the sort and the output file
+// if the result is not complete.
+func (r *result) close() {
+	if r.file != nil {
+		r.file.Abort()
+	}
+	if r.sorter != nil {
+		r.sorter.Close()
+	}
+}
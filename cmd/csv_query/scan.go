@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+)
+
+// recordsPerJob is the number of records found by an index or a join
+// a worker takes at once.
+const recordsPerJob = 1024
+
+// job is a part of the input for a worker: a chunk of the file or records
+// read by an index or a join. seq numbers the jobs in the order of the input,
+// err is an error of the reader reported in that order.
+type job struct {
+	seq     int64
+	chunk   *csv.Chunk
+	records [][]string
+	err     error
+}
+
+// matched is a row matching WHERE and its result values, nil for GROUP BY.
+type matched struct {
+	row    *csv.Row
+	values []csv.Value
+}
+
+// batch is the result of a job, the rows are written before err is reported.
+// records is the number of records of the job matched.
+type batch struct {
+	seq     int64
+	rows    []matched
+	records int64
+	err     error
+}
+
+// pipeline passes the jobs of a reader to a pool of workers and their batches
+// to the sequencer writing them in the order of the input. slots bound the jobs
+// read but not written yet, so the reader waits when the workers or the output
+// fall behind and the batches waiting for an earlier one do not pile up.
+// processed counts the records of the batches passed to the sequencer.
+type pipeline struct {
+	ctx       context.Context
+	jobs      chan job
+	batches   chan batch
+	slots     chan struct{}
+	seq       int64
+	processed int64
+}
+
+func newPipeline(ctx context.Context, workers int) *pipeline {
+	return &pipeline{
+		ctx:     ctx,
+		jobs:    make(chan job),
+		batches: make(chan batch, workers),
+		slots:   make(chan struct{}, 2*workers),
+	}
+}
+
+// send passes the job to the workers, it returns false when the scan is stopped.
+func (p *pipeline) send(j job) bool {
+	select {
+	case <-p.ctx.Done():
+		return false
+	case p.slots <- struct{}{}:
+	}
+	j.seq = p.seq
+	select {
+	case <-p.ctx.Done():
+		<-p.slots
+		return false
+	case p.jobs <- j:
+		p.seq++
+		return true
+	}
+}
+
+// run starts the workers matching the rows of the jobs, the batches are closed
+// when the jobs are closed and processed.
+func (p *pipeline) run(workers int, q *csv.Query, res *result, opts csv.ReaderOptions) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range p.jobs {
+				b := batch{seq: j.seq}
+				if p.ctx.Err() == nil {
+					b.rows, b.records, b.err = match(j, q, res, opts)
+				}
+				if b.err == nil {
+					b.err = j.err
+				}
+				p.batches <- b
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(p.batches)
+	}()
+}
+
+// match parses the records of the job and returns the rows matching the query
+// and the number of records matched.
+func match(j job, q *csv.Query, res *result, opts csv.ReaderOptions) ([]matched, int64, error) {
+	var (
+		rows   []matched
+		reader *csv.Reader
+		err    error
+	)
+	if j.chunk != nil {
+		if reader, err = j.chunk.Reader(opts); err != nil {
+			return nil, 0, err
+		}
+	}
+	for i := int64(0); ; i++ {
+		var record []string
+		switch {
+		case reader != nil:
+			if record, err = reader.Read(); err == io.EOF {
+				return rows, i, nil
+			} else if err != nil {
+				return rows, i, fmt.Errorf("%s: %w", q.Head.Path, err)
+			}
+		case i < int64(len(j.records)):
+			record = j.records[i]
+		default:
+			return rows, i, nil
+		}
+		row := q.Head.NewRow()
+		row.Values = record
+		ok, err := q.Match(row)
+		if err != nil {
+			return rows, i, err
+		}
+		if !ok {
+			continue
+		}
+		values, err := res.project(row)
+		if err != nil {
+			return rows, i, err
+		}
+		rows = append(rows, matched{row: row, values: values})
+	}
+}
+
+// write passes the batches to the result in the order of the input until
+// the result has enough rows or an error, stop is called then. It returns the error.
+func (p *pipeline) write(res *result, stop context.CancelFunc) error {
+	var (
+		pending = make(map[int64]batch)
+		next    int64
+		failure error
+	)
+	for b := range p.batches {
+		pending[b.seq] = b
+		for {
+			b, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			p.processed += b.records
+			<-p.slots
+			if failure != nil || p.ctx.Err() != nil {
+				continue
+			}
+			for _, m := range b.rows {
+				if failure = res.emit(m.row, m.values); failure != nil {
+					break
+				}
+			}
+			if failure == nil {
+				failure = b.err
+			}
+			if failure != nil {
+				stop()
+			}
+		}
+	}
+	if failure == errLimit {
+		return nil
+	}
+	return failure
+}
+
+// fileReader sends the records of the file following the header in chunks.
+func fileReader(p *pipeline, path string, opts csv.ReaderOptions, chunkSize int) {
+	defer close(p.jobs)
+	file, err := os.Open(path)
+	if err != nil {
+		p.send(job{err: fmt.Errorf("file open error: %w", err)})
+		return
+	}
+	defer file.Close()
+
+	reader, err := csv.NewReader(file, opts)
+	if err == nil {
+		_, err = reader.Read()
+	}
+	if err == io.EOF {
+		return
+	}
+	if err != nil {
+		p.send(job{err: fmt.Errorf("%s: %w", path, err)})
+		return
+	}
+	chunker := csv.NewChunker(reader, chunkSize)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			p.send(job{err: fmt.Errorf("%s: %w", path, err)})
+			return
+		}
+		if !p.send(job{chunk: chunk}) {
+			return
+		}
+	}
+}
+
+// offsetReader sends the records starting at the offsets found by an index.
+func offsetReader(p *pipeline, path string, opts csv.ReaderOptions, offsets []int64) {
+	defer close(p.jobs)
+	file, err := os.Open(path)
+	if err != nil {
+		p.send(job{err: fmt.Errorf("file open error: %w", err)})
+		return
+	}
+	defer file.Close()
+
+	reader, err := csv.NewReader(file, opts)
+	if err != nil {
+		p.send(job{err: err})
+		return
+	}
+	var records [][]string
+	for _, offset := range offsets {
+		if _, err = file.Seek(offset, io.SeekStart); err != nil {
+			p.send(job{records: records, err: fmt.Errorf("%s: %w", path, err)})
+			return
+		}
+		reader.Reset(file, offset)
+		record, err := reader.Read()
+		if err != nil {
+			p.send(job{records: records, err: fmt.Errorf("%s at offset %d: %w", path, offset, err)})
+			return
+		}
+		if records = append(records, record); len(records) == recordsPerJob {
+			if !p.send(job{records: records}) {
+				return
+			}
+			records = nil
+		}
+	}
+	if len(records) > 0 {
+		p.send(job{records: records})
+	}
+}
+
+// joinReader sends the records joined by the joiner.
+func joinReader(p *pipeline, joiner *csv.Joiner) {
+	defer close(p.jobs)
+	var records [][]string
+	err := joiner.Run(p.ctx, func(record []string) error {
+		if records = append(records, record); len(records) < recordsPerJob {
+			return nil
+		}
+		if !p.send(job{records: records}) {
+			return p.ctx.Err()
+		}
+		records = nil
+		return nil
+	})
+	switch {
+	case err != nil && p.ctx.Err() == nil:
+		p.send(job{records: records, err: err})
+	case len(records) > 0:
+		p.send(job{records: records})
+	}
+}
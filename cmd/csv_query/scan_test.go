@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+// scanFile writes a file of n records "i,name i" with the record at bad replaced if it is not empty.
+func scanFile(t *testing.T, n, bad int, record string) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("id,name\n")
+	for i := 0; i < n; i++ {
+		if i == bad && record != "" {
+			b.WriteString(record + "\n")
+			continue
+		}
+		fmt.Fprintf(&b, "%d,name %d\n", i, i)
+	}
+	path := filepath.Join(t.TempDir(), "data.csv")
+	assert.NoError(t, os.WriteFile(path, []byte(b.String()), 0o600))
+	return path
+}
+
+// idWriter keeps the first values of the rows written.
+type idWriter struct {
+	ids []string
+}
+
+func (w *idWriter) WriteRow(values []csv.Value) error {
+	w.ids = append(w.ids, values[0].String())
+	return nil
+}
+
+func (w *idWriter) Flush() error { return nil }
+
+// scan runs the query over the file as session.query does and returns the first
+// values of the rows written and the number of records processed.
+func scan(t *testing.T, path, query string, chunkSize, workers int) ([]string, int64, error) {
+	t.Helper()
+	head := csv.Head{Path: path, Strict: true, Fields: []csv.Field{
+		{Name: "id", Type: csv.TypeInt},
+		{Name: "name", Type: csv.TypeString},
+	}}
+	stmt, err := csv.ParseStatement(query)
+	if !assert.NoError(t, err, query) {
+		return nil, 0, err
+	}
+	q, err := csv.Prepare(stmt, &head)
+	if !assert.NoError(t, err, query) {
+		return nil, 0, err
+	}
+	w := &idWriter{}
+	res := &result{query: q, writer: w}
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	p := newPipeline(ctx, workers)
+	go fileReader(p, path, csv.ReaderOptions{}, chunkSize)
+	p.run(workers, q, res, csv.ReaderOptions{})
+	err = p.write(res, stop)
+	if err == nil {
+		err = res.flush(context.Background())
+	}
+	return w.ids, p.processed, err
+}
+
+// ids returns the ids from..to-1.
+func ids(from, to int) []string {
+	var res []string
+	for i := from; i < to; i++ {
+		res = append(res, strconv.Itoa(i))
+	}
+	return res
+}
+
+func TestScanOrder(t *testing.T) {
+	path := scanFile(t, 1000, -1, "")
+	for _, chunkSize := range []int{1, 64, 1 << 20} {
+		for _, workers := range []int{1, 3, 8} {
+			name := fmt.Sprintf("chunk %d, %d workers", chunkSize, workers)
+			out, processed, err := scan(t, path, "SELECT id", chunkSize, workers)
+			assert.NoError(t, err, name)
+			assert.Equal(t, ids(0, 1000), out, name)
+			assert.Equal(t, int64(1000), processed, name)
+
+			out, _, err = scan(t, path, "SELECT id WHERE id % 100 = 7", chunkSize, workers)
+			assert.NoError(t, err, name)
+			assert.Equal(t, []string{"7", "107", "207", "307", "407", "507", "607", "707", "807", "907"}, out, name)
+		}
+	}
+}
+
+func TestScanLimit(t *testing.T) {
+	path := scanFile(t, 10000, -1, "")
+	for _, workers := range []int{1, 4} {
+		name := fmt.Sprintf("%d workers", workers)
+		out, processed, err := scan(t, path, "SELECT id LIMIT 5 OFFSET 3", 64, workers)
+		assert.NoError(t, err, name)
+		assert.Equal(t, ids(3, 8), out, name)
+		// the reader stops soon after the rows are written
+		assert.True(t, processed < 10000, "%s: %d records processed", name, processed)
+
+		out, _, err = scan(t, path, "SELECT id WHERE id >= 9990 LIMIT 3", 64, workers)
+		assert.NoError(t, err, name)
+		assert.Equal(t, ids(9990, 9993), out, name)
+	}
+}
+
+func TestScanError(t *testing.T) {
+	// a value that is not an int fails the strict query at the record, the rows
+	// before it are written
+	path := scanFile(t, 1000, 500, "x,name x")
+	for _, workers := range []int{1, 4} {
+		name := fmt.Sprintf("%d workers", workers)
+		out, _, err := scan(t, path, "SELECT id WHERE id >= 0", 64, workers)
+		assert.Error(t, err, name)
+		assert.Equal(t, ids(0, 500), out, name)
+	}
+
+	// an error of the reader is reported after the rows of the chunks before it
+	path = scanFile(t, 1000, 500, `500,"name" 500`)
+	for _, workers := range []int{1, 4} {
+		name := fmt.Sprintf("%d workers", workers)
+		out, _, err := scan(t, path, "SELECT id", 64, workers)
+		assert.True(t, errors.Is(err, csv.ErrQuote) || errors.Is(err, csv.ErrBareQuote), "%s: %v", name, err)
+		assert.Equal(t, ids(0, len(out)), out, name)
+		assert.True(t, len(out) <= 500, name)
+	}
+
+	_, _, err := scan(t, filepath.Join(t.TempDir(), "missing.csv"), "SELECT id", 64, 2)
+	var pathErr *os.PathError
+	assert.True(t, errors.As(err, &pathErr), err)
+}
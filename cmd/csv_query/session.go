@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/AleksandrMac/csv_query/pkg/readline"
+	"go.uber.org/zap"
+)
+
+// session executes the statements of the REPL or a script,
+// meta-commands change its config for the following statements.
+type session struct {
+	config  *Config
+	logger  *zap.Logger
+	timeout time.Duration
+	// out gets the results and the output of meta-commands, os.Stdout
+	out io.Writer
+	// timing prints the time of each query, see \timing
+	timing bool
+	// includes is the nesting of scripts run by \i
+	includes int
+	// interrupts passes SIGINT received at the prompt to the REPL, nil out of it
+	interrupts chan struct{}
+
+	// mu guards the cancel of the running query, nil between queries,
+	// and cancelled set when it is called
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// fail reports the error to stderr and to the error log.
+func (s *session) fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	s.logger.Error(err.Error())
+}
+
+// script executes the statements of the text until one fails and returns the exit code.
+func (s *session) script(ctx context.Context, text string) int {
+	stmts, _ := csv.SplitScript(text + "\n;")
+	for _, stmt := range stmts {
+		if err := s.execute(ctx, stmt); errors.Is(err, errQuit) {
+			return exitOK
+		} else if err != nil {
+			s.fail(err)
+			return exitCode(err)
+		}
+	}
+	return exitOK
+}
+
+// watchSignals cancels the running query on SIGINT or clears the line at the
+// prompt, quit is called on SIGTERM or a SIGINT with nothing to cancel.
+func (s *session) watchSignals(quit context.CancelFunc) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range signals {
+		s.logger.Info(fmt.Sprintf("got signal %q", sig.String()))
+		if sig == syscall.SIGINT && s.interrupt() {
+			continue
+		}
+		signal.Stop(signals)
+		quit()
+		return
+	}
+}
+
+// interrupt cancels the running query or passes the interrupt to the prompt.
+// It returns false on a second SIGINT before the query stops and out of the REPL
+// between queries.
+func (s *session) interrupt() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.cancel != nil && !s.cancelled:
+		s.cancel()
+		s.cancelled = true
+		return true
+	case s.cancel == nil && s.interrupts != nil:
+		select {
+		case s.interrupts <- struct{}{}:
+		default:
+		}
+		return true
+	}
+	return false
+}
+
+// running sets the cancel of the running query, nil when it is over.
+func (s *session) running(cancel context.CancelFunc) {
+	s.mu.Lock()
+	s.cancel, s.cancelled = cancel, false
+	s.mu.Unlock()
+}
+
+// prompts of the REPL for a new statement and for the next line of a statement.
+const (
+	prompt         = "csv_query>> "
+	continuePrompt = "csv_query-> "
+)
+
+// historyFile is the name of the file in the home directory keeping the statements entered.
+const historyFile = ".csv_query_history"
+
+// repl executes the statements entered on the terminal until the end of input,
+// a second Ctrl-C in a row or SIGTERM. A statement may span lines and ends with ';',
+// a meta-command ends at the line break. Ctrl-C discards the statement being entered.
+func (s *session) repl(ctx context.Context, in *os.File) {
+	var pending string
+	readLine, history, done := s.lineReader(in, func(line string, pos int) (int, []string) {
+		start, candidates := s.complete(pending+line, len(pending)+pos)
+		return start - len(pending), candidates
+	})
+	defer done()
+	prompts, inputs := readInputs(readLine)
+	defer close(prompts)
+	var (
+		reading     bool
+		interrupted bool
+	)
+	for {
+		p := prompt
+		if strings.TrimSpace(pending) != "" {
+			p = continuePrompt
+		}
+		if !reading {
+			prompts <- p
+			reading = true
+		}
+		var (
+			line string
+			err  error
+		)
+		select {
+		case <-ctx.Done():
+			fmt.Println()
+			return
+		case <-s.interrupts:
+			// the terminal discards the line typed, the prompt is shown again
+			fmt.Print("\n" + prompt)
+			err = readline.ErrInterrupt
+		case in := <-inputs:
+			line, err, reading = in.line, in.err, false
+		}
+		if err == readline.ErrInterrupt {
+			if interrupted {
+				return
+			}
+			pending, interrupted = "", true
+			continue
+		}
+		if err != nil {
+			return
+		}
+		interrupted = false
+		stmts, rest := csv.SplitScript(pending + line + "\n")
+		if pending = rest; strings.TrimSpace(rest) == "" {
+			pending = ""
+		}
+		for _, stmt := range stmts {
+			if err = history.Add(historyLine(stmt)); err != nil {
+				s.logger.Error(fmt.Sprintf("history: %v", err))
+			}
+			if err = s.execute(ctx, stmt); errors.Is(err, errQuit) {
+				return
+			} else if err != nil {
+				s.fail(err)
+			}
+		}
+	}
+}
+
+// historyLine is the statement as it is kept in the history.
+func historyLine(stmt string) string {
+	if isMetaCommand(stmt) {
+		return stmt
+	}
+	return stmt + ";"
+}
+
+// lineReader returns the function reading a line and the history of the REPL.
+// On a terminal the line is edited with the history and the completion, otherwise
+// it is read as is. done restores the terminal.
+func (s *session) lineReader(in *os.File, complete readline.Completer) (
+	readLine func(prompt string) (string, error), history *readline.History, done func(),
+) {
+	path := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		path = filepath.Join(home, historyFile)
+	}
+	history, err := readline.OpenHistory(path, readline.DefaultHistorySize)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("history: %v", err))
+		history, _ = readline.OpenHistory("", readline.DefaultHistorySize)
+	}
+	fd := int(in.Fd())
+	if readline.IsTerminal(fd) {
+		if restore, err := readline.MakeRaw(fd); err == nil {
+			restore()
+			editor := readline.New(in, os.Stdout)
+			editor.History, editor.Complete = history, complete
+			readLine = func(prompt string) (string, error) {
+				// the terminal is raw only while the line is edited, so the output
+				// of queries and Ctrl-C during them work as usual
+				restoreRaw, err := readline.MakeRaw(fd)
+				if err != nil {
+					return "", err
+				}
+				defer restoreRaw()
+				return editor.ReadLine(prompt)
+			}
+			return readLine, history, func() { restore() }
+		}
+	}
+	sc := bufio.NewScanner(in)
+	readLine = func(prompt string) (string, error) {
+		fmt.Print(prompt)
+		if sc.Scan() {
+			return sc.Text(), nil
+		}
+		fmt.Println()
+		if err := sc.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return readLine, history, func() {}
+}
+
+// input is a line read or the error.
+type input struct {
+	line string
+	err  error
+}
+
+// readInputs reads a line with each prompt sent to prompts and passes it to inputs.
+// The lines are read in a goroutine, so the REPL is not blocked by the terminal.
+func readInputs(readLine func(prompt string) (string, error)) (prompts chan<- string, inputs <-chan input) {
+	promptc := make(chan string)
+	inputc := make(chan input, 1)
+	go func() {
+		for p := range promptc {
+			line, err := readLine(p)
+			inputc <- input{line, err}
+		}
+	}()
+	return promptc, inputc
+}
+
+// execute runs a meta-command or a query.
+func (s *session) execute(ctx context.Context, line string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("interrupted: %w", err)
+	}
+	s.logger.Info(line)
+	if isMetaCommand(line) {
+		return s.metaCommand(ctx, line)
+	}
+	start := time.Now()
+	err := s.query(ctx, line)
+	if s.timing {
+		fmt.Fprintf(os.Stderr, "time: %v\n", time.Since(start).Round(time.Microsecond))
+	}
+	return err
+}
+
+// query executes the query and writes its result.
+func (s *session) query(ctxParent context.Context, query string) error {
+	config := s.config
+	stmt, err := csv.ParseStatement(query)
+	if err != nil {
+		var syntaxErr *csv.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			fmt.Fprintln(os.Stderr, syntaxErr.Caret(query))
+		}
+		return err
+	}
+
+	head, tables, err := queryHead(config, stmt)
+	if err != nil {
+		return err
+	}
+
+	q, err := csv.Prepare(stmt, &head)
+	if err != nil {
+		return err
+	}
+
+	res, err := newResult(q, config, s.out)
+	if err != nil {
+		return err
+	}
+	defer res.close()
+
+	// a query without a timeout runs until it ends or is cancelled
+	ctx, cancel := context.WithCancel(ctxParent)
+	if s.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctxParent, s.timeout)
+	}
+	defer cancel()
+	// Ctrl-C cancels the query
+	s.running(cancel)
+	defer s.running(nil)
+	// scanCtx stops reading the file when LIMIT rows are printed or a row fails
+	scanCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p := newPipeline(scanCtx, workers)
+	if len(tables) > 1 {
+		joiner, err := csv.NewJoiner(q, &tables[0], &tables[1], csv.JoinOptions{
+			Reader: config.readerOptions(),
+			Sort:   csv.SortOptions{Memory: config.SortMemory, TempDir: config.TempDir},
+		})
+		if err != nil {
+			return err
+		}
+		s.logger.Info(fmt.Sprintf("join strategy: %s", joiner.Strategy()))
+		go joinReader(p, joiner)
+	} else if offsets, ok := q.Plan(tableIndexes(config, s.logger, head.Path)); ok {
+		go offsetReader(p, head.Path, config.readerOptions(), offsets)
+	} else {
+		go fileReader(p, head.Path, config.readerOptions(), config.ChunkSize)
+	}
+	p.run(workers, q, res, config.readerOptions())
+	failure := p.write(res, stop)
+	if ctx.Err() == nil && failure == nil {
+		failure = res.flush(ctx)
+	}
+	if err = s.stopped(ctxParent, ctx, p.processed); err != nil {
+		return err
+	}
+	if failure != nil {
+		return failure
+	}
+	if res.target != "" {
+		fmt.Fprintf(os.Stderr, "result written to %s\n", res.target)
+	}
+	return nil
+}
+
+// stopped returns the reason the query stopped before its end: the timeout,
+// Ctrl-C or the end of the session. processed is the number of rows read by then.
+func (s *session) stopped(ctxParent, ctx context.Context, processed int64) error {
+	err := ctx.Err()
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("query timed out after %v: %w", s.timeout, err)
+	case ctxParent.Err() != nil:
+		return fmt.Errorf("query interrupted: %w", err)
+	default:
+		return fmt.Errorf("query cancelled after %d rows processed: %w", processed, err)
+	}
+}
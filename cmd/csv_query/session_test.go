@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockedWriter blocks the first write until release is closed,
+// writing is closed when it starts.
+type blockedWriter struct {
+	once    sync.Once
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockedWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.writing)
+		<-w.release
+	})
+	return len(p), nil
+}
+
+func TestCancelQuery(t *testing.T) {
+	s, _, _ := newTestSession(t)
+	var b strings.Builder
+	b.WriteString("id,name\n")
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&b, "%d,name %d\n", i, i)
+	}
+	assert.NoError(t, os.WriteFile(s.config.Head.Path, []byte(b.String()), 0o600))
+
+	// Ctrl-C out of a query and out of the REPL is not taken by the session
+	assert.False(t, s.interrupt())
+
+	w := &blockedWriter{writing: make(chan struct{}), release: make(chan struct{})}
+	s.out = w
+	ctx := context.Background()
+	done := make(chan error)
+	go func() { done <- s.execute(ctx, "SELECT id, name") }()
+	<-w.writing
+	assert.True(t, s.interrupt())
+	// a second Ctrl-C before the query stops ends the session
+	assert.False(t, s.interrupt())
+	close(w.release)
+	err := <-done
+	assert.True(t, errors.Is(err, context.Canceled), err)
+	assert.True(t, err != nil && strings.Contains(err.Error(), "cancelled"), err)
+
+	// the session goes on with the next query
+	var out bytes.Buffer
+	s.out = &out
+	assert.NoError(t, s.execute(ctx, "SELECT count(*)"))
+	assert.Equal(t, "COUNT(*)\n20000\n", out.String())
+	assert.False(t, s.interrupt())
+
+	// at the prompt of the REPL Ctrl-C goes to the REPL
+	s.interrupts = make(chan struct{}, 1)
+	assert.True(t, s.interrupt())
+	assert.Len(t, s.interrupts, 1)
+}
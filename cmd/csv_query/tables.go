@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+)
+
+// inferred caches schemas guessed for files without configured fields.
+var inferred = map[string][]csv.Field{}
+
+// tableHead returns the head of the table named in FROM: a table from [tables]
+// or a file path. Without FROM it is the [head] table.
+func tableHead(config *Config, ref *csv.TableRef) (csv.Head, error) {
+	head, ok := config.Head, true
+	if ref != nil {
+		if head, ok = lookupTable(config, ref.Name); !ok {
+			if _, err := os.Stat(ref.Name); err != nil {
+				return head, fmt.Errorf("unknown table %q: %w", ref.Name, err)
+			}
+			head = csv.Head{Path: ref.Name, Strict: config.Head.Strict, IgnoreCase: config.Head.IgnoreCase}
+		}
+	}
+	if head.Fields != nil {
+		return head, nil
+	}
+	fields, ok := inferred[head.Path]
+	if !ok {
+		var err error
+		if fields, err = inferSchema(config, head.Path); err != nil {
+			return head, err
+		}
+		inferred[head.Path] = fields
+	}
+	head.Fields = fields
+	return head, nil
+}
+
+func lookupTable(config *Config, name string) (csv.Head, bool) {
+	for tableName, head := range config.Tables {
+		if strings.EqualFold(tableName, name) {
+			return head, true
+		}
+	}
+	return csv.Head{}, false
+}
+
+// fileHead reads the header of the table file and applies the schema of the table to it.
+func fileHead(config *Config, table csv.Head) (csv.Head, error) {
+	file, err := os.Open(table.Path)
+	if err != nil {
+		return table, fmt.Errorf("file open error: %w", err)
+	}
+	defer file.Close()
+	reader, err := csv.NewReader(file, config.readerOptions())
+	if err != nil {
+		return table, err
+	}
+	header, err := reader.Read()
+	if err != nil && err != io.EOF {
+		return table, fmt.Errorf("%s: %w", table.Path, err)
+	}
+	head := table
+	head.Fields = csv.ApplySchema(csv.NewFields(header), table.Fields)
+	return head, nil
+}
+
+// queryHead returns the head of the rows read by the statement: the fields of the
+// FROM table qualified by its name or alias followed by the fields of the JOIN table.
+// tables are the heads of the tables themselves.
+func queryHead(config *Config, stmt *csv.Statement) (csv.Head, []csv.Head, error) {
+	refs := []*csv.TableRef{stmt.From}
+	for _, join := range stmt.Joins {
+		refs = append(refs, join.Table)
+	}
+	var tables []csv.Head
+	for _, ref := range refs {
+		table, err := tableHead(config, ref)
+		if err != nil {
+			return table, nil, err
+		}
+		head, err := fileHead(config, table)
+		if err != nil {
+			return head, nil, err
+		}
+		if ref != nil {
+			head.Qualify(ref.Qualifier())
+		}
+		tables = append(tables, head)
+	}
+	head := tables[0]
+	for i := 1; i < len(tables); i++ {
+		head = *csv.JoinHeads(&head, &tables[i])
+	}
+	return head, tables, nil
+}
+
+// inferSchema guesses field types of the file.
+func inferSchema(config *Config, path string) ([]csv.Field, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("file open error: %w", err)
+	}
+	defer file.Close()
+	return csv.InferSchema(file, csv.InferOptions{ReaderOptions: config.readerOptions(), Rows: config.InferRows})
+}
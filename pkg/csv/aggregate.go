@@ -0,0 +1,254 @@
+package csv
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// aggregates are the names of aggregate functions.
+var aggregates = map[string]bool{"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true}
+
+// AggregateExpr is an aggregate function of the rows of a group,
+// Arg is nil for COUNT(*).
+type AggregateExpr struct {
+	Name     string
+	Arg      Expr
+	Distinct bool
+	Offset   int
+	// slot is the index of the result in Row.aggs
+	slot int
+}
+
+func (e *AggregateExpr) Pos() int { return e.Offset }
+
+func (e *AggregateExpr) String() string {
+	switch {
+	case e.Arg == nil:
+		return e.Name + "(*)"
+	case e.Distinct:
+		return e.Name + "(DISTINCT " + e.Arg.String() + ")"
+	default:
+		return e.Name + "(" + e.Arg.String() + ")"
+	}
+}
+
+// eval returns the result of the aggregate for the group of the row.
+func (e *AggregateExpr) eval(row *Row) (Value, error) {
+	if e.slot >= len(row.aggs) {
+		return Null, fmt.Errorf("aggregate %s at position %d is used outside of a group", e, e.Offset)
+	}
+	return row.aggs[e.slot], nil
+}
+
+// aggregateType returns the type of the result of the aggregate.
+func aggregateType(e *AggregateExpr) Type {
+	switch e.Name {
+	case "COUNT":
+		return TypeInt
+	case "AVG":
+		return TypeFloat
+	case "SUM":
+		if exprType(e.Arg) == TypeInt {
+			return TypeInt
+		}
+		return TypeFloat
+	default:
+		return exprType(e.Arg)
+	}
+}
+
+// hasAggregate reports whether the expression contains an aggregate function.
+func hasAggregate(e Expr) bool {
+	found := false
+	_ = walk(e, func(e Expr) error {
+		if _, ok := e.(*AggregateExpr); ok {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// accumulator computes an aggregate over the values added, NULLs are skipped.
+type accumulator struct {
+	expr     *AggregateExpr
+	count    int64
+	sum      Value
+	extreme  Value
+	distinct map[hashKey]bool
+}
+
+func newAccumulator(e *AggregateExpr) *accumulator {
+	acc := &accumulator{expr: e, sum: Null, extreme: Null}
+	if e.Distinct {
+		acc.distinct = map[hashKey]bool{}
+	}
+	return acc
+}
+
+func (acc *accumulator) add(row *Row) error {
+	e := acc.expr
+	if e.Arg == nil {
+		acc.count++
+		return nil
+	}
+	v, err := e.Arg.eval(row)
+	if err != nil || v.IsNull() {
+		return err
+	}
+	if acc.distinct != nil {
+		k := newHashKey(v)
+		if acc.distinct[k] {
+			return nil
+		}
+		acc.distinct[k] = true
+	}
+	acc.count++
+	switch e.Name {
+	case "SUM", "AVG":
+		if acc.sum, err = addNumbers(acc.sum, v); err != nil {
+			return fmt.Errorf("%s: %w", e, err)
+		}
+	case "MIN":
+		if acc.extreme.IsNull() || orderValues(v, acc.extreme) < 0 {
+			acc.extreme = v
+		}
+	case "MAX":
+		if acc.extreme.IsNull() || orderValues(v, acc.extreme) > 0 {
+			acc.extreme = v
+		}
+	}
+	return nil
+}
+
+func (acc *accumulator) result() Value {
+	switch acc.expr.Name {
+	case "COUNT":
+		return IntValue(acc.count)
+	case "SUM":
+		return acc.sum
+	case "AVG":
+		if acc.count == 0 {
+			return Null
+		}
+		f, _ := acc.sum.number()
+		return FloatValue(f / float64(acc.count))
+	default:
+		return acc.extreme
+	}
+}
+
+// addNumbers adds v to the sum, ints are summed exactly until they overflow.
+func addNumbers(sum, v Value) (Value, error) {
+	if v.Type == TypeInt && (sum.IsNull() || sum.Type == TypeInt) {
+		if sum.IsNull() {
+			return v, nil
+		}
+		if s := sum.Int + v.Int; (s > sum.Int) == (v.Int > 0) {
+			return IntValue(s), nil
+		}
+	}
+	f, ok := v.number()
+	if !ok {
+		return Null, fmt.Errorf("%q is not a number", v.String())
+	}
+	s, _ := sum.number()
+	if math.IsInf(s+f, 0) {
+		return Null, fmt.Errorf("sum is out of range")
+	}
+	return FloatValue(s + f), nil
+}
+
+// group is a set of rows with equal GROUP BY keys, row is the first of them.
+type group struct {
+	row  *Row
+	accs []*accumulator
+}
+
+// Aggregator groups rows of a query with GROUP BY or aggregate functions
+// and computes the aggregates as rows are added.
+type Aggregator struct {
+	query  *Query
+	groups map[string]*group
+	order  []*group
+}
+
+// NewAggregator returns an aggregator of the rows of q.
+func NewAggregator(q *Query) *Aggregator {
+	return &Aggregator{query: q, groups: map[string]*group{}}
+}
+
+// Add adds a row matching WHERE to its group.
+func (a *Aggregator) Add(row *Row) error {
+	key, err := a.groupKey(row)
+	if err != nil {
+		return err
+	}
+	g, ok := a.groups[key]
+	if !ok {
+		g = a.newGroup(&Row{Head: row.Head, Values: append([]string(nil), row.Values...)})
+		a.groups[key] = g
+		a.order = append(a.order, g)
+	}
+	for _, acc := range g.accs {
+		if err := acc.add(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Aggregator) newGroup(row *Row) *group {
+	g := &group{row: row}
+	for _, e := range a.query.aggs {
+		g.accs = append(g.accs, newAccumulator(e))
+	}
+	return g
+}
+
+// groupKey encodes the values of GROUP BY keys of the row.
+func (a *Aggregator) groupKey(row *Row) (string, error) {
+	var b strings.Builder
+	for _, e := range a.query.groupBy {
+		v, err := e.eval(row)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%v\x00", newHashKey(v))
+	}
+	return b.String(), nil
+}
+
+// Each calls fn for the groups satisfying HAVING in the order they were met
+// until fn returns an error. Without GROUP BY there is exactly one group.
+// The row passed to fn evaluates aggregates of the group.
+func (a *Aggregator) Each(fn func(row *Row, values []Value) error) error {
+	groups := a.order
+	if len(groups) == 0 && len(a.query.groupBy) == 0 {
+		groups = []*group{a.newGroup(a.query.Head.NewRow())}
+	}
+	for _, g := range groups {
+		g.row.aggs = make([]Value, len(g.accs))
+		for i, acc := range g.accs {
+			g.row.aggs[i] = acc.result()
+		}
+		if a.query.having != nil {
+			ok, err := a.query.having(g.row)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+		values, err := a.query.Project(g.row)
+		if err != nil {
+			return err
+		}
+		if err = fn(g.row, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package csv_test
+
+import (
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+var aggregateRecords = [][]string{
+	{"Asia", "AFG", "10", "1.5"},
+	{"Europe", "RUS", "20", ""},
+	{"Asia", "CHN", "", "2.5"},
+	{"Asia", "AFG", "5", "0.5"},
+	{"Africa", "EGY", "1", ""},
+}
+
+func aggregate(t *testing.T, query string) [][]csv.Value {
+	t.Helper()
+	head := &csv.Head{Fields: []csv.Field{
+		{Name: "continent", Type: csv.TypeString},
+		{Name: "iso_code", Type: csv.TypeString},
+		{Name: "cases", Type: csv.TypeInt},
+		{Name: "rate", Type: csv.TypeFloat},
+	}}
+	stmt, err := csv.ParseStatement(query)
+	if !assert.NoError(t, err, query) {
+		return nil
+	}
+	q, err := csv.Prepare(stmt, head)
+	if !assert.NoError(t, err, query) {
+		return nil
+	}
+	assert.True(t, q.Grouped(), query)
+	agg := csv.NewAggregator(q)
+	for _, record := range aggregateRecords {
+		row := head.NewRow()
+		row.Values = record
+		ok, err := q.Match(row)
+		if assert.NoError(t, err, query) && ok {
+			assert.NoError(t, agg.Add(row), query)
+		}
+	}
+	var rows [][]csv.Value
+	assert.NoError(t, agg.Each(func(row *csv.Row, values []csv.Value) error {
+		rows = append(rows, values)
+		return nil
+	}), query)
+	return rows
+}
+
+func TestAggregator(t *testing.T) {
+	str, i, f := csv.StringValue, csv.IntValue, csv.FloatValue
+	tests := []struct {
+		query string
+		want  [][]csv.Value
+	}{
+		{"SELECT continent, COUNT(*), COUNT(cases), SUM(cases), MIN(iso_code), MAX(rate) GROUP BY continent", [][]csv.Value{
+			{str("Asia"), i(3), i(2), i(15), str("AFG"), f(2.5)},
+			{str("Europe"), i(1), i(1), i(20), str("RUS"), csv.Null},
+			{str("Africa"), i(1), i(1), i(1), str("EGY"), csv.Null},
+		}},
+		{"SELECT COUNT(DISTINCT iso_code), AVG(cases), SUM(rate), count(*) WHERE continent = 'Asia'", [][]csv.Value{
+			{i(2), f(7.5), f(4.5), i(3)},
+		}},
+		{"SELECT COUNT(*), SUM(cases), AVG(rate) WHERE continent = 'Oceania'", [][]csv.Value{
+			{i(0), csv.Null, csv.Null},
+		}},
+		{"SELECT continent GROUP BY continent WHERE cases > 0 HAVING SUM(cases) >= 15", nil},
+		{"SELECT lower(continent) AS c, SUM(DISTINCT cases) GROUP BY lower(continent) HAVING COUNT(*) > 1", [][]csv.Value{
+			{str("asia"), i(15)},
+		}},
+		{"SELECT iso_code, COUNT(*) WHERE cases > 0 GROUP BY iso_code, continent HAVING MAX(cases) >= 10", [][]csv.Value{
+			{str("AFG"), i(2)}, {str("RUS"), i(1)},
+		}},
+		{"SELECT continent GROUP BY continent WHERE continent = 'Africa'", nil},
+	}
+	for _, tt := range tests {
+		if tt.want == nil {
+			_, err := csv.ParseStatement(tt.query)
+			assert.Error(t, err, tt.query)
+			continue
+		}
+		assert.Equal(t, tt.want, aggregate(t, tt.query), tt.query)
+	}
+
+	head := &csv.Head{Fields: []csv.Field{{Name: "a", Type: csv.TypeInt}, {Name: "b", Type: csv.TypeInt}}}
+	for _, query := range []string{
+		"SELECT a, COUNT(*)", "SELECT * GROUP BY a", "SELECT b GROUP BY a", "SELECT SUM(COUNT(*))",
+		"COUNT(*) > 1", "SELECT a GROUP BY SUM(b)", "SELECT a GROUP BY a ORDER BY b",
+	} {
+		stmt, err := csv.ParseStatement(query)
+		if assert.NoError(t, err, query) {
+			_, err = csv.Prepare(stmt, head)
+			assert.Error(t, err, query)
+		}
+	}
+}
+
+func TestAggregateSumOverflow(t *testing.T) {
+	head := &csv.Head{Fields: []csv.Field{{Name: "a", Type: csv.TypeInt}}}
+	stmt, _ := csv.ParseStatement("SELECT SUM(a)")
+	q, err := csv.Prepare(stmt, head)
+	if !assert.NoError(t, err) {
+		return
+	}
+	agg := csv.NewAggregator(q)
+	for _, v := range []string{"9223372036854775807", "1"} {
+		row := head.NewRow()
+		row.Values = []string{v}
+		assert.NoError(t, agg.Add(row))
+	}
+	assert.NoError(t, agg.Each(func(row *csv.Row, values []csv.Value) error {
+		assert.Equal(t, csv.TypeFloat, values[0].Type)
+		assert.InDelta(t, 9.223372036854775808e18, values[0].Float, 1e4)
+		return nil
+	}))
+}
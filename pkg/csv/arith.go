@@ -0,0 +1,155 @@
+package csv
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// arithmeticOps are the binary operators computing numbers.
+var arithmeticOps = map[string]bool{"+": true, "-": true, "*": true, "/": true, "DIV": true, "MOD": true}
+
+// arithmetic evaluates + - * / DIV MOD. Ints give ints while they fit into int64,
+// / always gives a float, DIV an int truncated toward zero. Division by zero
+// is NULL, or an error if the head is strict.
+func (e *BinaryExpr) arithmetic(row *Row) (Value, error) {
+	l, err := e.Left.eval(row)
+	if err != nil {
+		return Null, err
+	}
+	r, err := e.Right.eval(row)
+	if err != nil {
+		return Null, err
+	}
+	if l, err = numeric(l); err != nil {
+		return Null, fmt.Errorf("operator %s at position %d: %w", e.Op, e.Offset, err)
+	}
+	if r, err = numeric(r); err != nil {
+		return Null, fmt.Errorf("operator %s at position %d: %w", e.Op, e.Offset, err)
+	}
+	if l.IsNull() || r.IsNull() {
+		return Null, nil
+	}
+	if isZero(r) && (e.Op == "/" || e.Op == "DIV" || e.Op == "MOD") {
+		if e.strict {
+			return Null, fmt.Errorf("division by zero at position %d", e.Offset)
+		}
+		return Null, nil
+	}
+	if l.Type == TypeInt && r.Type == TypeInt {
+		if v, ok := intArithmetic(e.Op, l.Int, r.Int); ok {
+			return v, nil
+		}
+	}
+	x, _ := l.number()
+	y, _ := r.number()
+	return floatArithmetic(e.Op, x, y)
+}
+
+// intArithmetic computes the operator over ints, ok is false if the result overflows.
+func intArithmetic(op string, x, y int64) (Value, bool) {
+	switch op {
+	case "+":
+		s := x + y
+		return IntValue(s), (s > x) == (y > 0)
+	case "-":
+		d := x - y
+		return IntValue(d), (d < x) == (y > 0)
+	case "*":
+		if x == 0 || y == 0 {
+			return IntValue(0), true
+		}
+		p := x * y
+		return IntValue(p), p/y == x && !(x == -1 && y == math.MinInt64) && !(y == -1 && x == math.MinInt64)
+	case "DIV":
+		return IntValue(x / y), !(x == math.MinInt64 && y == -1)
+	case "MOD":
+		return IntValue(x % y), true
+	default:
+		return Null, false
+	}
+}
+
+func floatArithmetic(op string, x, y float64) (Value, error) {
+	var f float64
+	switch op {
+	case "+":
+		f = x + y
+	case "-":
+		f = x - y
+	case "*":
+		f = x * y
+	case "/":
+		f = x / y
+	case "DIV":
+		f = math.Trunc(x / y)
+		if f < math.MinInt64 || f >= math.MaxInt64 {
+			return Null, fmt.Errorf("%v DIV %v is out of range", x, y)
+		}
+		return IntValue(int64(f)), nil
+	case "MOD":
+		f = math.Mod(x, y)
+	default:
+		return Null, fmt.Errorf("unknown operator %s", op)
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return Null, fmt.Errorf("%v %s %v is out of range", x, op, y)
+	}
+	return FloatValue(f), nil
+}
+
+// negate evaluates unary minus.
+func negate(v Value) (Value, error) {
+	v, err := numeric(v)
+	if err != nil || v.IsNull() {
+		return Null, err
+	}
+	if v.Type == TypeInt && v.Int != math.MinInt64 {
+		return IntValue(-v.Int), nil
+	}
+	f, _ := v.number()
+	return FloatValue(-f), nil
+}
+
+// numeric returns an int or a float value of a number or a numeric string,
+// a blank string is NULL.
+func numeric(v Value) (Value, error) {
+	switch v.Type {
+	case TypeNull, TypeInt, TypeFloat:
+		return v, nil
+	case TypeString:
+		s := strings.TrimSpace(v.Str)
+		if s == "" {
+			return Null, nil
+		}
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return IntValue(i), nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return FloatValue(f), nil
+		}
+	}
+	return Null, fmt.Errorf("%q is not a number", v.String())
+}
+
+func isZero(v Value) bool {
+	f, _ := v.number()
+	return f == 0
+}
+
+// arithmeticType returns the type of the result of the operator, TypeNull if it is known only after evaluation.
+func arithmeticType(op string, l, r Type) Type {
+	switch {
+	case op == "/":
+		return TypeFloat
+	case op == "DIV":
+		return TypeInt
+	case l == TypeInt && r == TypeInt:
+		return TypeInt
+	case (l == TypeInt || l == TypeFloat) && (r == TypeInt || r == TypeFloat):
+		return TypeFloat
+	default:
+		return TypeNull
+	}
+}
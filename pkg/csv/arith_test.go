@@ -0,0 +1,119 @@
+package csv_test
+
+import (
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArithmetic(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{"a + b * c > 1 AND d", "(((a + (b * c)) > 1) AND d)"},
+		{"new_cases / population > 0.001", "((new_cases / population) > 0.001)"},
+		{"a - b - c = -1", "(((a - b) - c) = -1)"},
+		{"-a * 2 DIV 3 mod 4 % 5", "(((((-a) * 2) DIV 3) MOD 4) MOD 5)"},
+		{"(a + b) * -(c - 1) IN (1, 2 + 3)", "(((a + b) * (-(c - 1))) IN (1, (2 + 3)))"},
+		{"a < - 9223372036854775808", "(a < -9223372036854775808)"},
+	}
+	for _, tt := range tests {
+		got, err := csv.Parse(tt.query)
+		if assert.NoError(t, err, tt.query) {
+			assert.Equal(t, tt.want, got.String(), tt.query)
+		}
+	}
+	for _, query := range []string{"a +", "a * * b", "a DIV", "- ", "a mod = 1"} {
+		_, err := csv.Parse(query)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	head := &csv.Head{Fields: []csv.Field{
+		{Name: "cases", Type: csv.TypeInt},
+		{Name: "population", Type: csv.TypeInt},
+		{Name: "rate", Type: csv.TypeFloat},
+		{Name: "note", Type: csv.TypeString},
+	}}
+	values := []string{"30", "1000", "0.5", "7"}
+	tests := []struct {
+		query string
+		want  csv.Value
+	}{
+		{"SELECT cases + population * 2", csv.IntValue(2030)},
+		{"SELECT (cases + population) * 2", csv.IntValue(2060)},
+		{"SELECT cases / population", csv.FloatValue(0.03)},
+		{"SELECT population DIV cases, population MOD cases", csv.IntValue(33)},
+		{"SELECT -cases - -rate", csv.FloatValue(-29.5)},
+		{"SELECT note * 2 + 1", csv.IntValue(15)},
+		{"SELECT rate MOD 0.2", csv.FloatValue(0.09999999999999998)},
+		{"SELECT cases / 0", csv.Null},
+		{"SELECT cases MOD (population - 1000)", csv.Null},
+		{"SELECT cases + NULL", csv.Null},
+		{"SELECT 9223372036854775807 + cases", csv.FloatValue(9223372036854775837)},
+	}
+	for _, tt := range tests {
+		stmt, err := csv.ParseStatement(tt.query)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		q, err := csv.Prepare(stmt, head)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		row := head.NewRow()
+		row.Values = values
+		got, err := q.Project(row)
+		if assert.NoError(t, err, tt.query) {
+			assert.Equal(t, tt.want, got[0], tt.query)
+		}
+	}
+
+	pred, err := csv.Compile("cases / population > 0.01 AND -rate < 0", head)
+	if assert.NoError(t, err) {
+		row := head.NewRow()
+		row.Values = values
+		ok, err := pred(row)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+}
+
+func TestArithmeticErrors(t *testing.T) {
+	fields := []csv.Field{{Name: "cases", Type: csv.TypeInt}, {Name: "note", Type: csv.TypeString}}
+	strict := &csv.Head{Fields: fields, Strict: true}
+	lenient := &csv.Head{Fields: fields}
+	tests := []struct {
+		query string
+		head  *csv.Head
+		err   string
+	}{
+		{"SELECT cases / 0", strict, "division by zero at position 13"},
+		{"SELECT cases DIV (cases - 30)", strict, "division by zero"},
+		{"SELECT cases / 0", lenient, ""},
+		{"SELECT note + 1", lenient, `operator + at position 12: "abc" is not a number`},
+		{"SELECT -note", lenient, `"abc" is not a number`},
+		{"SELECT -9223372036854775808 DIV -1", lenient, "out of range"},
+		{"SELECT 1e308 * 10", lenient, "out of range"},
+	}
+	for _, tt := range tests {
+		stmt, err := csv.ParseStatement(tt.query)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		q, err := csv.Prepare(stmt, tt.head)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		row := tt.head.NewRow()
+		row.Values = []string{"30", "abc"}
+		_, err = q.Project(row)
+		if tt.err == "" {
+			assert.NoError(t, err, tt.query)
+		} else if assert.Error(t, err, tt.query) {
+			assert.Contains(t, err.Error(), tt.err, tt.query)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package csv
+
+import (
+	"sort"
+	"strings"
+)
+
+// btreeDegree is the minimum degree of the B-tree: a node holds
+// from btreeDegree-1 to 2*btreeDegree-1 keys.
+const btreeDegree = 32
+
+type btreeItem struct {
+	key     Value
+	offsets []int64
+}
+
+type btreeNode struct {
+	items    []btreeItem
+	children []*btreeNode
+}
+
+// BTree maps keys of one type to offsets of the records having them.
+type BTree struct {
+	root *btreeNode
+	keys int
+}
+
+// Bound is an end of a key range.
+type Bound struct {
+	Key       Value
+	Inclusive bool
+}
+
+// cmpKeys orders keys of the same type, strings are always compared as text.
+func cmpKeys(a, b Value) int {
+	if a.Type == TypeString && b.Type == TypeString {
+		return strings.Compare(a.Str, b.Str)
+	}
+	res, _ := compare(a, b)
+	return res
+}
+
+// Len returns the number of distinct keys.
+func (t *BTree) Len() int {
+	return t.keys
+}
+
+// Insert adds offset to the key.
+func (t *BTree) Insert(key Value, offset int64) {
+	if t.root == nil {
+		t.root = &btreeNode{}
+	}
+	if len(t.root.items) == 2*btreeDegree-1 {
+		old := t.root
+		t.root = &btreeNode{children: []*btreeNode{old}}
+		t.root.splitChild(0)
+	}
+	if t.root.insertNonFull(key, offset) {
+		t.keys++
+	}
+}
+
+func (n *btreeNode) search(key Value) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool { return cmpKeys(n.items[i].key, key) >= 0 })
+	return i, i < len(n.items) && cmpKeys(n.items[i].key, key) == 0
+}
+
+// splitChild splits the full child i moving its middle item up to n.
+func (n *btreeNode) splitChild(i int) {
+	child := n.children[i]
+	mid := child.items[btreeDegree-1]
+	right := &btreeNode{items: append([]btreeItem(nil), child.items[btreeDegree:]...)}
+	if len(child.children) > 0 {
+		right.children = append([]*btreeNode(nil), child.children[btreeDegree:]...)
+		child.children = child.children[:btreeDegree]
+	}
+	child.items = child.items[:btreeDegree-1]
+
+	n.items = append(n.items, btreeItem{})
+	copy(n.items[i+1:], n.items[i:])
+	n.items[i] = mid
+	n.children = append(n.children, nil)
+	copy(n.children[i+2:], n.children[i+1:])
+	n.children[i+1] = right
+}
+
+// insertNonFull adds offset to the key in the subtree, it reports whether the key is new.
+func (n *btreeNode) insertNonFull(key Value, offset int64) bool {
+	for {
+		i, found := n.search(key)
+		if found {
+			n.items[i].offsets = append(n.items[i].offsets, offset)
+			return false
+		}
+		if len(n.children) == 0 {
+			n.items = append(n.items, btreeItem{})
+			copy(n.items[i+1:], n.items[i:])
+			n.items[i] = btreeItem{key: key, offsets: []int64{offset}}
+			return true
+		}
+		if len(n.children[i].items) == 2*btreeDegree-1 {
+			n.splitChild(i)
+			switch c := cmpKeys(key, n.items[i].key); {
+			case c == 0:
+				n.items[i].offsets = append(n.items[i].offsets, offset)
+				return false
+			case c > 0:
+				i++
+			}
+		}
+		n = n.children[i]
+	}
+}
+
+// Ascend calls fn for keys between lo and hi in ascending order until fn returns false.
+// A nil Bound is unlimited.
+func (t *BTree) Ascend(lo, hi *Bound, fn func(key Value, offsets []int64) bool) {
+	if t.root != nil {
+		t.root.ascend(lo, hi, fn)
+	}
+}
+
+func (n *btreeNode) ascend(lo, hi *Bound, fn func(key Value, offsets []int64) bool) bool {
+	i := 0
+	if lo != nil {
+		i, _ = n.search(lo.Key)
+	}
+	for ; i <= len(n.items); i++ {
+		if len(n.children) > 0 && !n.children[i].ascend(lo, hi, fn) {
+			return false
+		}
+		if i == len(n.items) {
+			break
+		}
+		item := &n.items[i]
+		if hi != nil {
+			if c := cmpKeys(item.key, hi.Key); c > 0 || c == 0 && !hi.Inclusive {
+				return false
+			}
+		}
+		if lo != nil && !lo.Inclusive && cmpKeys(item.key, lo.Key) == 0 {
+			continue
+		}
+		if !fn(item.key, item.offsets) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package csv_test
+
+import (
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBTree(t *testing.T) {
+	var tree csv.BTree
+	for i := 0; i < 1000; i++ {
+		tree.Insert(csv.IntValue(int64(i*7%500)), int64(i))
+	}
+	assert.Equal(t, 500, tree.Len())
+
+	var keys []int64
+	tree.Ascend(nil, nil, func(key csv.Value, offsets []int64) bool {
+		keys = append(keys, key.Int)
+		assert.Len(t, offsets, 2)
+		return true
+	})
+	if assert.Len(t, keys, 500) {
+		for i, key := range keys {
+			assert.Equal(t, int64(i), key)
+		}
+	}
+
+	var got []int64
+	lo, hi := &csv.Bound{Key: csv.IntValue(10)}, &csv.Bound{Key: csv.IntValue(13), Inclusive: true}
+	tree.Ascend(lo, hi, func(key csv.Value, offsets []int64) bool {
+		got = append(got, key.Int)
+		return true
+	})
+	assert.Equal(t, []int64{11, 12, 13}, got)
+
+	got = nil
+	tree.Ascend(&csv.Bound{Key: csv.IntValue(495), Inclusive: true}, nil, func(key csv.Value, offsets []int64) bool {
+		got = append(got, key.Int)
+		return len(got) < 3
+	})
+	assert.Equal(t, []int64{495, 496, 497}, got)
+}
+
+func TestBTreeStrings(t *testing.T) {
+	var tree csv.BTree
+	for i, s := range []string{"b", "10", "9", "a", "b"} {
+		tree.Insert(csv.StringValue(s), int64(i))
+	}
+	var keys []string
+	tree.Ascend(nil, nil, func(key csv.Value, offsets []int64) bool {
+		keys = append(keys, key.Str)
+		return true
+	})
+	assert.Equal(t, []string{"10", "9", "a", "b"}, keys)
+}
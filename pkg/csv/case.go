@@ -0,0 +1,112 @@
+package csv
+
+import "strings"
+
+// CaseExpr is CASE [Operand] WHEN ... THEN ... [ELSE ...] END. Without Operand
+// the conditions of WHEN are tested, otherwise Operand is compared with them.
+// The result of the first match is evaluated, Else or NULL if nothing matches.
+type CaseExpr struct {
+	Operand Expr
+	Whens   []When
+	Else    Expr
+	Offset  int
+	// NoCase makes the comparison with Operand case-insensitive, it is set by bind
+	NoCase bool
+}
+
+// When is a branch of CASE.
+type When struct {
+	Cond, Result Expr
+}
+
+func (e *CaseExpr) Pos() int { return e.Offset }
+
+func (e *CaseExpr) String() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	if e.Operand != nil {
+		b.WriteString(" " + e.Operand.String())
+	}
+	for _, w := range e.Whens {
+		b.WriteString(" WHEN " + w.Cond.String() + " THEN " + w.Result.String())
+	}
+	if e.Else != nil {
+		b.WriteString(" ELSE " + e.Else.String())
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+func (e *CaseExpr) eval(row *Row) (Value, error) {
+	var (
+		operand Value
+		err     error
+	)
+	if e.Operand != nil {
+		if operand, err = e.Operand.eval(row); err != nil {
+			return Null, err
+		}
+	}
+	for _, w := range e.Whens {
+		ok, err := e.matches(row, operand, w.Cond)
+		if err != nil {
+			return Null, err
+		}
+		if ok {
+			return w.Result.eval(row)
+		}
+	}
+	if e.Else == nil {
+		return Null, nil
+	}
+	return e.Else.eval(row)
+}
+
+func (e *CaseExpr) matches(row *Row, operand Value, cond Expr) (bool, error) {
+	if e.Operand == nil {
+		v, err := evalBool(cond, row)
+		return !v.IsNull() && v.Bool, err
+	}
+	v, err := cond.eval(row)
+	if err != nil {
+		return false, err
+	}
+	if e.NoCase {
+		operand, v = foldCase(operand), foldCase(v)
+	}
+	cmp, ok := compare(operand, v)
+	return ok && cmp == 0, nil
+}
+
+// children returns the operand, the conditions, the results and ELSE.
+func (e *CaseExpr) children() []Expr {
+	var exprs []Expr
+	if e.Operand != nil {
+		exprs = append(exprs, e.Operand)
+	}
+	for _, w := range e.Whens {
+		exprs = append(exprs, w.Cond, w.Result)
+	}
+	if e.Else != nil {
+		exprs = append(exprs, e.Else)
+	}
+	return exprs
+}
+
+// resultType returns the type of the results if they agree, TypeNull otherwise.
+func (e *CaseExpr) resultType() Type {
+	results := make([]Expr, 0, len(e.Whens)+1)
+	for _, w := range e.Whens {
+		results = append(results, w.Result)
+	}
+	if e.Else != nil {
+		results = append(results, e.Else)
+	}
+	t := exprType(results[0])
+	for _, r := range results[1:] {
+		if exprType(r) != t {
+			return TypeNull
+		}
+	}
+	return t
+}
@@ -0,0 +1,63 @@
+package csv
+
+import (
+	"fmt"
+	"math"
+)
+
+// CastExpr is CAST(X AS Type). A value that can't be converted is NULL,
+// or an error if the head is strict.
+type CastExpr struct {
+	X      Expr
+	Type   Type
+	Offset int
+	strict bool
+}
+
+func (e *CastExpr) Pos() int { return e.Offset }
+
+func (e *CastExpr) String() string {
+	return "CAST(" + e.X.String() + " AS " + e.Type.String() + ")"
+}
+
+func (e *CastExpr) eval(row *Row) (Value, error) {
+	x, err := e.X.eval(row)
+	if err != nil || x.IsNull() {
+		return Null, err
+	}
+	v, err := cast(x, e.Type)
+	if err != nil && e.strict {
+		return Null, fmt.Errorf("CAST at position %d: %w", e.Offset, err)
+	}
+	return v, nil
+}
+
+// cast converts v to type t: strings are parsed, floats are truncated to ints,
+// bools are 0 and 1 as numbers.
+func cast(v Value, t Type) (Value, error) {
+	switch {
+	case v.Type == t:
+		return v, nil
+	case t == TypeString:
+		return StringValue(v.String()), nil
+	case v.Type == TypeString:
+		return ParseValue(v.Str, t)
+	case v.Type == TypeFloat && t == TypeInt:
+		f := math.Trunc(v.Float)
+		if f < math.MinInt64 || f >= math.MaxInt64 || math.IsNaN(f) {
+			return Null, fmt.Errorf("%v is out of range of int", v.Float)
+		}
+		return IntValue(int64(f)), nil
+	case v.Type == TypeBool && (t == TypeInt || t == TypeFloat):
+		n := int64(0)
+		if v.Bool {
+			n = 1
+		}
+		return coerce(IntValue(n), t)
+	case (v.Type == TypeInt || v.Type == TypeFloat) && t == TypeBool:
+		f, _ := v.number()
+		return BoolValue(f != 0), nil
+	default:
+		return coerce(v, t)
+	}
+}
@@ -0,0 +1,67 @@
+package csv
+
+import (
+	"bytes"
+	"io"
+)
+
+// DefaultChunkSize is the size of a chunk when the size given to NewChunker is 0.
+const DefaultChunkSize = 1 << 20
+
+// Chunk is the text of whole records of a file, Seq numbers the chunks
+// of the file from 0 in the order of the file.
+type Chunk struct {
+	Seq    int64
+	Offset int64
+	Line   int
+	Data   []byte
+}
+
+// Chunker splits the rest of the input of a reader into chunks of whole records
+// without parsing them, so the chunks can be parsed concurrently. Records are
+// split the way the reader reads them, a quoted line break does not end a record.
+type Chunker struct {
+	r    *Reader
+	size int
+	seq  int64
+}
+
+// NewChunker returns a chunker of the records following those already read by r,
+// a chunk holds records while it is smaller than size bytes.
+func NewChunker(r *Reader, size int) *Chunker {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	return &Chunker{r: r, size: size}
+}
+
+// Next returns the next chunk, at the end of input it returns io.EOF.
+func (c *Chunker) Next() (*Chunk, error) {
+	chunk := &Chunk{Seq: c.seq, Offset: c.r.offset, Line: c.r.line}
+	for len(chunk.Data) < c.size {
+		data, err := c.r.readRaw(chunk.Data)
+		chunk.Data = data
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, c.r.wrap(err)
+		}
+	}
+	if len(chunk.Data) == 0 {
+		return nil, io.EOF
+	}
+	c.seq++
+	return chunk, nil
+}
+
+// Reader returns a reader of the records of the chunk in the dialect of opts,
+// its offsets and line numbers are those in the file.
+func (c *Chunk) Reader(opts ReaderOptions) (*Reader, error) {
+	r, err := NewReader(bytes.NewReader(c.Data), opts)
+	if err != nil {
+		return nil, err
+	}
+	r.offset, r.line = c.Offset, c.Line
+	return r, nil
+}
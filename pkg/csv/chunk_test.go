@@ -0,0 +1,111 @@
+package csv_test
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+// readChunks reads the records of the input following the header chunk by chunk.
+func readChunks(t *testing.T, r io.Reader, opts csv.ReaderOptions, size int) ([][]string, []*csv.Chunk, error) {
+	t.Helper()
+	rd, err := csv.NewReader(r, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = rd.Read(); err != nil {
+		return nil, nil, err
+	}
+	chunker := csv.NewChunker(rd, size)
+	var (
+		records [][]string
+		chunks  []*csv.Chunk
+	)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return records, chunks, nil
+		}
+		if err != nil {
+			return records, chunks, err
+		}
+		chunks = append(chunks, chunk)
+		cr, err := chunk.Reader(opts)
+		if err != nil {
+			return records, chunks, err
+		}
+		for {
+			record, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return records, chunks, err
+			}
+			records = append(records, record)
+		}
+	}
+}
+
+func TestChunker(t *testing.T) {
+	tests := []struct {
+		input string
+		opts  csv.ReaderOptions
+	}{
+		{input: "h\na,,\n\n,b,\n"},
+		{input: "h\na;\"b;c\"\n\"x\ny\";z", opts: csv.ReaderOptions{Sep: ";"}},
+		{input: "h\n\"a\\\"b\n\\\\\",c\n\"\\\"\",d\n", opts: csv.ReaderOptions{Escape: `\`}},
+		{input: "h\n\"a\"\"\n,b\",c\n'x',\"\"\"\"\n"},
+		{input: "h\n'a,\nb',c\n", opts: csv.ReaderOptions{Quote: "'"}},
+		{input: "h\na\"b,c\n\"a\"b\",\nc\"\nd,e\n", opts: csv.ReaderOptions{LazyQuotes: true}},
+		{input: "h\r\n\"a\r\nb\",c\r\nd,e\r\n"},
+	}
+	for _, tt := range tests {
+		want, err := readAll(t, strings.NewReader(tt.input), tt.opts)
+		if !assert.NoError(t, err, tt.input) {
+			continue
+		}
+		for size := 0; size <= len(tt.input)+1; size++ {
+			got, chunks, err := readChunks(t, strings.NewReader(tt.input), tt.opts, size)
+			if assert.NoError(t, err, "%q by %d", tt.input, size) {
+				assert.Equal(t, want[1:], got, "%q by %d", tt.input, size)
+			}
+			for i, chunk := range chunks {
+				assert.Equal(t, int64(i), chunk.Seq)
+				assert.Equal(t, tt.input[chunk.Offset:chunk.Offset+int64(len(chunk.Data))], string(chunk.Data))
+			}
+		}
+	}
+}
+
+func TestChunkerErrors(t *testing.T) {
+	for _, size := range []int{1, 8, 1000} {
+		_, _, err := readChunks(t, strings.NewReader("h\na,b\nc,d\"\ne,f\n"), csv.ReaderOptions{}, size)
+		if assert.Error(t, err) {
+			assert.Equal(t, "csv line 3: "+csv.ErrBareQuote.Error(), err.Error(), size)
+		}
+		_, _, err = readChunks(t, strings.NewReader("h\na,b\n\"c,d\ne,f\n"), csv.ReaderOptions{}, size)
+		if assert.Error(t, err) {
+			assert.Equal(t, "csv line 4: "+csv.ErrQuote.Error(), err.Error(), size)
+		}
+	}
+	_, _, err := readChunks(t, strings.NewReader("h\n\"a\nb\nc\nd\ne\"\n"), csv.ReaderOptions{MaxRecordSize: 6}, 0)
+	assert.Error(t, err)
+}
+
+func TestChunkerOWID(t *testing.T) {
+	file, err := os.Open("testdata/owid-covid-sample.csv")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+	records, chunks, err := readChunks(t, file, csv.ReaderOptions{}, 100)
+	assert.NoError(t, err)
+	assert.Len(t, records, 6)
+	assert.True(t, len(chunks) > 1)
+	assert.Equal(t, "units\r\nunclear", records[4][6])
+}
@@ -0,0 +1,256 @@
+package csv
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateUnits are the units of DATE_TRUNC, DATE_ADD and DATE_DIFF.
+var dateUnits = map[string]bool{
+	"year": true, "quarter": true, "month": true, "week": true, "day": true, "hour": true, "minute": true, "second": true,
+}
+
+// dateParts are the fields of EXTRACT and DATE_PART.
+var dateParts = map[string]bool{
+	"year": true, "quarter": true, "month": true, "week": true, "day": true, "hour": true, "minute": true, "second": true,
+	"dow": true, "doy": true, "epoch": true,
+}
+
+// dateArg returns the argument as a date, strings are parsed.
+func dateArg(v Value) (time.Time, error) {
+	d, err := coerce(v, TypeDate)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return d.Time, nil
+}
+
+// unitArg returns the lower-cased unit if it is one of units.
+func unitArg(v Value, units map[string]bool) (string, error) {
+	unit := strings.ToLower(strings.TrimSpace(v.String()))
+	if !units[unit] {
+		return "", fmt.Errorf("unknown unit %q", v.String())
+	}
+	return unit, nil
+}
+
+// truncDate returns the start of the unit containing t, weeks start on Monday.
+func truncDate(t time.Time, unit string) time.Time {
+	y, m, d := t.Date()
+	loc := t.Location()
+	switch unit {
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	case "quarter":
+		return time.Date(y, (m-1)/3*3+1, 1, 0, 0, 0, 0, loc)
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	case "week":
+		return time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	case "hour":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)
+	case "minute":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc)
+	default:
+		return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, loc)
+	}
+}
+
+// addDate adds n units to t. Adding months keeps the day unless the month
+// is shorter: 2020-01-31 plus a month is 2020-02-29.
+func addDate(t time.Time, n int64, unit string) time.Time {
+	months := int64(0)
+	switch unit {
+	case "year":
+		months = 12 * n
+	case "quarter":
+		months = 3 * n
+	case "month":
+		months = n
+	case "week":
+		return t.AddDate(0, 0, int(7*n))
+	case "day":
+		return t.AddDate(0, 0, int(n))
+	case "hour":
+		return t.Add(time.Duration(n) * time.Hour)
+	case "minute":
+		return t.Add(time.Duration(n) * time.Minute)
+	default:
+		return t.Add(time.Duration(n) * time.Second)
+	}
+	y, m, d := t.Date()
+	first := time.Date(y, m, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location()).AddDate(0, int(months), 0)
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1)
+}
+
+// diffDates returns the number of unit boundaries between b and a, negative if a is before b.
+func diffDates(a, b time.Time, unit string) int64 {
+	month := func(t time.Time) int64 { return int64(t.Year())*12 + int64(t.Month()) - 1 }
+	day := func(t time.Time) int64 {
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	}
+	switch unit {
+	case "year":
+		return int64(a.Year() - b.Year())
+	case "quarter":
+		return month(a)/3 - month(b)/3
+	case "month":
+		return month(a) - month(b)
+	case "week":
+		return (day(truncDate(a, unit)) - day(truncDate(b, unit))) / 7
+	case "day":
+		return day(a) - day(b)
+	case "hour":
+		return int64(truncDate(a, unit).Sub(truncDate(b, unit)) / time.Hour)
+	case "minute":
+		return int64(truncDate(a, unit).Sub(truncDate(b, unit)) / time.Minute)
+	default:
+		return int64(truncDate(a, unit).Sub(truncDate(b, unit)) / time.Second)
+	}
+}
+
+// datePart returns a field of the date: dow is 0 for Sunday, week is the ISO week,
+// epoch is the number of seconds since 1970-01-01 UTC.
+func datePart(t time.Time, part string) Value {
+	switch part {
+	case "year":
+		return IntValue(int64(t.Year()))
+	case "quarter":
+		return IntValue(int64(t.Month()-1)/3 + 1)
+	case "month":
+		return IntValue(int64(t.Month()))
+	case "week":
+		_, w := t.ISOWeek()
+		return IntValue(int64(w))
+	case "day":
+		return IntValue(int64(t.Day()))
+	case "dow":
+		return IntValue(int64(t.Weekday()))
+	case "doy":
+		return IntValue(int64(t.YearDay()))
+	case "hour":
+		return IntValue(int64(t.Hour()))
+	case "minute":
+		return IntValue(int64(t.Minute()))
+	case "second":
+		if t.Nanosecond() != 0 {
+			return FloatValue(float64(t.Second()) + float64(t.Nanosecond())/1e9)
+		}
+		return IntValue(int64(t.Second()))
+	default:
+		return IntValue(t.Unix())
+	}
+}
+
+// dateTrunc is DATE_TRUNC(unit, date).
+func dateTrunc(args []Value) (Value, error) {
+	unit, err := unitArg(args[0], dateUnits)
+	if err != nil {
+		return Null, err
+	}
+	t, err := dateArg(args[1])
+	if err != nil {
+		return Null, err
+	}
+	return DateValue(truncDate(t, unit)), nil
+}
+
+// datePartFunc is DATE_PART(part, date), EXTRACT(part FROM date) is parsed into it.
+func datePartFunc(args []Value) (Value, error) {
+	part, err := unitArg(args[0], dateParts)
+	if err != nil {
+		return Null, err
+	}
+	t, err := dateArg(args[1])
+	if err != nil {
+		return Null, err
+	}
+	return datePart(t, part), nil
+}
+
+// dateAdd is DATE_ADD(date, n [, unit]), the unit is day by default.
+func dateAdd(args []Value) (Value, error) {
+	t, err := dateArg(args[0])
+	if err != nil {
+		return Null, err
+	}
+	n, err := intArg(args[1], "number")
+	if err != nil {
+		return Null, err
+	}
+	unit := "day"
+	if len(args) > 2 {
+		if unit, err = unitArg(args[2], dateUnits); err != nil {
+			return Null, err
+		}
+	}
+	return DateValue(addDate(t, n, unit)), nil
+}
+
+// dateDiff is DATE_DIFF(a, b [, unit]), the number of units from b to a, days by default.
+func dateDiff(args []Value) (Value, error) {
+	a, err := dateArg(args[0])
+	if err != nil {
+		return Null, err
+	}
+	b, err := dateArg(args[1])
+	if err != nil {
+		return Null, err
+	}
+	unit := "day"
+	if len(args) > 2 {
+		if unit, err = unitArg(args[2], dateUnits); err != nil {
+			return Null, err
+		}
+	}
+	return IntValue(diffDates(a, b, unit)), nil
+}
+
+// now is NOW(), the current time.
+func now([]Value) (Value, error) {
+	return DateValue(time.Now()), nil
+}
+
+// today is TODAY(), the current local date as a date without time in UTC,
+// the way dates of files are parsed.
+func today([]Value) (Value, error) {
+	y, m, d := time.Now().Date()
+	return DateValue(time.Date(y, m, d, 0, 0, 0, 0, time.UTC)), nil
+}
+
+// strftime maps directives of C strftime to the elements of a Go layout.
+var strftime = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2", 'H': "15", 'I': "03", 'M': "04", 'S': "05",
+	'p': "PM", 'b': "Jan", 'B': "January", 'a': "Mon", 'A': "Monday", 'z': "-0700", 'Z': "MST", 'j': "002", '%': "%",
+}
+
+// goLayout converts a layout like %d/%m/%Y to the layout of time.Parse,
+// a layout without % is already a Go one.
+func goLayout(layout string) (string, error) {
+	if !strings.Contains(layout, "%") {
+		return layout, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			b.WriteByte(layout[i])
+			continue
+		}
+		if i++; i == len(layout) {
+			return "", fmt.Errorf("layout %q ends with %%", layout)
+		}
+		elem, ok := strftime[layout[i]]
+		if !ok {
+			return "", fmt.Errorf("unknown directive %%%c in layout %q", layout[i], layout)
+		}
+		b.WriteString(elem)
+	}
+	return b.String(), nil
+}
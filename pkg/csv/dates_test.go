@@ -0,0 +1,112 @@
+package csv_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func date(y int, m time.Month, d int) csv.Value {
+	return csv.DateValue(time.Date(y, m, d, 0, 0, 0, 0, time.UTC))
+}
+
+func TestDateFunctions(t *testing.T) {
+	head := &csv.Head{Fields: []csv.Field{
+		{Name: "date", Type: csv.TypeDate},
+		{Name: "at", Type: csv.TypeDate},
+	}}
+	// 2020-04-15 is Wednesday
+	values := []string{"2020-04-15", "2020-04-15T10:30:45Z"}
+	tests := []struct {
+		query string
+		want  csv.Value
+	}{
+		{"SELECT DATE '2020-04-14'", date(2020, 4, 14)},
+		{"SELECT date_trunc('week', date)", date(2020, 4, 13)},
+		{"SELECT date_trunc('MONTH', date)", date(2020, 4, 1)},
+		{"SELECT date_trunc('quarter', date)", date(2020, 4, 1)},
+		{"SELECT date_trunc('year', at)", date(2020, 1, 1)},
+		{"SELECT date_trunc('hour', at)", csv.DateValue(time.Date(2020, 4, 15, 10, 0, 0, 0, time.UTC))},
+		{"SELECT date_trunc('week', DATE '2020-04-19')", date(2020, 4, 13)},
+		{"SELECT date_trunc('day', '2020-04-15 23:59:59')", date(2020, 4, 15)},
+		{"SELECT EXTRACT(year FROM date)", csv.IntValue(2020)},
+		{"SELECT extract(MONTH from date)", csv.IntValue(4)},
+		{"SELECT EXTRACT(dow FROM date)", csv.IntValue(3)},
+		{"SELECT EXTRACT(doy FROM date)", csv.IntValue(106)},
+		{"SELECT EXTRACT(week FROM date)", csv.IntValue(16)},
+		{"SELECT EXTRACT(quarter FROM date)", csv.IntValue(2)},
+		{"SELECT EXTRACT(minute FROM at)", csv.IntValue(30)},
+		{"SELECT EXTRACT(epoch FROM date)", csv.IntValue(1586908800)},
+		{"SELECT date_part('day', at)", csv.IntValue(15)},
+		{"SELECT date_add(date, 1)", date(2020, 4, 16)},
+		{"SELECT date_add(date, -15, 'day')", date(2020, 3, 31)},
+		{"SELECT date_add(date, 2, 'week')", date(2020, 4, 29)},
+		{"SELECT date_add(DATE '2020-01-31', 1, 'month')", date(2020, 2, 29)},
+		{"SELECT date_add(DATE '2020-02-29', 1, 'year')", date(2021, 2, 28)},
+		{"SELECT date_add(DATE '2020-11-30', 1, 'quarter')", date(2021, 2, 28)},
+		{"SELECT date_add(at, 90, 'minute')", csv.DateValue(time.Date(2020, 4, 15, 12, 0, 45, 0, time.UTC))},
+		{"SELECT date_diff(date, DATE '2020-04-14')", csv.IntValue(1)},
+		{"SELECT date_diff(DATE '2020-01-01', date)", csv.IntValue(-105)},
+		{"SELECT date_diff(date, DATE '2019-12-31', 'year')", csv.IntValue(1)},
+		{"SELECT date_diff(date, DATE '2020-01-31', 'month')", csv.IntValue(3)},
+		{"SELECT date_diff(date, DATE '2020-04-12', 'week')", csv.IntValue(1)},
+		{"SELECT date_diff(at, date, 'hour')", csv.IntValue(10)},
+		{"SELECT date_diff(at, DATE '2020-04-14', 'second')", csv.IntValue(124245)},
+		{"SELECT date_trunc('day', NULL)", csv.Null},
+		{"SELECT date > DATE '2020-04-14' AND at < DATETIME '2020-04-15 11:00:00'", csv.BoolValue(true)},
+		{"SELECT TODAY() > DATE '2020-04-14' AND NOW() >= TODAY()", csv.BoolValue(true)},
+	}
+	for _, tt := range tests {
+		got, err := project(t, head, tt.query, values)
+		if assert.NoError(t, err, tt.query) {
+			assert.Equal(t, tt.want, got[0], tt.query)
+		}
+	}
+
+	for _, query := range []string{
+		"SELECT DATE '2020-13-01'", "SELECT EXTRACT(decade FROM date)", "SELECT EXTRACT(year date)",
+		"SELECT date_trunc('decade', date)", "SELECT date_add(date, 'x')", "SELECT date_diff(date, 'x')",
+		"SELECT NOW(1)",
+	} {
+		_, err := project(t, head, query, values)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestDateLayout(t *testing.T) {
+	tests := []struct {
+		layout, raw string
+		want        csv.Value
+	}{
+		{"%d/%m/%Y", "14/04/2020", date(2020, 4, 14)},
+		{"02/01/2006", "14/04/2020", date(2020, 4, 14)},
+		{"%Y%m%d %H:%M", "20200414 10:30", csv.DateValue(time.Date(2020, 4, 14, 10, 30, 0, 0, time.UTC))},
+		{"%d %b %Y", "14 Apr 2020", date(2020, 4, 14)},
+		{"", "2020-04-14", date(2020, 4, 14)},
+	}
+	for _, tt := range tests {
+		got, err := csv.Field{Name: "date", Type: csv.TypeDate, Layout: tt.layout}.Parse(tt.raw)
+		if assert.NoError(t, err, tt.layout) {
+			assert.Equal(t, tt.want, got, tt.layout)
+		}
+	}
+	_, err := csv.Field{Name: "date", Type: csv.TypeDate, Layout: "%d/%q"}.Parse("14/04")
+	assert.Error(t, err)
+
+	head := csv.Head{Fields: []csv.Field{{Name: "date", Type: csv.TypeDate, Layout: "%d/%m/%Y"}}}
+	if assert.NoError(t, head.ParseLayouts()) {
+		got, err := head.Fields[0].Parse("14/04/2020")
+		assert.NoError(t, err)
+		assert.Equal(t, date(2020, 4, 14), got)
+	}
+	head.Fields = append(head.Fields, csv.Field{Name: "day", Type: csv.TypeDate, Layout: "%d/%q"})
+	err = head.ParseLayouts()
+	assert.True(t, err != nil && strings.Contains(err.Error(), `"day"`), err)
+
+	typ, err := csv.ParseType("datetime")
+	assert.NoError(t, err)
+	assert.Equal(t, csv.TypeDate, typ)
+}
@@ -0,0 +1,565 @@
+package csv
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Expr is a node of a parsed query expression.
+type Expr interface {
+	// Pos returns the byte offset of the node in the query.
+	Pos() int
+	String() string
+	eval(row *Row) (Value, error)
+}
+
+// Literal is a constant value written in the query.
+type Literal struct {
+	Value  Value
+	Offset int
+}
+
+// ColumnRef is a reference to a column, Index and Type are resolved against Head by bind.
+// Table is the table name or alias qualifying the column, it may be empty.
+type ColumnRef struct {
+	Table  string
+	Name   string
+	Index  int
+	Type   Type
+	Offset int
+	field  Field
+	strict bool
+}
+
+// UnaryExpr is a prefix operator applied to X.
+type UnaryExpr struct {
+	Op     string
+	X      Expr
+	Offset int
+}
+
+// BinaryExpr is an infix operator applied to Left and Right.
+// NoCase makes string comparison case-insensitive, it is set by bind.
+type BinaryExpr struct {
+	Op          string
+	Left, Right Expr
+	Offset      int
+	NoCase      bool
+	// strict makes division by zero an error, it is set by bind
+	strict bool
+}
+
+// InExpr tests X for equality with the values of List.
+type InExpr struct {
+	X      Expr
+	List   []Expr
+	Offset int
+	NoCase bool
+}
+
+// BetweenExpr tests Low <= X AND X <= High.
+type BetweenExpr struct {
+	X, Low, High Expr
+	Offset       int
+	NoCase       bool
+}
+
+// IsNullExpr tests X IS NULL or, if Not is set, X IS NOT NULL.
+type IsNullExpr struct {
+	X      Expr
+	Not    bool
+	Offset int
+}
+
+// CollateExpr sets the collation used to compare X: NOCASE or BINARY.
+type CollateExpr struct {
+	X         Expr
+	Collation string
+	Offset    int
+}
+
+// CallExpr is a call of a function from the registry.
+type CallExpr struct {
+	Name   string
+	Args   []Expr
+	Offset int
+	fn     *Function
+	// re is the pattern of REGEXP_EXTRACT compiled by bind if it is a literal
+	re *regexp.Regexp
+}
+
+func (e *Literal) Pos() int     { return e.Offset }
+func (e *ColumnRef) Pos() int   { return e.Offset }
+func (e *UnaryExpr) Pos() int   { return e.Offset }
+func (e *BinaryExpr) Pos() int  { return e.Offset }
+func (e *CallExpr) Pos() int    { return e.Offset }
+func (e *CollateExpr) Pos() int { return e.Offset }
+func (e *InExpr) Pos() int      { return e.Offset }
+func (e *BetweenExpr) Pos() int { return e.Offset }
+func (e *IsNullExpr) Pos() int  { return e.Offset }
+
+func (e *Literal) String() string {
+	if e.Value.Type == TypeString {
+		return "'" + strings.ReplaceAll(e.Value.Str, "'", "''") + "'"
+	}
+	if e.Value.IsNull() {
+		return "NULL"
+	}
+	if e.Value.Type == TypeDate {
+		return "DATE '" + e.Value.String() + "'"
+	}
+	return e.Value.String()
+}
+
+func (e *ColumnRef) String() string {
+	if e.Table != "" {
+		return e.Table + "." + e.Name
+	}
+	return e.Name
+}
+
+func (e *UnaryExpr) String() string {
+	if e.Op != "NOT" {
+		return "(" + e.Op + e.X.String() + ")"
+	}
+	return "(" + e.Op + " " + e.X.String() + ")"
+}
+
+func (e *BinaryExpr) String() string {
+	return "(" + e.Left.String() + " " + e.Op + " " + e.Right.String() + ")"
+}
+
+func (e *InExpr) String() string {
+	list := make([]string, len(e.List))
+	for i, x := range e.List {
+		list[i] = x.String()
+	}
+	return "(" + e.X.String() + " IN (" + strings.Join(list, ", ") + "))"
+}
+
+func (e *BetweenExpr) String() string {
+	return "(" + e.X.String() + " BETWEEN " + e.Low.String() + " AND " + e.High.String() + ")"
+}
+
+func (e *IsNullExpr) String() string {
+	if e.Not {
+		return "(" + e.X.String() + " IS NOT NULL)"
+	}
+	return "(" + e.X.String() + " IS NULL)"
+}
+
+func (e *CollateExpr) String() string {
+	return "(" + e.X.String() + " COLLATE " + e.Collation + ")"
+}
+
+func (e *CallExpr) String() string {
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = arg.String()
+	}
+	return e.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (e *Literal) eval(*Row) (Value, error) {
+	return e.Value, nil
+}
+
+func (e *ColumnRef) eval(row *Row) (Value, error) {
+	if e.Index >= len(row.Values) {
+		return Null, nil
+	}
+	v, err := e.field.Parse(row.Values[e.Index])
+	if err != nil && e.strict {
+		return Null, fmt.Errorf("column %s: %w", e.Name, err)
+	}
+	return v, nil
+}
+
+func (e *UnaryExpr) eval(row *Row) (Value, error) {
+	x, err := e.X.eval(row)
+	if err != nil || x.IsNull() {
+		return Null, err
+	}
+	switch e.Op {
+	case "NOT":
+		if x.Type != TypeBool {
+			return Null, fmt.Errorf("NOT: %s is not bool", x.Type)
+		}
+		return BoolValue(!x.Bool), nil
+	case "-":
+		return negate(x)
+	case "+":
+		return numeric(x)
+	default:
+		return Null, fmt.Errorf("unknown operator %s", e.Op)
+	}
+}
+
+func (e *BinaryExpr) eval(row *Row) (Value, error) {
+	switch e.Op {
+	case "AND", "OR":
+		return e.logical(row)
+	}
+	if arithmeticOps[e.Op] {
+		return e.arithmetic(row)
+	}
+	l, err := e.Left.eval(row)
+	if err != nil {
+		return Null, err
+	}
+	r, err := e.Right.eval(row)
+	if err != nil {
+		return Null, err
+	}
+	if e.NoCase {
+		l, r = foldCase(l), foldCase(r)
+	}
+	cmp, ok := compare(l, r)
+	if !ok {
+		return Null, nil
+	}
+	switch e.Op {
+	case "=":
+		return BoolValue(cmp == 0), nil
+	case "<>":
+		return BoolValue(cmp != 0), nil
+	case "<":
+		return BoolValue(cmp < 0), nil
+	case "<=":
+		return BoolValue(cmp <= 0), nil
+	case ">":
+		return BoolValue(cmp > 0), nil
+	case ">=":
+		return BoolValue(cmp >= 0), nil
+	default:
+		return Null, fmt.Errorf("unknown operator %s", e.Op)
+	}
+}
+
+// logical evaluates AND/OR with three-valued logic and short circuit.
+func (e *BinaryExpr) logical(row *Row) (Value, error) {
+	l, err := evalBool(e.Left, row)
+	if err != nil {
+		return Null, err
+	}
+	if !l.IsNull() && l.Bool == (e.Op == "OR") {
+		return l, nil
+	}
+	r, err := evalBool(e.Right, row)
+	if err != nil {
+		return Null, err
+	}
+	switch {
+	case !r.IsNull() && r.Bool == (e.Op == "OR"):
+		return r, nil
+	case l.IsNull() || r.IsNull():
+		return Null, nil
+	default:
+		return r, nil
+	}
+}
+
+// eval is true if X equals a value of the list, NULL if it doesn't
+// but some of the values can't be compared with X, false otherwise.
+func (e *InExpr) eval(row *Row) (Value, error) {
+	x, err := e.X.eval(row)
+	if err != nil || x.IsNull() {
+		return Null, err
+	}
+	if e.NoCase {
+		x = foldCase(x)
+	}
+	res := BoolValue(false)
+	for _, item := range e.List {
+		v, err := item.eval(row)
+		if err != nil {
+			return Null, err
+		}
+		if e.NoCase {
+			v = foldCase(v)
+		}
+		cmp, ok := compare(x, v)
+		if !ok {
+			res = Null
+			continue
+		}
+		if cmp == 0 {
+			return BoolValue(true), nil
+		}
+	}
+	return res, nil
+}
+
+// eval is NULL if X or a bound needed to decide is NULL.
+func (e *BetweenExpr) eval(row *Row) (Value, error) {
+	x, err := e.X.eval(row)
+	if err != nil || x.IsNull() {
+		return Null, err
+	}
+	low, err := e.Low.eval(row)
+	if err != nil {
+		return Null, err
+	}
+	high, err := e.High.eval(row)
+	if err != nil {
+		return Null, err
+	}
+	if e.NoCase {
+		x, low, high = foldCase(x), foldCase(low), foldCase(high)
+	}
+	res := BoolValue(true)
+	if cmp, ok := compare(low, x); !ok {
+		res = Null
+	} else if cmp > 0 {
+		return BoolValue(false), nil
+	}
+	if cmp, ok := compare(x, high); !ok {
+		res = Null
+	} else if cmp > 0 {
+		return BoolValue(false), nil
+	}
+	return res, nil
+}
+
+func (e *IsNullExpr) eval(row *Row) (Value, error) {
+	x, err := e.X.eval(row)
+	if err != nil {
+		return Null, err
+	}
+	return BoolValue(x.IsNull() != e.Not), nil
+}
+
+func (e *CollateExpr) eval(row *Row) (Value, error) {
+	return e.X.eval(row)
+}
+
+func (e *CallExpr) eval(row *Row) (Value, error) {
+	args := make([]Value, len(e.Args))
+	for i, arg := range e.Args {
+		v, err := arg.eval(row)
+		if err != nil {
+			return Null, err
+		}
+		args[i] = v
+	}
+	var (
+		v   Value
+		err error
+	)
+	if e.re != nil {
+		v, err = extractGroup(e.re, args)
+	} else {
+		v, err = e.fn.Call(args)
+	}
+	if err != nil {
+		return Null, fmt.Errorf("%s: %w", e.Name, err)
+	}
+	return v, nil
+}
+
+func evalBool(e Expr, row *Row) (Value, error) {
+	v, err := e.eval(row)
+	if err != nil || v.IsNull() {
+		return Null, err
+	}
+	if v.Type != TypeBool {
+		return Null, fmt.Errorf("%s is not a condition", e)
+	}
+	return v, nil
+}
+
+// walk calls fn for e and all its descendants, depth first.
+func walk(e Expr, fn func(Expr) error) error {
+	if err := fn(e); err != nil {
+		return err
+	}
+	for _, child := range children(e) {
+		if err := walk(child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// children returns the operands of the node.
+func children(e Expr) []Expr {
+	switch n := e.(type) {
+	case *UnaryExpr:
+		return []Expr{n.X}
+	case *BinaryExpr:
+		return []Expr{n.Left, n.Right}
+	case *CallExpr:
+		return n.Args
+	case *CollateExpr:
+		return []Expr{n.X}
+	case *InExpr:
+		return append([]Expr{n.X}, n.List...)
+	case *BetweenExpr:
+		return []Expr{n.X, n.Low, n.High}
+	case *IsNullExpr:
+		return []Expr{n.X}
+	case *RegexpExpr:
+		return []Expr{n.X, n.Pattern}
+	case *CaseExpr:
+		return n.children()
+	case *CastExpr:
+		return []Expr{n.X}
+	case *LikeExpr:
+		if n.Escape != nil {
+			return []Expr{n.X, n.Pattern, n.Escape}
+		}
+		return []Expr{n.X, n.Pattern}
+	case *AggregateExpr:
+		if n.Arg != nil {
+			return []Expr{n.Arg}
+		}
+	}
+	return nil
+}
+
+// bind resolves column references and functions of the expression
+// and converts literals compared with a typed column to the column type.
+func bind(e Expr, head *Head) error {
+	err := walk(e, func(e Expr) error {
+		switch n := e.(type) {
+		case *ColumnRef:
+			i, err := head.resolve(n.Table, n.Name)
+			if err != nil {
+				return fmt.Errorf("%w at position %d", err, n.Offset)
+			}
+			n.Index, n.Type, n.field, n.strict = i, head.Fields[i].Type, head.Fields[i], head.Strict
+		case *CallExpr:
+			fn, ok := Functions[strings.ToUpper(n.Name)]
+			if !ok {
+				return fmt.Errorf("unknown function %q at position %d", n.Name, n.Offset)
+			}
+			if len(n.Args) < fn.MinArgs || fn.MaxArgs >= 0 && len(n.Args) > fn.MaxArgs {
+				return fmt.Errorf("wrong number of arguments for %s at position %d", n.Name, n.Offset)
+			}
+			n.fn = &fn
+			return n.compile()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return walk(e, func(e Expr) error {
+		switch n := e.(type) {
+		case *BinaryExpr:
+			if arithmeticOps[n.Op] {
+				n.strict = head.Strict
+				return nil
+			}
+			n.NoCase = noCase(head.IgnoreCase, n.Left, n.Right)
+			if err := coerceLiteral(n.Left, n.Right); err != nil {
+				return err
+			}
+			return coerceLiteral(n.Right, n.Left)
+		case *InExpr:
+			n.NoCase = noCase(head.IgnoreCase, append([]Expr{n.X}, n.List...)...)
+			for _, item := range n.List {
+				if err := coerceLiteral(n.X, item); err != nil {
+					return err
+				}
+			}
+		case *BetweenExpr:
+			n.NoCase = noCase(head.IgnoreCase, n.X, n.Low, n.High)
+			if err := coerceLiteral(n.X, n.Low); err != nil {
+				return err
+			}
+			return coerceLiteral(n.X, n.High)
+		case *LikeExpr:
+			n.NoCase = noCase(head.IgnoreCase, n.X, n.Pattern)
+			return n.compile()
+		case *RegexpExpr:
+			n.NoCase = n.Op == "~*" || noCase(false, n.X, n.Pattern)
+			return n.compile()
+		case *CastExpr:
+			n.strict = head.Strict
+		case *CaseExpr:
+			if n.Operand == nil {
+				return nil
+			}
+			conds := []Expr{n.Operand}
+			for _, w := range n.Whens {
+				if err := coerceLiteral(n.Operand, w.Cond); err != nil {
+					return err
+				}
+				conds = append(conds, w.Cond)
+			}
+			n.NoCase = noCase(head.IgnoreCase, conds...)
+		}
+		return nil
+	})
+}
+
+// noCase tells if operands are compared ignoring case: an explicit COLLATE
+// of an operand wins over the default.
+func noCase(def bool, operands ...Expr) bool {
+	for _, op := range operands {
+		if c, ok := op.(*CollateExpr); ok {
+			return c.Collation == "NOCASE"
+		}
+	}
+	return def
+}
+
+// coerceLiteral converts lit to the type of col if they are a literal and a typed column.
+// A fractional number compared with an int column stays a float, so the comparison
+// is made on floats.
+func coerceLiteral(col, lit Expr) error {
+	if c, ok := col.(*CollateExpr); ok {
+		col = c.X
+	}
+	if c, ok := lit.(*CollateExpr); ok {
+		lit = c.X
+	}
+	c, ok := col.(*ColumnRef)
+	if !ok || c.Type == TypeString {
+		return nil
+	}
+	l, ok := lit.(*Literal)
+	if !ok {
+		return nil
+	}
+	if f, isNum := l.Value.number(); isNum && c.Type == TypeInt && f != math.Trunc(f) {
+		l.Value = FloatValue(f)
+		return nil
+	}
+	v, err := coerce(l.Value, c.Type)
+	if err != nil {
+		return fmt.Errorf("%s at position %d compared with %s column %s: %w", l, l.Offset, c.Type, c.Name, err)
+	}
+	l.Value = v
+	return nil
+}
+
+// Predicate reports whether the row satisfies a compiled condition.
+type Predicate func(row *Row) (bool, error)
+
+// Compile parses the condition once and resolves its columns against head,
+// so the resulting predicate is only a tree walk per row.
+func Compile(query string, head *Head) (Predicate, error) {
+	expr, err := Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return NewPredicate(expr, head)
+}
+
+// NewPredicate resolves a parsed condition against head, nil matches every row.
+func NewPredicate(expr Expr, head *Head) (Predicate, error) {
+	if expr == nil {
+		return func(*Row) (bool, error) { return true, nil }, nil
+	}
+	if err := bind(expr, head); err != nil {
+		return nil, err
+	}
+	return func(row *Row) (bool, error) {
+		v, err := evalBool(expr, row)
+		return !v.IsNull() && v.Bool, err
+	}, nil
+}
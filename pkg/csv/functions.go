@@ -0,0 +1,266 @@
+package csv
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Function is a scalar function callable from a query.
+// MaxArgs < 0 means the function is variadic.
+type Function struct {
+	MinArgs, MaxArgs int
+	Call             func(args []Value) (Value, error)
+}
+
+// Functions is the registry of scalar functions by upper-case name. A program
+// embedding the package may add its own functions before queries are prepared:
+//
+//	csv.Functions["DOUBLE"] = csv.Function{MinArgs: 1, MaxArgs: 1, Call: double}
+//
+// Call gets the evaluated arguments, a function of NULL usually returns NULL.
+var Functions = map[string]Function{
+	"UPPER": {MinArgs: 1, MaxArgs: 1, Call: func(args []Value) (Value, error) {
+		if args[0].IsNull() {
+			return Null, nil
+		}
+		return StringValue(strings.ToUpper(args[0].String())), nil
+	}},
+	"LOWER": {MinArgs: 1, MaxArgs: 1, Call: func(args []Value) (Value, error) {
+		if args[0].IsNull() {
+			return Null, nil
+		}
+		return StringValue(strings.ToLower(args[0].String())), nil
+	}},
+	"LENGTH": {MinArgs: 1, MaxArgs: 1, Call: func(args []Value) (Value, error) {
+		if args[0].IsNull() {
+			return Null, nil
+		}
+		return IntValue(int64(utf8.RuneCountInString(args[0].String()))), nil
+	}},
+	"REGEXP_EXTRACT": {MinArgs: 2, MaxArgs: 3, Call: regexpExtract},
+	"TRIM":           {MinArgs: 1, MaxArgs: 2, Call: nullable(trim)},
+	"SUBSTR":         {MinArgs: 2, MaxArgs: 3, Call: nullable(substr)},
+	"REPLACE": {MinArgs: 3, MaxArgs: 3, Call: nullable(func(args []Value) (Value, error) {
+		return StringValue(strings.ReplaceAll(args[0].String(), args[1].String(), args[2].String())), nil
+	})},
+	"CONCAT":     {MinArgs: 1, MaxArgs: -1, Call: concat},
+	"SPLIT_PART": {MinArgs: 3, MaxArgs: 3, Call: nullable(splitPart)},
+	"ABS":        {MinArgs: 1, MaxArgs: 1, Call: nullable(abs)},
+	"ROUND":      {MinArgs: 1, MaxArgs: 2, Call: nullable(round)},
+	"FLOOR":      {MinArgs: 1, MaxArgs: 1, Call: nullable(mathFunc(math.Floor))},
+	"CEIL":       {MinArgs: 1, MaxArgs: 1, Call: nullable(mathFunc(math.Ceil))},
+	"POW":        {MinArgs: 2, MaxArgs: 2, Call: nullable(pow)},
+	"COALESCE":   {MinArgs: 1, MaxArgs: -1, Call: coalesce},
+	"NULLIF":     {MinArgs: 2, MaxArgs: 2, Call: nullIf},
+	"IF":         {MinArgs: 3, MaxArgs: 3, Call: ifFunc},
+	"DATE_TRUNC": {MinArgs: 2, MaxArgs: 2, Call: nullable(dateTrunc)},
+	"DATE_PART":  {MinArgs: 2, MaxArgs: 2, Call: nullable(datePartFunc)},
+	"DATE_ADD":   {MinArgs: 2, MaxArgs: 3, Call: nullable(dateAdd)},
+	"DATE_DIFF":  {MinArgs: 2, MaxArgs: 3, Call: nullable(dateDiff)},
+	"NOW":        {MinArgs: 0, MaxArgs: 0, Call: now},
+	"TODAY":      {MinArgs: 0, MaxArgs: 0, Call: today},
+}
+
+// nullable makes the function return NULL if an argument is NULL.
+func nullable(call func(args []Value) (Value, error)) func(args []Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		for _, arg := range args {
+			if arg.IsNull() {
+				return Null, nil
+			}
+		}
+		return call(args)
+	}
+}
+
+// trim removes leading and trailing spaces or characters of the second argument.
+func trim(args []Value) (Value, error) {
+	if len(args) > 1 {
+		return StringValue(strings.Trim(args[0].String(), args[1].String())), nil
+	}
+	return StringValue(strings.TrimSpace(args[0].String())), nil
+}
+
+// intArg returns the argument as an int, a float must be whole.
+func intArg(v Value, name string) (int64, error) {
+	n, err := numeric(v)
+	if err == nil {
+		n, err = coerce(n, TypeInt)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return n.Int, nil
+}
+
+// substr returns length characters starting at start counted from 1,
+// a negative start is counted from the end.
+func substr(args []Value) (Value, error) {
+	s := []rune(args[0].String())
+	start, err := intArg(args[1], "start")
+	if err != nil {
+		return Null, err
+	}
+	n := int64(len(s))
+	switch {
+	case start < 0:
+		start += n
+	case start > 0:
+		start--
+	}
+	end := n
+	if len(args) > 2 {
+		length, err := intArg(args[2], "length")
+		if err != nil {
+			return Null, err
+		}
+		if length < 0 {
+			return Null, fmt.Errorf("negative length %d", length)
+		}
+		if start+length < end {
+			end = start + length
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start >= end {
+		return StringValue(""), nil
+	}
+	return StringValue(string(s[start:end])), nil
+}
+
+// concat joins the text of the arguments, NULLs are skipped.
+func concat(args []Value) (Value, error) {
+	var b strings.Builder
+	for _, arg := range args {
+		b.WriteString(arg.String())
+	}
+	return StringValue(b.String()), nil
+}
+
+// splitPart returns the field n of the text split by the delimiter counting
+// from 1, or from the end if n is negative. It is NULL if there is no such field.
+func splitPart(args []Value) (Value, error) {
+	n, err := intArg(args[2], "field")
+	if err != nil {
+		return Null, err
+	}
+	if n == 0 {
+		return Null, fmt.Errorf("field number must not be 0")
+	}
+	parts := []string{args[0].String()}
+	if sep := args[1].String(); sep != "" {
+		parts = strings.Split(args[0].String(), sep)
+	}
+	if n < 0 {
+		n += int64(len(parts)) + 1
+	}
+	if n < 1 || n > int64(len(parts)) {
+		return Null, nil
+	}
+	return StringValue(parts[n-1]), nil
+}
+
+func abs(args []Value) (Value, error) {
+	x, err := numeric(args[0])
+	if err != nil || x.IsNull() {
+		return Null, err
+	}
+	if x.Type == TypeInt && x.Int >= 0 {
+		return x, nil
+	}
+	return negate(x)
+}
+
+// round rounds half away from zero to the number of decimal digits, 0 by default.
+// Negative digits round to tens, hundreds and so on.
+func round(args []Value) (Value, error) {
+	x, err := numeric(args[0])
+	if err != nil || x.IsNull() {
+		return Null, err
+	}
+	digits := int64(0)
+	if len(args) > 1 {
+		if digits, err = intArg(args[1], "digits"); err != nil {
+			return Null, err
+		}
+	}
+	if x.Type == TypeInt && digits >= 0 {
+		return x, nil
+	}
+	f, _ := x.number()
+	p := math.Pow(10, float64(digits))
+	if r := math.Round(f*p) / p; !math.IsInf(r, 0) && !math.IsNaN(r) {
+		f = r
+	}
+	if x.Type == TypeInt {
+		return IntValue(int64(f)), nil
+	}
+	return FloatValue(f), nil
+}
+
+// mathFunc applies fn to a number, ints are returned as is.
+func mathFunc(fn func(float64) float64) func(args []Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		x, err := numeric(args[0])
+		if err != nil || x.IsNull() || x.Type == TypeInt {
+			return x, err
+		}
+		return FloatValue(fn(x.Float)), nil
+	}
+}
+
+// pow raises the first argument to the power of the second one, NaN is NULL.
+func pow(args []Value) (Value, error) {
+	x, err := numeric(args[0])
+	if err != nil || x.IsNull() {
+		return Null, err
+	}
+	y, err := numeric(args[1])
+	if err != nil || y.IsNull() {
+		return Null, err
+	}
+	a, _ := x.number()
+	b, _ := y.number()
+	f := math.Pow(a, b)
+	switch {
+	case math.IsNaN(f):
+		return Null, nil
+	case math.IsInf(f, 0):
+		return Null, fmt.Errorf("%v ^ %v is out of range", a, b)
+	}
+	return FloatValue(f), nil
+}
+
+// coalesce returns the first argument that is not NULL.
+func coalesce(args []Value) (Value, error) {
+	for _, arg := range args {
+		if !arg.IsNull() {
+			return arg, nil
+		}
+	}
+	return Null, nil
+}
+
+// nullIf returns NULL if the arguments are equal and the first one otherwise.
+func nullIf(args []Value) (Value, error) {
+	if cmp, ok := compare(args[0], args[1]); ok && cmp == 0 {
+		return Null, nil
+	}
+	return args[0], nil
+}
+
+// ifFunc returns the second argument if the first one is true and the third one otherwise.
+func ifFunc(args []Value) (Value, error) {
+	cond := args[0]
+	if !cond.IsNull() && cond.Type != TypeBool {
+		return Null, fmt.Errorf("%s is not a condition", cond)
+	}
+	if !cond.IsNull() && cond.Bool {
+		return args[1], nil
+	}
+	return args[2], nil
+}
@@ -0,0 +1,123 @@
+package csv_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+var functionsHead = &csv.Head{Fields: []csv.Field{
+	{Name: "name", Type: csv.TypeString},
+	{Name: "cases", Type: csv.TypeInt},
+	{Name: "rate", Type: csv.TypeFloat},
+	{Name: "note", Type: csv.TypeString},
+}}
+
+// project evaluates the select list of the query for a row of head with the values.
+func project(t *testing.T, head *csv.Head, query string, values []string) ([]csv.Value, error) {
+	t.Helper()
+	stmt, err := csv.ParseStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	q, err := csv.Prepare(stmt, head)
+	if err != nil {
+		return nil, err
+	}
+	row := head.NewRow()
+	row.Values = values
+	return q.Project(row)
+}
+
+func TestFunctions(t *testing.T) {
+	values := []string{"  Côte d'Ivoire ", "-42", "2.5", ""}
+	tests := []struct {
+		query string
+		want  csv.Value
+	}{
+		{"SELECT trim(name)", csv.StringValue("Côte d'Ivoire")},
+		{"SELECT trim('xxabcx', 'x')", csv.StringValue("abc")},
+		{"SELECT length(trim(name))", csv.IntValue(13)},
+		{"SELECT substr(trim(name), 1, 4)", csv.StringValue("Côte")},
+		{"SELECT substr(trim(name), 6)", csv.StringValue("d'Ivoire")},
+		{"SELECT substr(trim(name), -5, 2)", csv.StringValue("vo")},
+		{"SELECT substr('abc', 5)", csv.StringValue("")},
+		{"SELECT replace(name, ' ', '_')", csv.StringValue("__Côte_d'Ivoire_")},
+		{"SELECT concat('a', note, cases, '-', rate)", csv.StringValue("a-42-2.5")},
+		{"SELECT split_part('2020-04-14', '-', 2)", csv.StringValue("04")},
+		{"SELECT split_part('2020-04-14', '-', -1)", csv.StringValue("14")},
+		{"SELECT split_part('2020-04-14', '-', 4)", csv.Null},
+		{"SELECT upper(note)", csv.Null},
+		{"SELECT abs(cases)", csv.IntValue(42)},
+		{"SELECT abs(-rate)", csv.FloatValue(2.5)},
+		{"SELECT round(rate)", csv.FloatValue(3)},
+		{"SELECT round(-rate)", csv.FloatValue(-3)},
+		{"SELECT round(3.14159, 2)", csv.FloatValue(3.14)},
+		{"SELECT round(cases, -1)", csv.IntValue(-40)},
+		{"SELECT floor(rate), ceil(rate)", csv.FloatValue(2)},
+		{"SELECT ceil(-rate)", csv.FloatValue(-2)},
+		{"SELECT floor(cases)", csv.IntValue(-42)},
+		{"SELECT pow(2, 10)", csv.FloatValue(1024)},
+		{"SELECT pow(cases, 0.5)", csv.Null},
+		{"SELECT coalesce(note, NULL, rate, cases)", csv.FloatValue(2.5)},
+		{"SELECT coalesce(note)", csv.Null},
+		{"SELECT nullif(cases, -42)", csv.Null},
+		{"SELECT nullif(rate, 1)", csv.FloatValue(2.5)},
+		{"SELECT if(cases < 0, 'neg', 'pos')", csv.StringValue("neg")},
+		{"SELECT if(note = 'x', 1, 2)", csv.IntValue(2)},
+		{"SELECT CASE WHEN cases > 0 THEN 'pos' WHEN cases < 0 THEN 'neg' ELSE 'zero' END", csv.StringValue("neg")},
+		{"SELECT CASE WHEN cases > 0 THEN 'pos' END", csv.Null},
+		{"SELECT CASE rate WHEN 1 THEN 'one' WHEN 2.5 THEN 'two and a half' END", csv.StringValue("two and a half")},
+		{"SELECT CASE trim(name) WHEN 'CÔTE D''IVOIRE' THEN 1 ELSE 0 END", csv.IntValue(0)},
+		{"SELECT CASE WHEN cases / 0 > 1 THEN 1 ELSE cases DIV 2 END", csv.IntValue(-21)},
+		{"SELECT CAST(rate AS int)", csv.IntValue(2)},
+		{"SELECT CAST(cases AS string)", csv.StringValue("-42")},
+		{"SELECT CAST('12' AS int) + 1", csv.IntValue(13)},
+		{"SELECT CAST(cases AS float) / 4", csv.FloatValue(-10.5)},
+		{"SELECT CAST('2020-04-14' AS date)", csv.DateValue(time.Date(2020, 4, 14, 0, 0, 0, 0, time.UTC))},
+		{"SELECT CAST(cases AS bool)", csv.BoolValue(true)},
+		{"SELECT CAST(true AS int)", csv.IntValue(1)},
+		{"SELECT CAST(name AS int)", csv.Null},
+		{"SELECT CAST(note AS int)", csv.Null},
+	}
+	for _, tt := range tests {
+		got, err := project(t, functionsHead, tt.query, values)
+		if assert.NoError(t, err, tt.query) {
+			assert.Equal(t, tt.want, got[0], tt.query)
+		}
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	strict := *functionsHead
+	strict.Strict = true
+	values := []string{"abc", "1", "2.5", ""}
+	for _, query := range []string{
+		"SELECT substr(name)", "SELECT substr(name, 'x')", "SELECT substr(name, 1, -1)",
+		"SELECT abs(name)", "SELECT round(rate, 'x')", "SELECT split_part(name, 'b', 0)",
+		"SELECT if(cases, 1, 2)", "SELECT pow(10, 400)", "SELECT nope(1)",
+		"SELECT CAST(name AS int)", "SELECT CAST(name AS varchar)", "SELECT CAST(name int)",
+		"SELECT CASE END", "SELECT CASE WHEN cases THEN 1 END", "SELECT CASE WHEN 1 = 1 THEN 1",
+		"SELECT CASE cases WHEN 'x' THEN 1 END",
+	} {
+		_, err := project(t, &strict, query, values)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestRegisterFunction(t *testing.T) {
+	csv.Functions["REVERSE"] = csv.Function{MinArgs: 1, MaxArgs: 1, Call: func(args []csv.Value) (csv.Value, error) {
+		runes := []rune(args[0].String())
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return csv.StringValue(string(runes)), nil
+	}}
+	defer delete(csv.Functions, "REVERSE")
+	got, err := project(t, functionsHead, "SELECT reverse(name) WHERE reverse(name) = 'naR'", []string{"Ran"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, csv.StringValue("naR"), got[0])
+	}
+}
@@ -0,0 +1,458 @@
+package csv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	IndexBTree = "btree"
+	IndexHash  = "hash"
+
+	indexMagic = "CSVQIDX2"
+)
+
+// Index maps values of a column to offsets of the records having them.
+type Index interface {
+	Kind() string
+	Column() string
+	// Len returns the number of distinct keys.
+	Len() int
+	insert(key Value, offset int64)
+	each(fn func(key Value, offsets []int64))
+	// lookup returns sorted offsets of records with keys in the range,
+	// ok is false if the index can't answer such a lookup.
+	lookup(r keyRange) (offsets []int64, ok bool)
+}
+
+// keyRange is a set of keys: a list of values or an interval.
+type keyRange struct {
+	values []Value
+	lo, hi *Bound
+}
+
+type btreeIndex struct {
+	column string
+	tree   BTree
+}
+
+func (idx *btreeIndex) Kind() string   { return IndexBTree }
+func (idx *btreeIndex) Column() string { return idx.column }
+func (idx *btreeIndex) Len() int       { return idx.tree.Len() }
+
+func (idx *btreeIndex) insert(key Value, offset int64) {
+	idx.tree.Insert(key, offset)
+}
+
+func (idx *btreeIndex) each(fn func(key Value, offsets []int64)) {
+	idx.tree.Ascend(nil, nil, func(key Value, offsets []int64) bool {
+		fn(key, offsets)
+		return true
+	})
+}
+
+func (idx *btreeIndex) lookup(r keyRange) ([]int64, bool) {
+	offsets := []int64{}
+	collect := func(_ Value, o []int64) bool {
+		offsets = append(offsets, o...)
+		return true
+	}
+	if r.values != nil {
+		for _, v := range r.values {
+			idx.tree.Ascend(&Bound{Key: v, Inclusive: true}, &Bound{Key: v, Inclusive: true}, collect)
+		}
+	} else {
+		idx.tree.Ascend(r.lo, r.hi, collect)
+	}
+	sortOffsets(offsets)
+	return offsets, true
+}
+
+// hashIndex answers equality lookups only, keys are kept in the order of insertion.
+type hashIndex struct {
+	column string
+	keys   map[hashKey]int
+	items  []btreeItem
+}
+
+// hashKey identifies a key value, dates are compared by the instant.
+type hashKey struct {
+	t Type
+	s string
+	n int64
+	f float64
+}
+
+func newHashKey(v Value) hashKey {
+	switch v.Type {
+	case TypeInt:
+		return hashKey{t: v.Type, n: v.Int}
+	case TypeFloat:
+		return hashKey{t: v.Type, f: v.Float}
+	case TypeBool:
+		if v.Bool {
+			return hashKey{t: v.Type, n: 1}
+		}
+		return hashKey{t: v.Type}
+	case TypeDate:
+		return hashKey{t: v.Type, n: v.Time.UnixNano()}
+	default:
+		return hashKey{t: v.Type, s: v.Str}
+	}
+}
+
+func (idx *hashIndex) Kind() string   { return IndexHash }
+func (idx *hashIndex) Column() string { return idx.column }
+func (idx *hashIndex) Len() int       { return len(idx.items) }
+
+func (idx *hashIndex) insert(key Value, offset int64) {
+	k := newHashKey(key)
+	if i, ok := idx.keys[k]; ok {
+		idx.items[i].offsets = append(idx.items[i].offsets, offset)
+		return
+	}
+	idx.keys[k] = len(idx.items)
+	idx.items = append(idx.items, btreeItem{key: key, offsets: []int64{offset}})
+}
+
+func (idx *hashIndex) each(fn func(key Value, offsets []int64)) {
+	for _, item := range idx.items {
+		fn(item.key, item.offsets)
+	}
+}
+
+func (idx *hashIndex) lookup(r keyRange) ([]int64, bool) {
+	if r.values == nil {
+		return nil, false
+	}
+	offsets := []int64{}
+	for _, v := range r.values {
+		if i, ok := idx.keys[newHashKey(v)]; ok {
+			offsets = append(offsets, idx.items[i].offsets...)
+		}
+	}
+	sortOffsets(offsets)
+	return offsets, true
+}
+
+func sortOffsets(offsets []int64) {
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+}
+
+func newIndex(kind, column string) (Index, error) {
+	switch kind {
+	case IndexBTree, "":
+		return &btreeIndex{column: column}, nil
+	case IndexHash:
+		return &hashIndex{column: column, keys: map[hashKey]int{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown index type %q", kind)
+	}
+}
+
+// IndexPath returns the path of the file the index of the column is kept in, next to the CSV.
+func IndexPath(csvPath, column, kind string) string {
+	name := strings.Map(func(r rune) rune {
+		if isIdentPart(r) || r == '-' {
+			return r
+		}
+		return '_'
+	}, column)
+	return csvPath + "." + name + "." + kind + ".idx"
+}
+
+// indexHeader identifies the CSV file and the column an index file was built for.
+type indexHeader struct {
+	kind    string
+	column  string
+	keyType Type
+	layout  string
+	dialect string
+	size    int64
+	modTime int64
+	hash    uint32
+}
+
+// OpenIndex loads the index of the column of head.Path from its file, or builds it
+// and saves it if the file is missing or was built for another version of the CSV.
+// head.Fields must describe the header of the file.
+func OpenIndex(kind string, head *Head, column string, opts ReaderOptions) (Index, error) {
+	i := head.FieldIndex(column)
+	if i < 0 {
+		return nil, fmt.Errorf("index: unknown column %q in %s", column, head.Path)
+	}
+	field := head.Fields[i]
+	idx, err := newIndex(kind, field.Name)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(head.Path)
+	if err != nil {
+		return nil, err
+	}
+	want := indexHeader{
+		kind:    idx.Kind(),
+		column:  field.Name,
+		keyType: field.Type,
+		layout:  field.Layout,
+		dialect: fmt.Sprintf("%+v", opts),
+		size:    stat.Size(),
+		modTime: stat.ModTime().UnixNano(),
+	}
+	path := IndexPath(head.Path, field.Name, idx.Kind())
+	if err = loadIndex(path, head.Path, want, idx); err == nil {
+		return idx, nil
+	}
+	if idx, err = newIndex(kind, field.Name); err != nil {
+		return nil, err
+	}
+	if want.hash, err = buildIndex(idx, head.Path, i, field, opts); err != nil {
+		return nil, err
+	}
+	return idx, saveIndex(path, want, idx)
+}
+
+// buildIndex scans the CSV file and returns the checksum of its content.
+func buildIndex(idx Index, path string, column int, field Field, opts ReaderOptions) (uint32, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	hash := crc32.NewIEEE()
+	rd, err := NewReader(io.TeeReader(file, hash), opts)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = rd.Read(); err != nil && err != io.EOF {
+		return 0, err
+	}
+	for {
+		offset := rd.Offset()
+		record, err := rd.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if column >= len(record) {
+			continue
+		}
+		// fields that can't be parsed are NULL and NULL is never indexed
+		if key, err := field.Parse(record[column]); err == nil && !key.IsNull() {
+			idx.insert(key, offset)
+		}
+	}
+	// the reader may stop before the end of file
+	if _, err = io.Copy(hash, file); err != nil {
+		return 0, err
+	}
+	return hash.Sum32(), nil
+}
+
+func fileHash(path string) (uint32, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	hash := crc32.NewIEEE()
+	if _, err = io.Copy(hash, file); err != nil {
+		return 0, err
+	}
+	return hash.Sum32(), nil
+}
+
+var errStaleIndex = errors.New("index file is stale")
+
+func loadIndex(path, csvPath string, want indexHeader, idx Index) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	got, err := readIndexHeader(r)
+	if err != nil {
+		return err
+	}
+	hash := got.hash
+	got.hash = 0
+	if got != want {
+		return errStaleIndex
+	}
+	if want.hash, err = fileHash(csvPath); err != nil {
+		return err
+	}
+	if hash != want.hash {
+		return errStaleIndex
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	for ; n > 0; n-- {
+		key, err := readKey(r, want.keyType)
+		if err != nil {
+			return err
+		}
+		count, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		var offset int64
+		for ; count > 0; count-- {
+			delta, err := binary.ReadVarint(r)
+			if err != nil {
+				return err
+			}
+			offset += delta
+			idx.insert(key, offset)
+		}
+	}
+	return nil
+}
+
+// saveIndex writes the index to a temporary file and renames it, so a broken
+// index file is never left behind.
+func saveIndex(path string, h indexHeader, idx Index) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	writeIndexHeader(w, h)
+	writeUvarint(w, uint64(idx.Len()))
+	idx.each(func(key Value, offsets []int64) {
+		writeKey(w, key)
+		writeUvarint(w, uint64(len(offsets)))
+		var prev int64
+		for _, offset := range offsets {
+			writeVarint(w, offset-prev)
+			prev = offset
+		}
+	})
+	if err = w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func writeIndexHeader(w *bufio.Writer, h indexHeader) {
+	w.WriteString(indexMagic)
+	writeString(w, h.kind)
+	writeString(w, h.column)
+	writeUvarint(w, uint64(h.keyType))
+	writeString(w, h.layout)
+	writeString(w, h.dialect)
+	writeVarint(w, h.size)
+	writeVarint(w, h.modTime)
+	writeUvarint(w, uint64(h.hash))
+}
+
+func readIndexHeader(r *bufio.Reader) (h indexHeader, err error) {
+	magic := make([]byte, len(indexMagic))
+	if _, err = io.ReadFull(r, magic); err != nil {
+		return h, err
+	}
+	if string(magic) != indexMagic {
+		return h, fmt.Errorf("not an index file")
+	}
+	var keyType, hash uint64
+	for _, read := range []func() error{
+		func() (err error) { h.kind, err = readString(r); return err },
+		func() (err error) { h.column, err = readString(r); return err },
+		func() (err error) { keyType, err = binary.ReadUvarint(r); return err },
+		func() (err error) { h.layout, err = readString(r); return err },
+		func() (err error) { h.dialect, err = readString(r); return err },
+		func() (err error) { h.size, err = binary.ReadVarint(r); return err },
+		func() (err error) { h.modTime, err = binary.ReadVarint(r); return err },
+		func() (err error) { hash, err = binary.ReadUvarint(r); return err },
+	} {
+		if err = read(); err != nil {
+			return h, err
+		}
+	}
+	h.keyType, h.hash = Type(keyType), uint32(hash)
+	return h, nil
+}
+
+func writeUvarint(w *bufio.Writer, x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], x)])
+}
+
+func writeVarint(w *bufio.Writer, x int64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutVarint(buf[:], x)])
+}
+
+func writeString(w *bufio.Writer, s string) {
+	writeUvarint(w, uint64(len(s)))
+	w.WriteString(s)
+}
+
+func readString(r *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	_, err = io.ReadFull(r, buf)
+	return string(buf), err
+}
+
+func writeKey(w *bufio.Writer, key Value) {
+	switch key.Type {
+	case TypeInt:
+		writeVarint(w, key.Int)
+	case TypeFloat:
+		writeUvarint(w, math.Float64bits(key.Float))
+	case TypeBool:
+		if key.Bool {
+			writeUvarint(w, 1)
+		} else {
+			writeUvarint(w, 0)
+		}
+	case TypeDate:
+		writeVarint(w, key.Time.UnixNano())
+	default:
+		writeString(w, key.String())
+	}
+}
+
+func readKey(r *bufio.Reader, t Type) (Value, error) {
+	switch t {
+	case TypeInt:
+		i, err := binary.ReadVarint(r)
+		return IntValue(i), err
+	case TypeFloat:
+		u, err := binary.ReadUvarint(r)
+		return FloatValue(math.Float64frombits(u)), err
+	case TypeBool:
+		u, err := binary.ReadUvarint(r)
+		return BoolValue(u == 1), err
+	case TypeDate:
+		i, err := binary.ReadVarint(r)
+		return DateValue(time.Unix(0, i).UTC()), err
+	default:
+		s, err := readString(r)
+		return StringValue(s), err
+	}
+}
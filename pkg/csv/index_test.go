@@ -0,0 +1,151 @@
+package csv_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+const indexCSV = `name,age,city
+Ivan,41,Moscow
+Petr,25,"Saint
+Petersburg"
+Anna,33,Kazan
+Olga,,Moscow
+Oleg,41,Kazan
+`
+
+func indexHead(path string) *csv.Head {
+	return &csv.Head{Path: path, Fields: []csv.Field{
+		{Name: "name", Type: csv.TypeString},
+		{Name: "age", Type: csv.TypeInt},
+		{Name: "city", Type: csv.TypeString},
+	}}
+}
+
+func TestOpenIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csvq")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "people.csv")
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte(indexCSV), 0644)) {
+		return
+	}
+
+	idx, err := csv.OpenIndex(csv.IndexBTree, indexHead(path), "AGE", csv.ReaderOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "age", idx.Column())
+	assert.Equal(t, 3, idx.Len())
+	idxPath := csv.IndexPath(path, "age", csv.IndexBTree)
+	stat, err := os.Stat(idxPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// a valid index file is loaded, not rebuilt
+	idx, err = csv.OpenIndex(csv.IndexBTree, indexHead(path), "age", csv.ReaderOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, idx.Len())
+	again, _ := os.Stat(idxPath)
+	assert.Equal(t, stat.ModTime(), again.ModTime())
+
+	// the index is rebuilt after the file changes
+	assert.NoError(t, ioutil.WriteFile(path, []byte(indexCSV+"Igor,52,Omsk\n"), 0644))
+	later := time.Now().Add(time.Second)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	idx, err = csv.OpenIndex(csv.IndexBTree, indexHead(path), "age", csv.ReaderOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, idx.Len())
+
+	_, err = csv.OpenIndex(csv.IndexBTree, indexHead(path), "height", csv.ReaderOptions{})
+	assert.Error(t, err)
+	hash, err := csv.OpenIndex(csv.IndexHash, indexHead(path), "city", csv.ReaderOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, csv.IndexHash, hash.Kind())
+	assert.Equal(t, 4, hash.Len())
+	hash, err = csv.OpenIndex(csv.IndexHash, indexHead(path), "city", csv.ReaderOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, hash.Len())
+
+	_, err = csv.OpenIndex("bitmap", indexHead(path), "age", csv.ReaderOptions{})
+	assert.Error(t, err)
+}
+
+func TestPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csvq")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "people.csv")
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte(indexCSV), 0644)) {
+		return
+	}
+	head := indexHead(path)
+	age, err := csv.OpenIndex(csv.IndexBTree, head, "age", csv.ReaderOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	city, err := csv.OpenIndex(csv.IndexBTree, head, "city", csv.ReaderOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	name, err := csv.OpenIndex(csv.IndexHash, head, "name", csv.ReaderOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	indexes := []csv.Index{age, city, name}
+
+	// offsets of the records: Ivan 14, Petr 29, Anna 56, Olga 70, Oleg 83
+	tests := []struct {
+		where   string
+		offsets []int64
+		ok      bool
+	}{
+		{"age = 41", []int64{14, 83}, true},
+		{"41 = age", []int64{14, 83}, true},
+		{"age > 25", []int64{14, 56, 83}, true},
+		{"age >= 25 AND age < 41", []int64{29, 56}, true},
+		{"age = 41 AND city = 'Kazan'", []int64{83}, true},
+		{"age = 41 AND age = 25", []int64{}, true},
+		{"city = 'Moscow' AND name = 'Olga'", []int64{70}, true},
+		{"city < 'L'", []int64{56, 83}, true},
+		{"age = 41 OR city = 'Kazan'", nil, false},
+		{"name = 'Ivan'", []int64{14}, true},
+		{"name IN ('Oleg', 'Petr', 'Nobody')", []int64{29, 83}, true},
+		{"age IN (25, 33) AND city = 'Kazan'", []int64{56}, true},
+		{"age BETWEEN 25 AND 33", []int64{29, 56}, true},
+		{"age BETWEEN 25 AND 40 AND age > 25", []int64{56}, true},
+		{"age NOT BETWEEN 25 AND 33", nil, false},
+		{"name NOT IN ('Ivan')", nil, false},
+		{"name > 'O'", nil, false},
+		{"name IN ('Oleg', city)", nil, false},
+		{"city = 'moscow' COLLATE NOCASE", nil, false},
+		{"city = '10'", []int64{}, true},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		stmt, err := csv.ParseStatement(tt.where)
+		if !assert.NoError(t, err, tt.where) {
+			continue
+		}
+		q, err := csv.Prepare(stmt, head)
+		if !assert.NoError(t, err, tt.where) {
+			continue
+		}
+		offsets, ok := q.Plan(indexes)
+		assert.Equal(t, tt.ok, ok, tt.where)
+		if tt.ok {
+			assert.Equal(t, tt.offsets, offsets, tt.where)
+		}
+	}
+}
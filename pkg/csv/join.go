@@ -0,0 +1,462 @@
+package csv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Join strategies chosen by NewJoiner.
+const (
+	JoinHash   = "hash"
+	JoinMerge  = "merge"
+	JoinNested = "nested loop"
+)
+
+// JoinOptions sets the dialect of the joined files and the memory budget of the join:
+// a hash table is built when the smaller file fits into Sort.Memory, otherwise
+// both files are sorted by the join keys with spill to Sort.TempDir.
+type JoinOptions struct {
+	Reader ReaderOptions
+	Sort   SortOptions
+}
+
+// Joiner produces the records of a query with JOIN: a record of the left table
+// followed by a record of the right one, as described by Query.Head. A record of
+// a LEFT JOIN without a match has only the left fields, the right ones are NULL.
+type Joiner struct {
+	query       *Query
+	join        Join
+	left, right *Head
+	opts        JoinOptions
+	strategy    string
+	// buildLeft is set when the hash table is built of the left table
+	buildLeft bool
+	// leftKeys and rightKeys are the sides of equalities of ON, numeric is set
+	// for a key compared as a number because one of its sides is a number column
+	leftKeys, rightKeys []Expr
+	noCase, numeric     []bool
+}
+
+// joinEntry is a record kept in memory, matched is set when it is joined.
+type joinEntry struct {
+	record  []string
+	matched bool
+}
+
+// NewJoiner returns a joiner of the left and the right tables of q,
+// q must be prepared against JoinHeads(left, right).
+func NewJoiner(q *Query, left, right *Head, opts JoinOptions) (*Joiner, error) {
+	if len(q.Statement.Joins) != 1 {
+		return nil, fmt.Errorf("query must have one JOIN")
+	}
+	if opts.Sort.Memory <= 0 {
+		opts.Sort.Memory = DefaultSortMemory
+	}
+	j := &Joiner{query: q, join: q.Statement.Joins[0], left: left, right: right, opts: opts, strategy: JoinNested}
+	for _, cond := range conjuncts(j.join.On) {
+		j.addKey(cond)
+	}
+	if len(j.leftKeys) == 0 {
+		return j, nil
+	}
+	leftInfo, err := os.Stat(left.Path)
+	if err != nil {
+		return nil, err
+	}
+	rightInfo, err := os.Stat(right.Path)
+	if err != nil {
+		return nil, err
+	}
+	j.buildLeft = leftInfo.Size() < rightInfo.Size()
+	size := rightInfo.Size()
+	if j.buildLeft {
+		size = leftInfo.Size()
+	}
+	j.strategy = JoinMerge
+	if size <= opts.Sort.Memory {
+		j.strategy = JoinHash
+	}
+	return j, nil
+}
+
+// addKey takes an equality of ON comparing an expression of the left table
+// with an expression of the right one as a join key.
+func (j *Joiner) addKey(cond Expr) {
+	b, ok := cond.(*BinaryExpr)
+	if !ok || b.Op != "=" {
+		return
+	}
+	l, r := j.side(b.Left), j.side(b.Right)
+	switch {
+	case l == 1 && r == 2:
+		j.leftKeys, j.rightKeys = append(j.leftKeys, b.Left), append(j.rightKeys, b.Right)
+	case l == 2 && r == 1:
+		j.leftKeys, j.rightKeys = append(j.leftKeys, b.Right), append(j.rightKeys, b.Left)
+	default:
+		return
+	}
+	j.noCase = append(j.noCase, b.NoCase)
+	j.numeric = append(j.numeric, isNumber(exprType(b.Left)) || isNumber(exprType(b.Right)))
+}
+
+func isNumber(t Type) bool {
+	return t == TypeInt || t == TypeFloat
+}
+
+// side returns 1 if the expression refers only to the left table, 2 if only
+// to the right one and 0 otherwise.
+func (j *Joiner) side(e Expr) int {
+	side := 0
+	_ = walk(e, func(e Expr) error {
+		c, ok := e.(*ColumnRef)
+		if !ok {
+			return nil
+		}
+		s := 1
+		if c.Index >= len(j.left.Fields) {
+			s = 2
+		}
+		if side != 0 && side != s {
+			s = -1
+		}
+		side = s
+		return nil
+	})
+	if side < 0 {
+		return 0
+	}
+	return side
+}
+
+// Strategy returns the join algorithm: JoinHash, JoinMerge or JoinNested.
+func (j *Joiner) Strategy() string {
+	return j.strategy
+}
+
+// Run calls fn for the joined records until fn returns an error.
+// The record passed to fn may be kept by it.
+func (j *Joiner) Run(ctx context.Context, fn func(record []string) error) error {
+	switch j.strategy {
+	case JoinHash:
+		return j.hashJoin(ctx, fn)
+	case JoinMerge:
+		return j.mergeJoin(ctx, fn)
+	default:
+		return j.nestedLoop(ctx, fn)
+	}
+}
+
+// hashJoin builds a hash table of the smaller table and probes it with the records of the other one.
+func (j *Joiner) hashJoin(ctx context.Context, fn func(record []string) error) error {
+	build, probe := j.right, j.left
+	if j.buildLeft {
+		build, probe = j.left, j.right
+	}
+	table := map[string][]*joinEntry{}
+	var entries []*joinEntry
+	err := j.scan(ctx, build, func(record []string) error {
+		key, ok, err := j.key(record, j.buildLeft)
+		if err != nil {
+			return err
+		}
+		e := &joinEntry{record: record}
+		if j.buildLeft {
+			entries = append(entries, e)
+		}
+		if ok {
+			table[key] = append(table[key], e)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = j.scan(ctx, probe, func(record []string) error {
+		key, ok, err := j.key(record, !j.buildLeft)
+		if err != nil || !ok {
+			if err == nil && !j.buildLeft && j.join.Kind == "LEFT" {
+				err = fn(j.combine(record, nil))
+			}
+			return err
+		}
+		matched := false
+		for _, e := range table[key] {
+			l, r := record, e.record
+			if j.buildLeft {
+				l, r = e.record, record
+			}
+			ok, err := j.emit(l, r, fn)
+			if err != nil {
+				return err
+			}
+			matched, e.matched = matched || ok, e.matched || ok
+		}
+		if !matched && !j.buildLeft && j.join.Kind == "LEFT" {
+			return fn(j.combine(record, nil))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return j.unmatched(entries, fn)
+}
+
+// mergeJoin sorts both tables by the join keys and merges them.
+func (j *Joiner) mergeJoin(ctx context.Context, fn func(record []string) error) error {
+	left, err := j.sortTable(ctx, j.left, true, fn)
+	if left != nil {
+		defer left.Close()
+	}
+	if err != nil {
+		return err
+	}
+	right, err := j.sortTable(ctx, j.right, false, fn)
+	if right != nil {
+		defer right.Close()
+	}
+	if err != nil {
+		return err
+	}
+	lm, err := left.merge()
+	if err != nil {
+		return err
+	}
+	defer lm.close()
+	rm, err := right.merge()
+	if err != nil {
+		return err
+	}
+	defer rm.close()
+	return j.merge(ctx, lm, rm, fn)
+}
+
+// merge joins the sorted rows of the left table with the groups of the right rows having equal keys.
+func (j *Joiner) merge(ctx context.Context, lm, rm *merger, fn func(record []string) error) error {
+	l, lok, err := lm.next()
+	if err != nil {
+		return err
+	}
+	r, rok, err := rm.next()
+	if err != nil {
+		return err
+	}
+	// keys start with '{', so no key is equal to the empty one
+	var (
+		group    [][]string
+		groupKey string
+	)
+	for lok {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		key := l.values[0].Str
+		if key != groupKey {
+			for rok && r.values[0].Str < key {
+				if r, rok, err = rm.next(); err != nil {
+					return err
+				}
+			}
+			group, groupKey = group[:0], key
+			for rok && r.values[0].Str == key {
+				group = append(group, sortedRecord(r))
+				if r, rok, err = rm.next(); err != nil {
+					return err
+				}
+			}
+		}
+		record := sortedRecord(l)
+		matched := false
+		for _, right := range group {
+			ok, err := j.emit(record, right, fn)
+			if err != nil {
+				return err
+			}
+			matched = matched || ok
+		}
+		if !matched && j.join.Kind == "LEFT" {
+			if err = fn(j.combine(record, nil)); err != nil {
+				return err
+			}
+		}
+		if l, lok, err = lm.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortTable sorts the records of the table by the join key. Records of the left
+// table of LEFT JOIN with a NULL key can't match, they are passed to fn at once.
+func (j *Joiner) sortTable(ctx context.Context, head *Head, left bool, fn func(record []string) error) (*Sorter, error) {
+	q := &Query{Statement: &Statement{}, order: []orderKey{{column: 0}}}
+	sorter := NewSorter(q, j.opts.Sort)
+	err := j.scan(ctx, head, func(record []string) error {
+		key, ok, err := j.key(record, left)
+		if err != nil || !ok {
+			if err == nil && left && j.join.Kind == "LEFT" {
+				err = fn(j.combine(record, nil))
+			}
+			return err
+		}
+		values := make([]Value, len(record)+1)
+		values[0] = StringValue(key)
+		for i, field := range record {
+			values[i+1] = StringValue(field)
+		}
+		return sorter.Add(nil, values)
+	})
+	return sorter, err
+}
+
+// sortedRecord returns the fields of a record sorted by sortTable.
+func sortedRecord(row sortRow) []string {
+	record := make([]string, len(row.values)-1)
+	for i, v := range row.values[1:] {
+		record[i] = v.Str
+	}
+	return record
+}
+
+// nestedLoop joins blocks of the left table fitting into memory with every record of the right one,
+// it is used for CROSS JOIN and conditions without equalities.
+func (j *Joiner) nestedLoop(ctx context.Context, fn func(record []string) error) error {
+	var (
+		block []*joinEntry
+		size  int64
+	)
+	flush := func() error {
+		err := j.scan(ctx, j.right, func(record []string) error {
+			for _, e := range block {
+				ok, err := j.emit(e.record, record, fn)
+				if err != nil {
+					return err
+				}
+				e.matched = e.matched || ok
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = j.unmatched(block, fn)
+		block, size = block[:0], 0
+		return err
+	}
+	err := j.scan(ctx, j.left, func(record []string) error {
+		block = append(block, &joinEntry{record: record})
+		if size += recordSize(record); size > j.opts.Sort.Memory {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil || len(block) == 0 {
+		return err
+	}
+	return flush()
+}
+
+// unmatched passes the left records without a match to fn for LEFT JOIN.
+func (j *Joiner) unmatched(entries []*joinEntry, fn func(record []string) error) error {
+	if j.join.Kind != "LEFT" {
+		return nil
+	}
+	for _, e := range entries {
+		if e.matched {
+			continue
+		}
+		if err := fn(j.combine(e.record, nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emit passes the combined record to fn if it satisfies ON.
+func (j *Joiner) emit(left, right []string, fn func(record []string) error) (bool, error) {
+	record := j.combine(left, right)
+	if j.join.On != nil {
+		v, err := evalBool(j.join.On, &Row{Head: j.query.Head, Values: record})
+		if err != nil || v.IsNull() || !v.Bool {
+			return false, err
+		}
+	}
+	return true, fn(record)
+}
+
+// combine returns the left record padded to the fields of the left table followed by the right one.
+func (j *Joiner) combine(left, right []string) []string {
+	n := len(j.left.Fields)
+	record := make([]string, n, n+len(right))
+	copy(record, left)
+	return append(record, right...)
+}
+
+// key encodes the values of the join keys for a record of the left or the right
+// table, ok is false if a key is NULL and so matches nothing. Keys are compared
+// the way = compares them: numbers as numbers, so 1 and '1.0' have the same key
+// if a side is a number, two strings as text.
+func (j *Joiner) key(record []string, left bool) (key string, ok bool, err error) {
+	exprs := j.rightKeys
+	row := &Row{Head: j.query.Head, Values: j.combine(nil, record)}
+	if left {
+		exprs, row.Values = j.leftKeys, record
+	}
+	var b strings.Builder
+	for i, e := range exprs {
+		v, err := e.eval(row)
+		if err != nil || v.IsNull() {
+			return "", false, err
+		}
+		if f, isNum := v.number(); isNum && (j.numeric[i] || isNumber(v.Type)) {
+			v = FloatValue(f)
+		} else if j.noCase[i] {
+			v = foldCase(v)
+		}
+		fmt.Fprintf(&b, "%v\x00", newHashKey(v))
+	}
+	return b.String(), true, nil
+}
+
+// scan calls fn for the records of the table following the header.
+func (j *Joiner) scan(ctx context.Context, head *Head, fn func(record []string) error) error {
+	file, err := os.Open(head.Path)
+	if err != nil {
+		return fmt.Errorf("file open error: %w", err)
+	}
+	defer file.Close()
+	reader, err := NewReader(file, j.opts.Reader)
+	if err != nil {
+		return err
+	}
+	for header := true; ; header = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", head.Path, err)
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if header {
+			continue
+		}
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// recordSize estimates the memory taken by the record.
+func recordSize(record []string) int64 {
+	size := int64(24)
+	for _, field := range record {
+		size += 16 + int64(len(field))
+	}
+	return size
+}
@@ -0,0 +1,171 @@
+package csv_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	joinPeople = "name,city_id\nIvan,1\nPetr,2\nAnna,\nOlga,1.0\nOleg,9\n"
+	joinCities = "id,city\n1,Moscow\n2,Kazan\n3,Omsk\n2,Kazan2\n"
+)
+
+// joined runs the query over people.csv AS p and cities.csv AS c and returns
+// the sorted result rows joined with '|'.
+func joined(t *testing.T, dir, query string, opts csv.JoinOptions) ([]string, string) {
+	t.Helper()
+	left := &csv.Head{Path: filepath.Join(dir, "people.csv"), Fields: []csv.Field{
+		{Name: "name", Type: csv.TypeString}, {Name: "city_id", Type: csv.TypeFloat},
+	}}
+	right := &csv.Head{Path: filepath.Join(dir, "cities.csv"), Fields: []csv.Field{
+		{Name: "id", Type: csv.TypeInt}, {Name: "city", Type: csv.TypeString},
+	}}
+	left.Qualify("p")
+	right.Qualify("c")
+	head := csv.JoinHeads(left, right)
+	stmt, err := csv.ParseStatement(query)
+	if !assert.NoError(t, err, query) {
+		return nil, ""
+	}
+	q, err := csv.Prepare(stmt, head)
+	if !assert.NoError(t, err, query) {
+		return nil, ""
+	}
+	j, err := csv.NewJoiner(q, left, right, opts)
+	if !assert.NoError(t, err, query) {
+		return nil, ""
+	}
+	var rows []string
+	err = j.Run(context.Background(), func(record []string) error {
+		row := head.NewRow()
+		row.Values = record
+		ok, err := q.Match(row)
+		if err != nil || !ok {
+			return err
+		}
+		values, err := q.Project(row)
+		if err != nil {
+			return err
+		}
+		fields := make([]string, len(values))
+		for i, v := range values {
+			fields[i] = v.String()
+		}
+		rows = append(rows, strings.Join(fields, "|"))
+		return nil
+	})
+	assert.NoError(t, err, query)
+	sort.Strings(rows)
+	return rows, j.Strategy()
+}
+
+func TestJoiner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csvq")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "people.csv"), []byte(joinPeople), 0o600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cities.csv"), []byte(joinCities), 0o600))
+
+	inner := []string{"Ivan|Moscow", "Olga|Moscow", "Petr|Kazan", "Petr|Kazan2"}
+	left := []string{"Anna|", "Ivan|Moscow", "Oleg|", "Olga|Moscow", "Petr|Kazan", "Petr|Kazan2"}
+	spill := csv.JoinOptions{Sort: csv.SortOptions{Memory: 1, TempDir: dir}}
+	tests := []struct {
+		query    string
+		opts     csv.JoinOptions
+		strategy string
+		want     []string
+	}{
+		{"SELECT p.name, c.city FROM people AS p JOIN cities AS c ON p.city_id = c.id", csv.JoinOptions{}, csv.JoinHash, inner},
+		{"SELECT name, city FROM people AS p INNER JOIN cities AS c ON c.id = p.city_id", spill, csv.JoinMerge, inner},
+		{"SELECT p.name, c.city FROM people AS p LEFT JOIN cities AS c ON p.city_id = c.id", csv.JoinOptions{}, csv.JoinHash, left},
+		{"SELECT p.name, c.city FROM people AS p LEFT OUTER JOIN cities AS c ON p.city_id = c.id", spill, csv.JoinMerge, left},
+		{"SELECT name, city FROM people AS p JOIN cities AS c ON p.city_id = c.id AND c.city <> 'Kazan2'", spill, csv.JoinMerge,
+			[]string{"Ivan|Moscow", "Olga|Moscow", "Petr|Kazan"}},
+		{"SELECT name, city FROM people AS p JOIN cities AS c ON p.city_id = c.id WHERE city = 'moscow' COLLATE NOCASE",
+			csv.JoinOptions{}, csv.JoinHash, []string{"Ivan|Moscow", "Olga|Moscow"}},
+		{"SELECT p.name, c.id FROM people AS p LEFT JOIN cities AS c ON p.city_id > c.id", spill, csv.JoinNested,
+			[]string{"Anna|", "Oleg|1", "Oleg|2", "Oleg|2", "Oleg|3", "Olga|", "Petr|1", "Ivan|"}},
+		{"SELECT c.city FROM people AS p CROSS JOIN cities AS c WHERE p.name = 'Ivan'", spill, csv.JoinNested,
+			[]string{"Kazan", "Kazan2", "Moscow", "Omsk"}},
+	}
+	for _, tt := range tests {
+		got, strategy := joined(t, dir, tt.query, tt.opts)
+		want := append([]string(nil), tt.want...)
+		sort.Strings(want)
+		assert.Equal(t, want, got, tt.query)
+		assert.Equal(t, tt.strategy, strategy, tt.query)
+	}
+}
+
+func TestJoinColumns(t *testing.T) {
+	left := &csv.Head{Fields: csv.NewFields([]string{"id", "name"})}
+	right := &csv.Head{Fields: csv.NewFields([]string{"id", "city"})}
+	left.Qualify("a")
+	right.Qualify("b")
+	head := csv.JoinHeads(left, right)
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"SELECT a.id, b.id, name, city FROM x AS a JOIN y AS b ON a.id = b.id", ""},
+		{"SELECT a.*, b.city FROM x AS a JOIN y AS b ON a.id = b.id", ""},
+		{"SELECT id FROM x AS a JOIN y AS b ON a.id = b.id", `column "id" is ambiguous`},
+		{"SELECT c.id FROM x AS a JOIN y AS b ON a.id = b.id", `unknown column "c.id"`},
+		{"SELECT c.* FROM x AS a JOIN y AS b ON a.id = b.id", `unknown table "c"`},
+		{"SELECT * FROM x AS a JOIN y AS b ON a.id = b.id JOIN z ON a.id = z.id", "only one JOIN"},
+	}
+	for _, tt := range tests {
+		stmt, err := csv.ParseStatement(tt.query)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		_, err = csv.Prepare(stmt, head)
+		if tt.err == "" {
+			assert.NoError(t, err, tt.query)
+		} else if assert.Error(t, err, tt.query) {
+			assert.Contains(t, err.Error(), tt.err, tt.query)
+		}
+	}
+}
+
+func TestJoinColumnNames(t *testing.T) {
+	left := &csv.Head{Fields: csv.NewFields([]string{"id", "name"})}
+	right := &csv.Head{Fields: csv.NewFields([]string{"id", "city"})}
+	left.Qualify("a")
+	right.Qualify("b")
+	head := csv.JoinHeads(left, right)
+	tests := []struct {
+		query string
+		names []string
+	}{
+		{"SELECT * FROM x AS a JOIN y AS b ON a.id = b.id", []string{"a.id", "name", "b.id", "city"}},
+		{"SELECT a.id, b.id, city FROM x AS a JOIN y AS b ON a.id = b.id ORDER BY b.id", []string{"a.id", "b.id", "city"}},
+		{"SELECT b.*, a.name FROM x AS a JOIN y AS b ON a.id = b.id", []string{"id", "city", "name"}},
+		{"SELECT a.id, b.id AS bid FROM x AS a JOIN y AS b ON a.id = b.id", []string{"id", "bid"}},
+	}
+	for _, tt := range tests {
+		stmt, err := csv.ParseStatement(tt.query)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		q, err := csv.Prepare(stmt, head)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		var names []string
+		for _, column := range q.Columns {
+			names = append(names, column.Name)
+		}
+		assert.Equal(t, tt.names, names, tt.query)
+	}
+}
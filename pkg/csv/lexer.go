@@ -0,0 +1,168 @@
+package csv
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+// token is a lexical unit of a query. Text is the raw source of the token,
+// Val is its meaning: unquoted string or identifier, upper-cased operator.
+type token struct {
+	Kind tokenKind
+	Text string
+	Val  string
+	Pos  int
+	End  int
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+// lex splits the whole query into tokens, the last one is always tokEOF.
+func lex(src string) ([]token, error) {
+	l := &lexer{src: src}
+	var toks []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		toks = append(toks, tok)
+		if tok.Kind == tokEOF {
+			return toks, nil
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipSpaces()
+	if l.pos >= len(l.src) {
+		return token{Kind: tokEOF, Pos: l.pos, End: l.pos}, nil
+	}
+	start := l.pos
+	r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+	switch {
+	case r == '\'' || r == '"':
+		return l.quoted(tokString, byte(r))
+	case r == '`':
+		return l.quoted(tokQuotedIdent, '`')
+	case isDigit(r) || r == '.' && l.pos+1 < len(l.src) && isDigit(rune(l.src[l.pos+1])):
+		return l.number(), nil
+	case isIdentStart(r):
+		for l.pos < len(l.src) {
+			r, size = utf8.DecodeRuneInString(l.src[l.pos:])
+			if !isIdentPart(r) {
+				break
+			}
+			l.pos += size
+		}
+		text := l.src[start:l.pos]
+		return token{Kind: tokIdent, Text: text, Val: text, Pos: start, End: l.pos}, nil
+	}
+	if op := l.operator(); op != "" {
+		return token{Kind: tokOp, Text: op, Val: strings.ToUpper(op), Pos: start, End: l.pos}, nil
+	}
+	return token{}, &SyntaxError{Pos: start, Token: string(r)}
+}
+
+func (l *lexer) skipSpaces() {
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		l.pos += size
+	}
+}
+
+// quoted reads a string or an identifier enclosed in quote,
+// a doubled quote inside stands for the quote itself.
+func (l *lexer) quoted(kind tokenKind, quote byte) (token, error) {
+	start := l.pos
+	l.pos++
+	var val strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		l.pos++
+		if c != quote {
+			val.WriteByte(c)
+			continue
+		}
+		if l.pos < len(l.src) && l.src[l.pos] == quote {
+			val.WriteByte(quote)
+			l.pos++
+			continue
+		}
+		return token{Kind: kind, Text: l.src[start:l.pos], Val: val.String(), Pos: start, End: l.pos}, nil
+	}
+	return token{}, &SyntaxError{Pos: len(l.src), Expected: "closing " + string(quote)}
+}
+
+func (l *lexer) number() token {
+	start := l.pos
+	digits := func() {
+		for l.pos < len(l.src) && isDigit(rune(l.src[l.pos])) {
+			l.pos++
+		}
+	}
+	digits()
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		l.pos++
+		digits()
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		exp := l.pos
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		if l.pos < len(l.src) && isDigit(rune(l.src[l.pos])) {
+			digits()
+		} else {
+			l.pos = exp
+		}
+	}
+	text := l.src[start:l.pos]
+	return token{Kind: tokNumber, Text: text, Val: text, Pos: start, End: l.pos}
+}
+
+var operators = []string{
+	"!~*", "!~", "~*", "<=", ">=", "<>", "!=", "==", "~",
+	"=", "<", ">", "!", "(", ")", ",", ".", "+", "-", "*", "/", "%",
+}
+
+func (l *lexer) operator() string {
+	for _, op := range operators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return op
+		}
+	}
+	return ""
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,154 @@
+package csv
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// LikeExpr matches the text of X with Pattern, where % stands for any sequence
+// of characters and _ for a single one. A character following Escape is taken
+// literally. NoCase makes the match case-insensitive, it is set by bind.
+type LikeExpr struct {
+	X, Pattern Expr
+	// Escape is nil without ESCAPE
+	Escape Expr
+	Offset int
+	NoCase bool
+	// pattern is compiled by bind if Pattern and Escape are literals
+	pattern *likePattern
+}
+
+func (e *LikeExpr) Pos() int { return e.Offset }
+
+func (e *LikeExpr) String() string {
+	s := "(" + e.X.String() + " LIKE " + e.Pattern.String()
+	if e.Escape != nil {
+		s += " ESCAPE " + e.Escape.String()
+	}
+	return s + ")"
+}
+
+func (e *LikeExpr) eval(row *Row) (Value, error) {
+	x, err := e.X.eval(row)
+	if err != nil || x.IsNull() {
+		return Null, err
+	}
+	pattern := e.pattern
+	if pattern == nil {
+		p, err := e.Pattern.eval(row)
+		if err != nil || p.IsNull() {
+			return Null, err
+		}
+		escape := Null
+		if e.Escape != nil {
+			if escape, err = e.Escape.eval(row); err != nil || escape.IsNull() {
+				return Null, err
+			}
+		}
+		if pattern, err = compileLike(p.String(), escape, e.NoCase); err != nil {
+			return Null, fmt.Errorf("LIKE at position %d: %w", e.Offset, err)
+		}
+	}
+	s := x.String()
+	if e.NoCase {
+		s = strings.ToLower(s)
+	}
+	return BoolValue(pattern.match([]rune(s))), nil
+}
+
+// compile compiles a literal pattern once.
+func (e *LikeExpr) compile() error {
+	p, ok := literal(e.Pattern)
+	if !ok || p.IsNull() {
+		return nil
+	}
+	escape := Null
+	if e.Escape != nil {
+		if escape, ok = literal(e.Escape); !ok {
+			return nil
+		}
+	}
+	pattern, err := compileLike(p.String(), escape, e.NoCase)
+	if err != nil {
+		return fmt.Errorf("LIKE at position %d: %w", e.Offset, err)
+	}
+	e.pattern = pattern
+	return nil
+}
+
+// literal returns the value of a literal operand.
+func literal(e Expr) (Value, bool) {
+	if c, ok := e.(*CollateExpr); ok {
+		e = c.X
+	}
+	lit, ok := e.(*Literal)
+	if !ok {
+		return Null, false
+	}
+	return lit.Value, true
+}
+
+// likePattern is a compiled LIKE pattern: runes with wildcards marked in any.
+type likePattern struct {
+	runes []rune
+	// any is '%' or '_' for a wildcard and 0 for a literal rune
+	any []rune
+}
+
+// compileLike compiles the pattern, escape is NULL or a single character.
+func compileLike(pattern string, escape Value, noCase bool) (*likePattern, error) {
+	esc := rune(-1)
+	if !escape.IsNull() {
+		s := escape.String()
+		if utf8.RuneCountInString(s) != 1 {
+			return nil, fmt.Errorf("ESCAPE must be a single character, got %q", s)
+		}
+		esc, _ = utf8.DecodeRuneInString(s)
+	}
+	if noCase {
+		pattern = strings.ToLower(pattern)
+	}
+	p := &likePattern{}
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		r, wildcard := runes[i], rune(0)
+		switch {
+		case r == esc:
+			if i++; i == len(runes) {
+				return nil, fmt.Errorf("pattern %q ends with the escape character", pattern)
+			}
+			r = runes[i]
+		case r == '%' || r == '_':
+			wildcard = r
+		}
+		p.runes, p.any = append(p.runes, r), append(p.any, wildcard)
+	}
+	return p, nil
+}
+
+// match reports whether the pattern matches the whole text. After a mismatch
+// it backtracks to the last %, making it consume one more rune.
+func (p *likePattern) match(text []rune) bool {
+	i, j := 0, 0
+	star, mark := -1, 0
+	for i < len(text) {
+		switch {
+		case j < len(p.runes) && p.any[j] == '%':
+			star, mark = j, i
+			j++
+		case j < len(p.runes) && (p.any[j] == '_' || p.runes[j] == text[i]):
+			i++
+			j++
+		case star >= 0:
+			mark++
+			i, j = mark, star+1
+		default:
+			return false
+		}
+	}
+	for j < len(p.runes) && p.any[j] == '%' {
+		j++
+	}
+	return j == len(p.runes)
+}
@@ -0,0 +1,64 @@
+package csv_test
+
+import (
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLike(t *testing.T) {
+	head := &csv.Head{Fields: []csv.Field{{Name: "s", Type: csv.TypeString}, {Name: "p", Type: csv.TypeString}}}
+	tests := []struct {
+		s, query string
+		want     bool
+	}{
+		{"Afghanistan", "s LIKE 'A%'", true},
+		{"Afghanistan", "s LIKE '%stan'", true},
+		{"Afghanistan", "s LIKE '%g%n%'", true},
+		{"Afghanistan", "s LIKE 'A%z%'", false},
+		{"Afghanistan", "s LIKE 'a%'", false},
+		{"Oman", "s LIKE '_man'", true},
+		{"Oman", "s LIKE '__man'", false},
+		{"Oman", "s LIKE '%'", true},
+		{"", "s LIKE '%'", false},
+		{"Côte d'Ivoire", "s LIKE 'C_te%'", true},
+		{"100%", "s LIKE '%!%' ESCAPE '!'", true},
+		{"100", "s LIKE '%!%' ESCAPE '!'", false},
+		{"a_b", "s LIKE 'a\\_b' ESCAPE '\\'", true},
+		{"axb", "s LIKE 'a\\_b' ESCAPE '\\'", false},
+		{"a!b", "s LIKE 'a!!b' ESCAPE '!'", true},
+		{"aaab", "s LIKE '%a%ab'", true},
+		{"Kazan", "s LIKE p", true},
+		{"Kazan", "s NOT LIKE p", false},
+	}
+	for _, tt := range tests {
+		pred, err := csv.Compile(tt.query, head)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		row := head.NewRow()
+		row.Values = []string{tt.s, "K%n"}
+		got, err := pred(row)
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.want, got, tt.s+" "+tt.query)
+	}
+
+	noCase := &csv.Head{Fields: head.Fields, IgnoreCase: true}
+	pred, err := csv.Compile("s LIKE 'afg%'", noCase)
+	if assert.NoError(t, err) {
+		row := noCase.NewRow()
+		row.Values = []string{"Afghanistan", ""}
+		got, err := pred(row)
+		assert.NoError(t, err)
+		assert.True(t, got)
+	}
+
+	pred, err = csv.Compile("s LIKE 'a' ESCAPE p", head)
+	if assert.NoError(t, err) {
+		row := head.NewRow()
+		row.Values = []string{"a", "xy"}
+		_, err = pred(row)
+		assert.Error(t, err)
+	}
+}
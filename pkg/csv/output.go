@@ -0,0 +1,89 @@
+package csv
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// formatExts are the formats of output files by extension.
+var formatExts = map[string]string{
+	".txt": FormatTable, ".csv": FormatCSV, ".tsv": FormatTSV, ".tab": FormatTSV, ".json": FormatJSON,
+	".ndjson": FormatNDJSON, ".jsonl": FormatNDJSON, ".md": FormatMarkdown, ".markdown": FormatMarkdown,
+}
+
+// FormatOf returns the format of the file by its extension, a .gz one is skipped:
+// out.csv.gz is csv. It is empty if the extension is unknown.
+func FormatOf(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".gz" {
+		ext = strings.ToLower(filepath.Ext(strings.TrimSuffix(path, filepath.Ext(path))))
+	}
+	return formatExts[ext]
+}
+
+// OutputFile is a file the result is written to. It is written to a temporary
+// file in the same directory, renamed to the path by Commit and removed by Abort,
+// so the file at the path is either the old one or the complete new one.
+// A path ending with .gz is compressed by gzip.
+type OutputFile struct {
+	path string
+	tmp  *os.File
+	gz   *gzip.Writer
+}
+
+// CreateOutput starts writing the file at path.
+func CreateOutput(path string) (*OutputFile, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	f := &OutputFile{path: path, tmp: tmp}
+	if strings.EqualFold(filepath.Ext(path), ".gz") {
+		f.gz = gzip.NewWriter(tmp)
+	}
+	return f, nil
+}
+
+// Path returns the path the file is renamed to.
+func (f *OutputFile) Path() string {
+	return f.path
+}
+
+func (f *OutputFile) Write(p []byte) (int, error) {
+	if f.gz != nil {
+		return f.gz.Write(p)
+	}
+	return f.tmp.Write(p)
+}
+
+// Commit completes the file and replaces the file at the path with it.
+func (f *OutputFile) Commit() error {
+	if f.gz != nil {
+		if err := f.gz.Close(); err != nil {
+			f.Abort()
+			return err
+		}
+	}
+	// os.CreateTemp makes the file readable by the owner only
+	if err := f.tmp.Chmod(0o644); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.tmp.Close(); err != nil {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+	if err := os.Rename(f.tmp.Name(), f.path); err != nil {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort removes the temporary file leaving the file at the path as it was.
+func (f *OutputFile) Abort() {
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+}
@@ -0,0 +1,90 @@
+package csv_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]string{
+		"out.csv": csv.FormatCSV, "dir/OUT.JSON": csv.FormatJSON, "out.jsonl.gz": csv.FormatNDJSON,
+		"out.md": csv.FormatMarkdown, "out.tsv.GZ": csv.FormatTSV, "out.txt": csv.FormatTable,
+		"out": "", "out.gz": "", "out.xlsx": "",
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, csv.FormatOf(path), path)
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csvq")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.csv")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("old\n"), 0644))
+
+	f, err := csv.CreateOutput(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = f.Write([]byte("new\n"))
+	assert.NoError(t, err)
+	got, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "old\n", string(got), "the file is replaced on commit only")
+	assert.NoError(t, f.Commit())
+	got, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "new\n", string(got))
+
+	f, err = csv.CreateOutput(path)
+	if assert.NoError(t, err) {
+		_, err = f.Write([]byte("partial"))
+		assert.NoError(t, err)
+		f.Abort()
+	}
+	got, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "new\n", string(got))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1, "temporary files are removed")
+
+	_, err = csv.CreateOutput(filepath.Join(dir, "missing", "out.csv"))
+	assert.Error(t, err)
+}
+
+func TestOutputFileGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csvq")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.ndjson.gz")
+	f, err := csv.CreateOutput(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	w, err := csv.NewRowWriter(csv.FormatOf(path), f, []csv.Field{{Name: "n", Type: csv.TypeInt}})
+	if assert.NoError(t, err) {
+		assert.NoError(t, w.WriteRow([]csv.Value{csv.IntValue(1)}))
+		assert.NoError(t, w.Flush())
+	}
+	assert.NoError(t, f.Commit())
+
+	file, err := os.Open(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+	r, err := gzip.NewReader(file)
+	if assert.NoError(t, err) {
+		got, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"n":1}`+"\n", string(got))
+	}
+}
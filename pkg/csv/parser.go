@@ -0,0 +1,612 @@
+package csv
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SyntaxError describes a query that can't be parsed.
+// Pos is the byte offset of the offending Token in the query.
+type SyntaxError struct {
+	Pos      int
+	Token    string
+	Expected string
+}
+
+func (e *SyntaxError) Error() string {
+	tok := "end of query"
+	if e.Token != "" {
+		tok = strconv.Quote(e.Token)
+	}
+	if e.Expected == "" {
+		return fmt.Sprintf("syntax error at position %d: unexpected %s", e.Pos, tok)
+	}
+	return fmt.Sprintf("syntax error at position %d: unexpected %s, expected %s", e.Pos, tok, e.Expected)
+}
+
+// Caret returns the line of the query with the offending character, prefixed by
+// its line and column counted from 1, and a caret under the character on the next
+// line. The end of the query is shown right after its last token.
+func (e *SyntaxError) Caret(query string) string {
+	pos := e.Pos
+	if pos > len(query) {
+		pos = len(query)
+	}
+	if e.Token == "" {
+		pos = len(strings.TrimRight(query[:pos], " \t\r\n"))
+	}
+	start := strings.LastIndexByte(query[:pos], '\n') + 1
+	end := len(query)
+	if i := strings.IndexByte(query[pos:], '\n'); i >= 0 {
+		end = pos + i
+	}
+	line := strings.Count(query[:start], "\n") + 1
+	column := utf8.RuneCountInString(query[start:pos]) + 1
+	prefix := fmt.Sprintf("%d:%d: ", line, column)
+	return prefix + strings.TrimSuffix(query[start:end], "\r") + "\n" + strings.Repeat(" ", len(prefix)+column-1) + "^"
+}
+
+type parser struct {
+	src  string
+	toks []token
+	i    int
+}
+
+// Parse builds the expression tree of a condition like
+//
+//	continent = 'Asia' AND (date > '2020-04-14' OR NOT iso_code = 'RUS')
+//
+// A blank query gives a nil expression. Errors are of type *SyntaxError.
+func Parse(query string) (Expr, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+	toks, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: query, toks: toks}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.Kind != tokEOF {
+		return nil, p.unexpected(tok, "AND, OR or end of query")
+	}
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	tok := p.toks[p.i]
+	if tok.Kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// isKeyword reports whether tok is the unquoted keyword kw.
+func isKeyword(tok token, kw string) bool {
+	return tok.Kind == tokIdent && strings.EqualFold(tok.Val, kw)
+}
+
+func isOp(tok token, ops ...string) bool {
+	if tok.Kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if tok.Val == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expectOp(op string) error {
+	if tok := p.next(); !isOp(tok, op) {
+		return p.unexpected(tok, "'"+op+"'")
+	}
+	return nil
+}
+
+func (p *parser) unexpected(tok token, expected string) error {
+	return &SyntaxError{Pos: tok.Pos, Token: tok.Text, Expected: expected}
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.peek(), "OR") {
+		tok := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "OR", Left: left, Right: right, Offset: tok.Pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.peek(), "AND") {
+		tok := p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "AND", Left: left, Right: right, Offset: tok.Pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if tok := p.peek(); isKeyword(tok, "NOT") || isOp(tok, "!") {
+		p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "NOT", X: x, Offset: tok.Pos}, nil
+	}
+	return p.parseComparison()
+}
+
+// comparisonOps maps the spelling of a comparison to its canonical form.
+var comparisonOps = map[string]string{
+	"=": "=", "==": "=", "<>": "<>", "!=": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">=",
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	switch {
+	case isKeyword(tok, "IS"):
+		p.next()
+		return p.parseIsNull(left, tok.Pos)
+	case isKeyword(tok, "NOT") && isPredicate(p.toks[p.i+1]):
+		p.next()
+		x, err := p.parsePredicate(left)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "NOT", X: x, Offset: tok.Pos}, nil
+	case isPredicate(tok):
+		return p.parsePredicate(left)
+	case isOp(tok, "~", "~*", "!~", "!~*"):
+		p.next()
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err = checkRegexp(pattern); err != nil {
+			return nil, err
+		}
+		op := strings.TrimPrefix(tok.Val, "!")
+		x := &RegexpExpr{X: left, Pattern: pattern, Op: op, Offset: tok.Pos}
+		if op == tok.Val {
+			return x, nil
+		}
+		return &UnaryExpr{Op: "NOT", X: x, Offset: tok.Pos}, nil
+	}
+	op, ok := comparisonOps[tok.Val]
+	if tok.Kind != tokOp || !ok {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryExpr{Op: op, Left: left, Right: right, Offset: tok.Pos}, nil
+}
+
+// isPredicate reports whether tok starts IN, BETWEEN, LIKE or REGEXP, which may follow NOT.
+func isPredicate(tok token) bool {
+	return isKeyword(tok, "IN") || isKeyword(tok, "BETWEEN") || isKeyword(tok, "LIKE") || isKeyword(tok, "REGEXP")
+}
+
+// parsePredicate parses x IN (...), x BETWEEN a AND b, x LIKE pattern [ESCAPE c] or x REGEXP pattern.
+func (p *parser) parsePredicate(x Expr) (Expr, error) {
+	tok := p.next()
+	switch {
+	case isKeyword(tok, "IN"):
+		return p.parseIn(x, tok.Pos)
+	case isKeyword(tok, "BETWEEN"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if and := p.next(); !isKeyword(and, "AND") {
+			return nil, p.unexpected(and, "AND")
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{X: x, Low: low, High: high, Offset: tok.Pos}, nil
+	case isKeyword(tok, "REGEXP"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &RegexpExpr{X: x, Pattern: pattern, Op: "REGEXP", Offset: tok.Pos}, checkRegexp(pattern)
+	default:
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		like := &LikeExpr{X: x, Pattern: pattern, Offset: tok.Pos}
+		if isKeyword(p.peek(), "ESCAPE") {
+			p.next()
+			if like.Escape, err = p.parseAdditive(); err != nil {
+				return nil, err
+			}
+		}
+		return like, nil
+	}
+}
+
+// parseIsNull parses the rest of x IS [NOT] NULL.
+func (p *parser) parseIsNull(x Expr, pos int) (Expr, error) {
+	e := &IsNullExpr{X: x, Offset: pos}
+	if isKeyword(p.peek(), "NOT") {
+		p.next()
+		e.Not = true
+	}
+	if tok := p.next(); !isKeyword(tok, "NULL") {
+		return nil, p.unexpected(tok, "NULL")
+	}
+	return e, nil
+}
+
+// parseIn parses the list of x IN (a, b, ...).
+func (p *parser) parseIn(x Expr, pos int) (Expr, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	in := &InExpr{X: x, Offset: pos}
+	for {
+		item, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		in.List = append(in.List, item)
+		tok := p.next()
+		if isOp(tok, ")") {
+			return in, nil
+		}
+		if !isOp(tok, ",") {
+			return nil, p.unexpected(tok, "',' or ')'")
+		}
+	}
+}
+
+func (p *parser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for isOp(p.peek(), "+", "-") {
+		tok := p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: tok.Val, Left: left, Right: right, Offset: tok.Pos}
+	}
+	return left, nil
+}
+
+// multiplicativeOps maps the spelling of a multiplicative operator to its canonical form.
+var multiplicativeOps = map[string]string{"*": "*", "/": "/", "DIV": "DIV", "MOD": "MOD", "%": "MOD"}
+
+func (p *parser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		op, ok := multiplicativeOps[strings.ToUpper(tok.Val)]
+		if !ok || tok.Kind != tokOp && !isKeyword(tok, op) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: op, Left: left, Right: right, Offset: tok.Pos}
+	}
+}
+
+// parseUnary parses a sign before an operand, the sign of a number is a part of the literal.
+func (p *parser) parseUnary() (Expr, error) {
+	tok := p.peek()
+	if !isOp(tok, "-", "+") {
+		return p.parseCollate()
+	}
+	p.next()
+	if num := p.peek(); num.Kind == tokNumber {
+		p.next()
+		num.Val, num.Pos = tok.Val+num.Val, tok.Pos
+		return parseNumber(num)
+	}
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &UnaryExpr{Op: tok.Val, X: x, Offset: tok.Pos}, nil
+}
+
+// parseCollate parses an operand with optional COLLATE NOCASE or COLLATE BINARY.
+func (p *parser) parseCollate() (Expr, error) {
+	x, err := p.parsePrimary()
+	if err != nil || !isKeyword(p.peek(), "COLLATE") {
+		return x, err
+	}
+	p.next()
+	tok := p.next()
+	if !isKeyword(tok, "NOCASE") && !isKeyword(tok, "BINARY") {
+		return nil, p.unexpected(tok, "NOCASE or BINARY")
+	}
+	return &CollateExpr{X: x, Collation: strings.ToUpper(tok.Val), Offset: x.Pos()}, nil
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	tok := p.next()
+	switch tok.Kind {
+	case tokString:
+		return &Literal{Value: StringValue(tok.Val), Offset: tok.Pos}, nil
+	case tokNumber:
+		return parseNumber(tok)
+	case tokQuotedIdent:
+		return p.parseColumn(tok)
+	case tokIdent:
+		switch {
+		case isKeyword(tok, "TRUE"), isKeyword(tok, "FALSE"):
+			return &Literal{Value: BoolValue(isKeyword(tok, "TRUE")), Offset: tok.Pos}, nil
+		case isKeyword(tok, "NULL"):
+			return &Literal{Value: Null, Offset: tok.Pos}, nil
+		case isKeyword(tok, "CASE"):
+			return p.parseCase(tok)
+		case (isKeyword(tok, "DATE") || isKeyword(tok, "DATETIME") || isKeyword(tok, "TIMESTAMP")) && p.peek().Kind == tokString:
+			return p.parseDate(tok)
+		case isReserved(tok):
+			return nil, p.unexpected(tok, "expression")
+		case isOp(p.peek(), "("):
+			return p.parseCall(tok)
+		}
+		return p.parseColumn(tok)
+	case tokOp:
+		if tok.Val == "(" {
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expectOp(")")
+		}
+	}
+	return nil, p.unexpected(tok, "expression")
+}
+
+// parseColumn parses a column name optionally qualified with a table: covid.location.
+func (p *parser) parseColumn(tok token) (Expr, error) {
+	if !isOp(p.peek(), ".") {
+		return &ColumnRef{Name: tok.Val, Offset: tok.Pos}, nil
+	}
+	p.next()
+	name := p.next()
+	if name.Kind != tokQuotedIdent && (name.Kind != tokIdent || isReserved(name)) {
+		return nil, p.unexpected(name, "column name")
+	}
+	return &ColumnRef{Table: tok.Val, Name: name.Val, Offset: tok.Pos}, nil
+}
+
+func (p *parser) parseCall(name token) (Expr, error) {
+	p.next()
+	if aggregates[strings.ToUpper(name.Val)] {
+		return p.parseAggregate(name)
+	}
+	switch strings.ToUpper(name.Val) {
+	case "CAST":
+		return p.parseCast(name)
+	case "EXTRACT":
+		return p.parseExtract(name)
+	}
+	call := &CallExpr{Name: strings.ToUpper(name.Val), Offset: name.Pos}
+	if isOp(p.peek(), ")") {
+		p.next()
+		return call, nil
+	}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+		tok := p.next()
+		if isOp(tok, ")") {
+			if call.Name == "REGEXP_EXTRACT" && len(call.Args) > 1 {
+				return call, checkRegexp(call.Args[1])
+			}
+			return call, nil
+		}
+		if !isOp(tok, ",") {
+			return nil, p.unexpected(tok, "',' or ')'")
+		}
+	}
+}
+
+// parseCast parses the rest of CAST(x AS type).
+func (p *parser) parseCast(name token) (Expr, error) {
+	x, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.next(); !isKeyword(tok, "AS") {
+		return nil, p.unexpected(tok, "AS")
+	}
+	tok := p.next()
+	t, err := ParseType(tok.Val)
+	if tok.Kind != tokIdent || err != nil {
+		return nil, p.unexpected(tok, "int, float, date, bool or string")
+	}
+	return &CastExpr{X: x, Type: t, Offset: name.Pos}, p.expectOp(")")
+}
+
+// parseExtract parses the rest of EXTRACT(part FROM x) into DATE_PART('part', x).
+func (p *parser) parseExtract(name token) (Expr, error) {
+	tok := p.next()
+	part := strings.ToLower(tok.Val)
+	if tok.Kind != tokIdent && tok.Kind != tokString || !dateParts[part] {
+		return nil, p.unexpected(tok, "date part")
+	}
+	if from := p.next(); !isKeyword(from, "FROM") {
+		return nil, p.unexpected(from, "FROM")
+	}
+	x, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	args := []Expr{&Literal{Value: StringValue(part), Offset: tok.Pos}, x}
+	return &CallExpr{Name: "DATE_PART", Args: args, Offset: name.Pos}, p.expectOp(")")
+}
+
+// parseDate parses the string of DATE '2020-04-14' or DATETIME '2020-04-14 10:00:00'.
+func (p *parser) parseDate(tok token) (Expr, error) {
+	s := p.next()
+	t, err := parseDate(strings.TrimSpace(s.Val))
+	if err != nil {
+		return nil, p.unexpected(s, "date")
+	}
+	return &Literal{Value: DateValue(t), Offset: tok.Pos}, nil
+}
+
+// parseCase parses CASE [x] WHEN a THEN b ... [ELSE c] END.
+func (p *parser) parseCase(tok token) (Expr, error) {
+	e := &CaseExpr{Offset: tok.Pos}
+	var err error
+	if !isKeyword(p.peek(), "WHEN") {
+		if e.Operand, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	for isKeyword(p.peek(), "WHEN") {
+		p.next()
+		var w When
+		if w.Cond, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if tok := p.next(); !isKeyword(tok, "THEN") {
+			return nil, p.unexpected(tok, "THEN")
+		}
+		if w.Result, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		e.Whens = append(e.Whens, w)
+	}
+	if len(e.Whens) == 0 {
+		return nil, p.unexpected(p.peek(), "WHEN")
+	}
+	if isKeyword(p.peek(), "ELSE") {
+		p.next()
+		if e.Else, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if tok := p.next(); !isKeyword(tok, "END") {
+		return nil, p.unexpected(tok, "WHEN, ELSE or END")
+	}
+	return e, nil
+}
+
+// parseAggregate parses the argument of an aggregate function:
+// COUNT(*), COUNT(DISTINCT x), SUM(x).
+func (p *parser) parseAggregate(name token) (Expr, error) {
+	agg := &AggregateExpr{Name: strings.ToUpper(name.Val), Offset: name.Pos}
+	if agg.Name == "COUNT" && isOp(p.peek(), "*") {
+		p.next()
+		return agg, p.expectOp(")")
+	}
+	if isKeyword(p.peek(), "DISTINCT") {
+		p.next()
+		agg.Distinct = true
+	}
+	arg, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	agg.Arg = arg
+	if tok := p.next(); !isOp(tok, ")") {
+		return nil, p.unexpected(tok, "')'")
+	}
+	return agg, nil
+}
+
+func parseNumber(tok token) (Expr, error) {
+	if i, err := strconv.ParseInt(tok.Val, 10, 64); err == nil {
+		return &Literal{Value: IntValue(i), Offset: tok.Pos}, nil
+	}
+	f, err := strconv.ParseFloat(tok.Val, 64)
+	if err != nil {
+		return nil, &SyntaxError{Pos: tok.Pos, Token: tok.Text, Expected: "number"}
+	}
+	return &Literal{Value: FloatValue(f), Offset: tok.Pos}, nil
+}
+
+// reserved are keywords that can't be used as bare column names.
+var reserved = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "COLLATE": true, "IN": true,
+	"SELECT": true, "FROM": true, "WHERE": true, "AS": true, "ORDER": true, "BY": true,
+	"LIMIT": true, "OFFSET": true, "GROUP": true, "HAVING": true, "DISTINCT": true,
+	"JOIN": true, "INNER": true, "CROSS": true, "OUTER": true, "ON": true,
+	"DIV": true, "MOD": true, "IS": true, "BETWEEN": true, "LIKE": true, "ESCAPE": true, "REGEXP": true,
+	"CASE": true, "WHEN": true, "THEN": true, "ELSE": true, "END": true, "INTO": true,
+}
+
+// keywords are the words of the syntax that are not reserved.
+var keywords = []string{
+	"ASC", "DESC", "NULLS", "FIRST", "LAST", "LEFT", "NULL", "TRUE", "FALSE",
+	"DATE", "DATETIME", "TIMESTAMP", "CAST", "EXTRACT",
+}
+
+// Keywords returns the keywords and the names of the functions, sorted.
+// They are the words a REPL completes besides table and column names.
+func Keywords() []string {
+	words := append([]string(nil), keywords...)
+	for kw := range reserved {
+		words = append(words, kw)
+	}
+	for name := range aggregates {
+		words = append(words, name)
+	}
+	for name := range Functions {
+		words = append(words, name)
+	}
+	sort.Strings(words)
+	return words
+}
+
+func isReserved(tok token) bool {
+	return tok.Kind == tokIdent && reserved[strings.ToUpper(tok.Val)]
+}
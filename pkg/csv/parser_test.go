@@ -0,0 +1,177 @@
+package csv_test
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{where, "(((continent = 'Asia') AND ((date > '2020-04-14') AND (date < '2020-04-20'))) OR " +
+			"((continent = 'Africa') AND ('2020-04-14' <> date)))"},
+		{"a = 1 OR b = 2 AND c = 3", "((a = 1) OR ((b = 2) AND (c = 3)))"},
+		{"NOT a = 'x' AND !b", "((NOT (a = 'x')) AND (NOT b))"},
+		{"lower(`first name`) == 'it''s'", "(LOWER(first name) = 'it''s')"},
+		{"a <> 1.5", "(a <> 1.5)"},
+		{"iso_code in ('AFG', \"RUS\") and a = 1", "((iso_code IN ('AFG', 'RUS')) AND (a = 1))"},
+		{"a NOT IN (1, 2) OR b not between 1 and 2 + 3", "((NOT (a IN (1, 2))) OR (NOT (b BETWEEN 1 AND (2 + 3))))"},
+		{"a BETWEEN 1 AND 2 AND b IS NULL", "((a BETWEEN 1 AND 2) AND (b IS NULL))"},
+		{"name LIKE 'A%' AND c is not null", "((name LIKE 'A%') AND (c IS NOT NULL))"},
+		{"name NOT LIKE 'a!%%' ESCAPE '!'", "(NOT (name LIKE 'a!%%' ESCAPE '!'))"},
+		{"NOT a IS NULL", "(NOT (a IS NULL))"},
+		{"date >= DATE '2020-04-14' AND EXTRACT(month FROM date) = 4",
+			"((date >= DATE '2020-04-14') AND (DATE_PART('month', date) = 4))"},
+	}
+	for _, tt := range tests {
+		got, err := csv.Parse(tt.query)
+		if assert.NoError(t, err, tt.query) {
+			assert.Equal(t, tt.want, got.String(), tt.query)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	head := &csv.Head{Fields: csv.GetFields("name,op,total", ",")}
+	tests := []struct {
+		query  string
+		values []string
+		want   bool
+	}{
+		{"op = 'AND'", []string{"x", "AND", "1"}, true},
+		{"op = 'name'", []string{"x", "NAME", "1"}, false},
+		{"name = op", []string{"AND", "AND", "1"}, true},
+		{"total > 100", []string{"x", "y", "99.0"}, false},
+		{"total > 100", []string{"x", "y", "100.5"}, true},
+		{"total = 1", []string{"x", "y", "1.0"}, true},
+		{"length(name) = 3 and not op = 'b'", []string{"abc", "a", "1"}, true},
+		{"", []string{"x", "y", "z"}, true},
+		{"op IN ('a', 'b')", []string{"x", "b", "1"}, true},
+		{"total IN (1, 2) OR NOT name IN ('x')", []string{"x", "y", "3"}, false},
+		{"total NOT IN (1, 2)", []string{"x", "y", "3"}, true},
+		{"total NOT IN (1, NULL)", []string{"x", "y", "3"}, false},
+		{"total BETWEEN 1 AND 3.5", []string{"x", "y", "3"}, true},
+		{"total NOT BETWEEN 1 AND 3", []string{"x", "y", "3"}, false},
+		{"name BETWEEN 'a' AND 'c'", []string{"b", "y", "3"}, true},
+		{"name LIKE 'Iv%'", []string{"Ivan", "y", "3"}, true},
+		{"name LIKE 'iv_n'", []string{"Ivan", "y", "3"}, false},
+		{"name LIKE 'iv_n' COLLATE NOCASE", []string{"Ivan", "y", "3"}, true},
+		{"op IS NULL AND name IS NOT NULL", []string{"x", "", "3"}, true},
+		{"op IS NULL", []string{"x", " ", "3"}, false},
+		{"op = '' OR op <> ''", []string{"x", "", "3"}, false},
+		{"total IS NULL", []string{"x", "y"}, true},
+	}
+	for _, tt := range tests {
+		pred, err := csv.Compile(tt.query, head)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		row := head.NewRow()
+		row.Values = tt.values
+		got, err := pred(row)
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.want, got, tt.query)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	head := &csv.Head{Fields: csv.GetFields("name", ",")}
+	for _, query := range []string{"age = 1", "name =", "(name = 'a'", "name = 'a", "nope(name)", "name = 'a' and", "name IN 'a'", "name IN ('a'",
+		"name BETWEEN 'a'", "name BETWEEN 'a' OR 'b'", "name IS 1", "name IS NOT", "name NOT = 'a'",
+		"name LIKE 'a' ESCAPE 'ab'", "name LIKE 'a!' ESCAPE '!'", "name LIKE"} {
+		_, err := csv.Compile(query, head)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		query    string
+		pos      int
+		token    string
+		expected string
+	}{
+		{"age >", 5, "", "expression"},
+		{"(a = 1", 6, "", "')'"},
+		{"= 'x'", 0, "=", "expression"},
+		{"a = 1 b = 2", 6, "b", "AND, OR or end of query"},
+		{"a = 'x", 6, "", "closing '"},
+		{"a = 1 and or", 10, "or", "expression"},
+		{"f(a b)", 4, "b", "',' or ')'"},
+		{"a # 1", 2, "#", ""},
+	}
+	for _, tt := range tests {
+		var got *csv.SyntaxError
+		_, err := csv.Parse(tt.query)
+		if assert.True(t, errors.As(err, &got), tt.query) {
+			assert.Equal(t, csv.SyntaxError{Pos: tt.pos, Token: tt.token, Expected: tt.expected}, *got, tt.query)
+		}
+	}
+}
+
+func TestSyntaxErrorCaret(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"город = 'Москва' OR", "1:20: город = 'Москва' OR\n" + strings.Repeat(" ", 25) + "^"},
+		{"SELECT name\nFROM data.csv\nWHERE id = = 1\nLIMIT 1", "3:12: WHERE id = = 1\n" + strings.Repeat(" ", 17) + "^"},
+		{"SELECT name\r\nFROM data.csv\r\nWHERE id =\r\n", "3:11: WHERE id =\n" + strings.Repeat(" ", 16) + "^"},
+	}
+	for _, tt := range tests {
+		_, err := csv.ParseStatement(tt.query)
+		var syntaxErr *csv.SyntaxError
+		if assert.True(t, errors.As(err, &syntaxErr), tt.query) {
+			assert.Equal(t, tt.want, syntaxErr.Caret(tt.query), tt.query)
+		}
+	}
+}
+
+func TestCompileCase(t *testing.T) {
+	head := &csv.Head{Fields: csv.NewFields([]string{"continent", "Город"})}
+	ignoreCase := *head
+	ignoreCase.IgnoreCase = true
+	tests := []struct {
+		head  *csv.Head
+		query string
+		want  bool
+	}{
+		{head, "CONTINENT = 'Asia'", true},
+		{head, "continent = 'ASIA'", false},
+		{head, "continent = 'ASIA' COLLATE NOCASE", true},
+		{head, "continent COLLATE nocase < 'b'", true},
+		{head, "город = 'МОСКВА'", false},
+		{head, "ГОРОД = 'МОСКВА' COLLATE NOCASE", true},
+		{head, "upper(город) = 'МОСКВА'", true},
+		{&ignoreCase, "город = 'мОСКВА' and continent = 'asia'", true},
+		{&ignoreCase, "continent = 'asia' COLLATE BINARY", false},
+	}
+	for _, tt := range tests {
+		pred, err := csv.Compile(tt.query, tt.head)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		row := tt.head.NewRow()
+		row.Values = []string{"Asia", "Москва"}
+		got, err := pred(row)
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.want, got, tt.query)
+	}
+
+	_, err := csv.Compile("continent = 'a' COLLATE utf8", head)
+	assert.Error(t, err)
+}
+
+func TestKeywords(t *testing.T) {
+	words := csv.Keywords()
+	assert.True(t, sort.StringsAreSorted(words))
+	for _, kw := range []string{"SELECT", "FROM", "DESC", "NULL", "COUNT", "UPPER", "CAST"} {
+		assert.Contains(t, words, kw)
+	}
+}
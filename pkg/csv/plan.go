@@ -0,0 +1,224 @@
+package csv
+
+import (
+	"strings"
+)
+
+// Plan looks for conditions of the WHERE clause that can be answered by the indexes.
+// It returns sorted offsets of the records that may match the query and true,
+// or false if the whole file has to be scanned. The records found still have to be
+// checked with Match.
+func (q *Query) Plan(indexes []Index) (offsets []int64, ok bool) {
+	ranges := map[Index]*keyRange{}
+	var order []Index
+	for _, cond := range conjuncts(q.Statement.Where) {
+		idx, r := indexRange(cond, indexes)
+		if idx == nil {
+			continue
+		}
+		if prev, found := ranges[idx]; found {
+			r = intersectRanges(prev, r)
+		} else {
+			order = append(order, idx)
+		}
+		ranges[idx] = r
+	}
+	for _, idx := range order {
+		found, can := idx.lookup(*ranges[idx])
+		if !can {
+			continue
+		}
+		if ok {
+			offsets = intersectOffsets(offsets, found)
+		} else {
+			offsets, ok = found, true
+		}
+	}
+	return offsets, ok
+}
+
+// conjuncts splits the condition by top-level AND.
+func conjuncts(e Expr) []Expr {
+	if b, ok := e.(*BinaryExpr); ok && b.Op == "AND" {
+		return append(conjuncts(b.Left), conjuncts(b.Right)...)
+	}
+	if e == nil {
+		return nil
+	}
+	return []Expr{e}
+}
+
+// flipped maps a comparison to the one with swapped operands.
+var flipped = map[string]string{"=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+// indexRange returns the index and the key range for a condition like column > literal.
+func indexRange(e Expr, indexes []Index) (Index, *keyRange) {
+	switch n := e.(type) {
+	case *InExpr:
+		return inRange(n, indexes)
+	case *BetweenExpr:
+		return betweenRange(n, indexes)
+	}
+	b, ok := e.(*BinaryExpr)
+	if !ok || b.NoCase {
+		return nil, nil
+	}
+	op, ok := flipped[b.Op]
+	if !ok {
+		return nil, nil
+	}
+	col, okCol := b.Left.(*ColumnRef)
+	lit, okLit := b.Right.(*Literal)
+	if !okCol || !okLit {
+		col, okCol = b.Right.(*ColumnRef)
+		lit, okLit = b.Left.(*Literal)
+		if !okCol || !okLit {
+			return nil, nil
+		}
+	} else {
+		op = b.Op
+	}
+	if !indexable(col, lit.Value) {
+		return nil, nil
+	}
+	var r *keyRange
+	switch key := lit.Value; op {
+	case "=":
+		r = &keyRange{values: []Value{key}}
+	case "<", "<=":
+		r = &keyRange{hi: &Bound{Key: key, Inclusive: op == "<="}}
+	default:
+		r = &keyRange{lo: &Bound{Key: key, Inclusive: op == ">="}}
+	}
+	return findIndex(indexes, col.Name, r), r
+}
+
+// inRange returns the index and the keys for column IN (literal, ...).
+func inRange(in *InExpr, indexes []Index) (Index, *keyRange) {
+	col, ok := in.X.(*ColumnRef)
+	if !ok || in.NoCase {
+		return nil, nil
+	}
+	r := &keyRange{values: []Value{}}
+	for _, item := range in.List {
+		lit, ok := item.(*Literal)
+		if !ok || !indexable(col, lit.Value) {
+			return nil, nil
+		}
+		if !r.contains(lit.Value) {
+			r.values = append(r.values, lit.Value)
+		}
+	}
+	return findIndex(indexes, col.Name, r), r
+}
+
+// betweenRange returns the index and the key range for column BETWEEN literal AND literal.
+func betweenRange(b *BetweenExpr, indexes []Index) (Index, *keyRange) {
+	col, ok := b.X.(*ColumnRef)
+	low, okLow := b.Low.(*Literal)
+	high, okHigh := b.High.(*Literal)
+	if !ok || !okLow || !okHigh || b.NoCase || !indexable(col, low.Value) || !indexable(col, high.Value) {
+		return nil, nil
+	}
+	r := &keyRange{lo: &Bound{Key: low.Value, Inclusive: true}, hi: &Bound{Key: high.Value, Inclusive: true}}
+	return findIndex(indexes, col.Name, r), r
+}
+
+// indexable reports whether comparing the column with v orders values the way
+// the index does, that is v has the type of the column.
+func indexable(col *ColumnRef, v Value) bool {
+	return !v.IsNull() && v.Type == col.Type
+}
+
+// findIndex returns an index of the column able to look up the range,
+// a hash index is preferred for equality.
+func findIndex(indexes []Index, column string, r *keyRange) Index {
+	var found Index
+	for _, idx := range indexes {
+		if !strings.EqualFold(idx.Column(), column) || r.values == nil && idx.Kind() != IndexBTree {
+			continue
+		}
+		if found == nil || idx.Kind() == IndexHash {
+			found = idx
+		}
+	}
+	return found
+}
+
+// intersectRanges returns the keys belonging to both ranges.
+func intersectRanges(a, b *keyRange) *keyRange {
+	if a.values == nil && b.values != nil {
+		a, b = b, a
+	}
+	if a.values != nil {
+		values := []Value{}
+		for _, v := range a.values {
+			if b.contains(v) {
+				values = append(values, v)
+			}
+		}
+		return &keyRange{values: values}
+	}
+	return &keyRange{lo: tighter(a.lo, b.lo, 1), hi: tighter(a.hi, b.hi, -1)}
+}
+
+// contains reports whether the key belongs to the range.
+func (r *keyRange) contains(key Value) bool {
+	if r.values != nil {
+		for _, v := range r.values {
+			if cmpKeys(v, key) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	if r.lo != nil {
+		if c := cmpKeys(key, r.lo.Key); c < 0 || c == 0 && !r.lo.Inclusive {
+			return false
+		}
+	}
+	if r.hi != nil {
+		if c := cmpKeys(key, r.hi.Key); c > 0 || c == 0 && !r.hi.Inclusive {
+			return false
+		}
+	}
+	return true
+}
+
+// tighter returns the bound limiting more, dir is 1 for lower bounds and -1 for upper ones.
+func tighter(a, b *Bound, dir int) *Bound {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	switch c := cmpKeys(a.Key, b.Key) * dir; {
+	case c > 0:
+		return a
+	case c < 0:
+		return b
+	case !a.Inclusive:
+		return a
+	default:
+		return b
+	}
+}
+
+// intersectOffsets returns offsets present in both sorted lists.
+func intersectOffsets(a, b []int64) []int64 {
+	res := []int64{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			res = append(res, a[i])
+			i++
+			j++
+		}
+	}
+	return res
+}
@@ -0,0 +1,350 @@
+package csv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Query is a statement bound to the head of the file it reads.
+// Columns describe the result rows.
+type Query struct {
+	Statement *Statement
+	Head      *Head
+	Columns   []Field
+
+	where   Predicate
+	project []Expr
+	order   []orderKey
+	groupBy []Expr
+	having  Predicate
+	aggs    []*AggregateExpr
+	grouped bool
+}
+
+// orderKey is a bound ORDER BY item, column is the index of the result column
+// it refers to or -1 if expr is evaluated on the row.
+type orderKey struct {
+	expr       Expr
+	column     int
+	desc       bool
+	nullsFirst bool
+}
+
+// Prepare resolves the columns of the statement against head.
+func Prepare(stmt *Statement, head *Head) (*Query, error) {
+	q := &Query{Statement: stmt, Head: head}
+	if stmt.Where != nil && hasAggregate(stmt.Where) {
+		return nil, fmt.Errorf("aggregate functions are not allowed in WHERE")
+	}
+	var err error
+	if q.where, err = NewPredicate(stmt.Where, head); err != nil {
+		return nil, err
+	}
+	for _, e := range stmt.GroupBy {
+		if hasAggregate(e) {
+			return nil, fmt.Errorf("aggregate functions are not allowed in GROUP BY")
+		}
+		if err = bind(e, head); err != nil {
+			return nil, err
+		}
+		q.groupBy = append(q.groupBy, e)
+	}
+	if len(stmt.Joins) > 1 {
+		return nil, fmt.Errorf("only one JOIN is supported")
+	}
+	for _, join := range stmt.Joins {
+		if join.On == nil {
+			continue
+		}
+		if hasAggregate(join.On) {
+			return nil, fmt.Errorf("aggregate functions are not allowed in ON")
+		}
+		if err = bind(join.On, head); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range stmt.Columns {
+		if item.Star {
+			if err = q.expandStar(item.Table); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err = bind(item.Expr, head); err != nil {
+			return nil, err
+		}
+		q.project = append(q.project, item.Expr)
+		column := Field{Name: columnName(item), Type: exprType(item.Expr)}
+		if c, ok := item.Expr.(*ColumnRef); ok && item.Alias == "" {
+			column.Table = c.field.Table
+		}
+		q.Columns = append(q.Columns, column)
+	}
+	q.qualifyDuplicates()
+	if q.having, err = NewPredicate(stmt.Having, head); err != nil {
+		return nil, err
+	}
+	for _, item := range stmt.OrderBy {
+		key, err := q.bindOrder(item)
+		if err != nil {
+			return nil, err
+		}
+		q.order = append(q.order, key)
+	}
+	if err = q.bindAggregates(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// expandStar adds the columns of the table or all columns if table is empty.
+func (q *Query) expandStar(table string) error {
+	found := false
+	for i, field := range q.Head.Fields {
+		if table != "" && !strings.EqualFold(field.Table, table) {
+			continue
+		}
+		found = true
+		q.project = append(q.project, &ColumnRef{Name: field.Name, Index: i, Type: field.Type, field: field})
+		q.Columns = append(q.Columns, field)
+	}
+	if !found && table != "" {
+		return fmt.Errorf("unknown table %q in %s.*", table, table)
+	}
+	return nil
+}
+
+// qualifyDuplicates prefixes the names of result columns of different tables
+// having the same name with the table, so SELECT * over a join gives a.id and b.id
+// and the keys of a JSON object are unique.
+func (q *Query) qualifyDuplicates() {
+	count := make(map[string]int, len(q.Columns))
+	for _, column := range q.Columns {
+		count[strings.ToLower(column.Name)]++
+	}
+	for i, column := range q.Columns {
+		if column.Table != "" && count[strings.ToLower(column.Name)] > 1 {
+			q.Columns[i].Name = column.Table + "." + column.Name
+		}
+	}
+}
+
+// bindAggregates numbers aggregate functions of the select list, HAVING and ORDER BY
+// and checks that columns outside of them are keys of GROUP BY.
+func (q *Query) bindAggregates() error {
+	exprs := append([]Expr(nil), q.project...)
+	if q.Statement.Having != nil {
+		exprs = append(exprs, q.Statement.Having)
+	}
+	for _, key := range q.order {
+		if key.column < 0 {
+			exprs = append(exprs, key.expr)
+		}
+	}
+	for _, e := range exprs {
+		err := walk(e, func(e Expr) error {
+			agg, ok := e.(*AggregateExpr)
+			if !ok {
+				return nil
+			}
+			if agg.Arg != nil && hasAggregate(agg.Arg) {
+				return fmt.Errorf("aggregate %s at position %d contains an aggregate", agg, agg.Offset)
+			}
+			agg.slot = len(q.aggs)
+			q.aggs = append(q.aggs, agg)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	q.grouped = len(q.groupBy) > 0 || len(q.aggs) > 0 || q.Statement.Having != nil
+	if !q.grouped {
+		return nil
+	}
+	for _, e := range exprs {
+		if err := q.checkGrouped(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkGrouped returns an error if e refers to a column that is neither
+// a key of GROUP BY nor an argument of an aggregate.
+func (q *Query) checkGrouped(e Expr) error {
+	for _, key := range q.groupBy {
+		if sameExpr(e, key) {
+			return nil
+		}
+	}
+	switch n := e.(type) {
+	case *AggregateExpr:
+		return nil
+	case *ColumnRef:
+		return fmt.Errorf("column %s must be in GROUP BY or used in an aggregate function", n.Name)
+	}
+	for _, child := range children(e) {
+		if err := q.checkGrouped(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameExpr reports whether bound expressions compute the same value.
+func sameExpr(a, b Expr) bool {
+	ca, okA := a.(*ColumnRef)
+	cb, okB := b.(*ColumnRef)
+	if okA && okB {
+		return ca.Index == cb.Index
+	}
+	return a.String() == b.String()
+}
+
+// Grouped reports whether the statement has GROUP BY, HAVING or aggregate
+// functions, its rows are produced by an Aggregator.
+func (q *Query) Grouped() bool {
+	return q.grouped
+}
+
+// bindOrder resolves an ORDER BY item: a number or a name of a result column
+// refers to it, anything else is an expression over the columns of the file.
+func (q *Query) bindOrder(item OrderItem) (orderKey, error) {
+	key := orderKey{expr: item.Expr, column: -1, desc: item.Desc, nullsFirst: item.NullsFirst}
+	switch e := item.Expr.(type) {
+	case *Literal:
+		if e.Value.Type == TypeInt {
+			if e.Value.Int < 1 || e.Value.Int > int64(len(q.Columns)) {
+				return key, fmt.Errorf("ORDER BY column %d at position %d is out of range", e.Value.Int, e.Offset)
+			}
+			key.column = int(e.Value.Int - 1)
+			return key, nil
+		}
+	case *ColumnRef:
+		for i, column := range q.Columns {
+			if isColumn(column, e) {
+				key.column = i
+				return key, nil
+			}
+		}
+	}
+	return key, bind(item.Expr, q.Head)
+}
+
+// isColumn reports whether the result column is the one ref names,
+// a qualified ref must match the table of the column too.
+func isColumn(column Field, ref *ColumnRef) bool {
+	if ref.Table == "" {
+		return strings.EqualFold(column.Name, ref.Name)
+	}
+	return strings.EqualFold(column.Table, ref.Table) &&
+		(strings.EqualFold(column.Name, ref.Name) || strings.EqualFold(column.Name, ref.Table+"."+ref.Name))
+}
+
+// columnName returns the alias of the item or the column name or the expression text.
+func columnName(item SelectItem) string {
+	if item.Alias != "" {
+		return item.Alias
+	}
+	if c, ok := item.Expr.(*ColumnRef); ok {
+		return c.Name
+	}
+	return item.Expr.String()
+}
+
+// exprType returns the type of expression known before evaluation, TypeNull if unknown.
+func exprType(e Expr) Type {
+	switch n := e.(type) {
+	case *ColumnRef:
+		return n.Type
+	case *Literal:
+		return n.Value.Type
+	case *CollateExpr:
+		return exprType(n.X)
+	case *BinaryExpr:
+		if arithmeticOps[n.Op] {
+			return arithmeticType(n.Op, exprType(n.Left), exprType(n.Right))
+		}
+		return TypeBool
+	case *UnaryExpr:
+		if n.Op == "NOT" {
+			return TypeBool
+		}
+		return arithmeticType(n.Op, exprType(n.X), TypeInt)
+	case *InExpr, *BetweenExpr, *LikeExpr, *RegexpExpr, *IsNullExpr:
+		return TypeBool
+	case *AggregateExpr:
+		return aggregateType(n)
+	case *CastExpr:
+		return n.Type
+	case *CaseExpr:
+		return n.resultType()
+	default:
+		return TypeNull
+	}
+}
+
+// Match reports whether the row satisfies the WHERE condition.
+func (q *Query) Match(row *Row) (bool, error) {
+	return q.where(row)
+}
+
+// Project evaluates the select list for the row.
+func (q *Query) Project(row *Row) ([]Value, error) {
+	values := make([]Value, len(q.project))
+	for i, e := range q.project {
+		v, err := e.eval(row)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", q.Columns[i].Name, err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// Ordered reports whether the statement has ORDER BY.
+func (q *Query) Ordered() bool {
+	return len(q.order) > 0
+}
+
+// sortKeys returns the values of ORDER BY keys for the row projected to values.
+func (q *Query) sortKeys(row *Row, values []Value) ([]Value, error) {
+	keys := make([]Value, len(q.order))
+	for i, key := range q.order {
+		if key.column >= 0 {
+			keys[i] = values[key.column]
+			continue
+		}
+		v, err := key.expr.eval(row)
+		if err != nil {
+			return nil, fmt.Errorf("ORDER BY %s: %w", key.expr, err)
+		}
+		keys[i] = v
+	}
+	return keys, nil
+}
+
+// compareKeys compares rows by the values of their ORDER BY keys.
+func (q *Query) compareKeys(a, b []Value) int {
+	for i, key := range q.order {
+		x, y := a[i], b[i]
+		if x.IsNull() || y.IsNull() {
+			if x.IsNull() == y.IsNull() {
+				continue
+			}
+			if x.IsNull() == key.nullsFirst {
+				return -1
+			}
+			return 1
+		}
+		c := orderValues(x, y)
+		if key.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -3,14 +3,52 @@ package csv
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// Head describes a CSV file. Strict makes a field that can't be parsed
+// as its column type an error, otherwise the field is NULL.
+// IgnoreCase makes string comparisons case-insensitive unless COLLATE BINARY is given.
 type Head struct {
-	Path   string
-	Fields []string
-	Log    *zap.Logger
+	Path       string
+	Fields     []Field
+	Strict     bool
+	IgnoreCase bool
+	Log        *zap.Logger
+}
+
+// Field is a typed column, fields = [{name = "date", type = "date"}] in config.toml.
+// Layout is the layout of a date column: a time.Parse one like "02/01/2006"
+// or a strftime one like "%d/%m/%Y", empty means any known one.
+type Field struct {
+	Name   string
+	Type   Type
+	Layout string
+	// Table is the name or alias of the table of the field in a query
+	Table string
+	// layout is Layout converted by Head.ParseLayouts
+	layout string
+}
+
+// Parse converts the raw text of the field to its type.
+func (f Field) Parse(raw string) (Value, error) {
+	if f.Type != TypeDate || f.Layout == "" || strings.TrimSpace(raw) == "" {
+		return ParseValue(raw, f.Type)
+	}
+	layout := f.layout
+	if layout == "" {
+		var err error
+		if layout, err = goLayout(f.Layout); err != nil {
+			return Null, err
+		}
+	}
+	t, err := time.Parse(layout, strings.TrimSpace(raw))
+	if err != nil {
+		return Null, fmt.Errorf("cannot parse %q as date %s", raw, f.Layout)
+	}
+	return DateValue(t), nil
 }
 
 type Body struct {
@@ -21,231 +59,46 @@ type Body struct {
 type Row struct {
 	*Head
 	Values []string
+	// aggs are the results of aggregate functions for the group of the row
+	aggs []Value
 }
 
+// IsMatch tells if the row matches the condition, which is compiled on every
+// call. To match many rows Compile the condition once and call the Predicate.
 func (d *Row) IsMatch(match string) bool {
-	if match == "" {
-		return true
-	}
-	match = strings.TrimSpace(match)
-	match = strings.ToUpper(match)
-
-	lexInfix := GetLex(match)
-	ReplaceFieldsToValues(lexInfix, d)
-	lexPostfix := InfixToPostfix(lexInfix)
-	result, err := GetBoolResult(lexPostfix)
-
-	if err != nil {
-		d.Log.Error(err.Error())
-	}
-	return result
-}
-
-//nolint
-func GetBoolResult(postfix []string) (res bool, err error) {
-	stack := make([]string, 0, len(postfix))
-	for _, val := range postfix {
-		l := len(stack)
-		var str1, str2, result string
-		if l > 0 {
-			str1 = stack[l-1]
-		}
-		if l > 1 {
-			str2 = stack[l-2]
-		}
-
-		switch val {
-		case "!", "NOT":
-			stack = stack[:l-2]
-			stack = append(stack, str2)
-			if result, err = not(str1); err != nil {
-				return false, err
-			}
-			stack = append(stack, result)
-		case "OR":
-			stack = stack[:l-2]
-			if result, err = or(str1, str2); err != nil {
-				return false, err
-			}
-			stack = append(stack, result)
-		case "AND":
-			stack = stack[:l-2]
-			if result, err = and(str1, str2); err != nil {
-				return false, err
-			}
-			stack = append(stack, result)
-		case "<":
-			stack = stack[:l-2]
-			if str1 > str2 {
-				stack = append(stack, "1")
-				continue
-			}
-			stack = append(stack, "0")
-		case ">":
-			stack = stack[:l-2]
-			if str1 < str2 {
-				stack = append(stack, "1")
-				continue
-			}
-			stack = append(stack, "0")
-		case ">=":
-			stack = stack[:l-2]
-			if str1 <= str2 {
-				stack = append(stack, "1")
-				continue
-			}
-			stack = append(stack, "0")
-		case "<=":
-			stack = stack[:l-2]
-			if str1 >= str2 {
-				stack = append(stack, "1")
-				continue
-			}
-			stack = append(stack, "0")
-		case "<>", "!=":
-			stack = stack[:l-2]
-			if str1 != str2 {
-				stack = append(stack, "1")
-				continue
-			}
-			stack = append(stack, "0")
-		case "=":
-			stack = stack[:l-2]
-			if str1 == str2 {
-				stack = append(stack, "1")
-				continue
-			}
-			stack = append(stack, "0")
-		default:
-			stack = append(stack, val)
-		}
-	}
-	if stack[0] == "1" {
-		return true, nil
-	}
-	return false, nil
-}
-
-//nolint:goconst
-func InfixToPostfix(infix []string) (postfix []string) {
-	stack := make([]string, 0, len(infix))
-	for _, val := range infix {
-		val = strings.ToUpper(val)
-		switch val {
-		case "(":
-			stack = append(stack, val)
-		case ")":
-			i := len(stack) - 1
-			for ; stack[i] != "("; i-- {
-				postfix = append(postfix, stack[i])
-			}
-			stack = stack[:i]
-		case "+", "-", "!", "NOT", "/", "*", "DIV", "MOD", "AND", "OR", "<", ">", "<=", ">=", "<>", "!=", "=":
-			for i := len(stack) - 1; i >= 0 && GetPriority(stack[i]) >= GetPriority(val); i = len(stack) - 1 {
-				postfix = append(postfix, stack[i])
-				stack = stack[:i]
-			}
-			stack = append(stack, val)
-		default:
-			postfix = append(postfix, val)
+	pred, err := Compile(match, d.Head)
+	if err == nil {
+		var ok bool
+		if ok, err = pred(d); err == nil {
+			return ok
 		}
 	}
-	for i := len(stack) - 1; i >= 0; i-- {
-		postfix = append(postfix, stack[i])
-	}
-
-	return postfix
-}
-
-func ReplaceFieldsToValues(lex []string, row *Row) {
-	for i, val := range lex {
-		switch val {
-		case "(", ")", "+", "-", "!", "NOT", "/", "*", "DIV", "MOD", "AND", "OR", "<", ">", "<=", ">=", "<>", "!=", "=":
-			continue
-		default:
-			for j, field := range row.Fields {
-				if val == field {
-					lex[i] = "'" + row.Values[j] + "'"
-					break
-				}
-			}
-		}
+	if d.Log != nil {
+		d.Log.Error(err.Error())
 	}
+	return false
 }
 
-//nolint:gomnd
-func GetPriority(operator string) uint8 {
-	operator = strings.ToUpper(operator)
-	switch operator {
-	case "(", ")":
-		return 1
-	case "+", "-", "!", "NOT":
-		return 2
-	case "/", "*", "DIV", "MOD", "AND":
-		return 3
-	case "OR":
-		return 4
-	case "<", ">", "<=", ">=", "<>", "!=", "=":
-		return 5
-	default:
-		return 0
-	}
-}
+// GetLex returns the source text of every token of the query.
 func GetLex(str string) (lex []string) {
-	for left, right := "", str; len(right) > 0; {
-		left, right = Split(right)
-		lex = append(lex, left)
+	l := &lexer{src: str}
+	for {
+		tok, err := l.next()
+		if err != nil || tok.Kind == tokEOF {
+			return lex
+		}
+		lex = append(lex, tok.Text)
 	}
-	return lex
 }
 
+// Split cuts the first token off the query.
 func Split(str string) (left, right string) {
-	inputBuffer := []byte(str)
-	outputBuffer := make([]byte, 0, len(inputBuffer))
-	spaceIgnoring := false
-	for i, val := range inputBuffer {
-		switch val {
-		case ')', '(':
-			if len(outputBuffer) > 0 {
-				return string(outputBuffer), string(inputBuffer[i:])
-			}
-			return string(val), string(inputBuffer[i+1:])
-		case '>', '<', '!', '=':
-			if len(outputBuffer) > 0 {
-				return string(outputBuffer), string(inputBuffer[i:])
-			}
-			outputBuffer = append(outputBuffer, val)
-			switch inputBuffer[i+1] {
-			case '=':
-				outputBuffer = append(outputBuffer, inputBuffer[i+1])
-				return string(outputBuffer), string(inputBuffer[i+2:])
-			default:
-				return string(outputBuffer), string(inputBuffer[i+1:])
-			}
-		default:
-			switch val {
-			case ' ':
-				if !spaceIgnoring {
-					if len(outputBuffer) > 0 {
-						return string(outputBuffer), string(inputBuffer[i+1:])
-					}
-					continue
-				}
-				outputBuffer = append(outputBuffer, ' ')
-			case []byte("'")[0]:
-				if !spaceIgnoring {
-					spaceIgnoring = true
-					outputBuffer = append(outputBuffer, val)
-					continue
-				}
-				outputBuffer = append(outputBuffer, val)
-				return string(outputBuffer), string(inputBuffer[i+1:])
-			default:
-				outputBuffer = append(outputBuffer, val)
-			}
-		}
+	l := &lexer{src: str}
+	tok, err := l.next()
+	if err != nil || tok.Kind == tokEOF {
+		return strings.TrimSpace(str), ""
 	}
-	return string(outputBuffer), string(inputBuffer)
+	return tok.Text, str[tok.End:]
 }
 
 func SplitReverse(str string) (left, right string) {
@@ -305,54 +158,105 @@ func reverse(str []byte) []byte {
 	return newStr
 }
 
-func GetFields(row, sep string) []string {
+func GetFields(row, sep string) []Field {
 	row = strings.ToUpper(row)
 	if sep == "" {
 		sep = ","
 	}
-	return strings.Split(row, sep)
+	return NewFields(strings.Split(row, sep))
 }
 
-func (h *Head) NewRow() *Row {
-	return &Row{Head: h}
+// NewFields returns string fields with the given names, e.g. of a header record.
+func NewFields(names []string) []Field {
+	fields := make([]Field, len(names))
+	for i, name := range names {
+		fields[i] = Field{Name: strings.TrimSpace(name), Type: TypeString}
+	}
+	return fields
 }
 
-func not(str string) (string, error) {
-	switch str {
-	case "1":
-		return "0", nil
-	case "0":
-		return "1", nil
-	default:
-		return "", fmt.Errorf("syntax error: %s is not bool(expected '0' or '1')", str)
+// ApplySchema returns header fields typed by the schema fields of the same name,
+// the rest stay strings.
+func ApplySchema(header, schema []Field) []Field {
+	fields := make([]Field, len(header))
+	copy(fields, header)
+	for i := range fields {
+		for _, field := range schema {
+			if strings.EqualFold(field.Name, fields[i].Name) {
+				fields[i].Type, fields[i].Layout, fields[i].layout = field.Type, field.Layout, field.layout
+				break
+			}
+		}
 	}
+	return fields
 }
 
-func or(str1, str2 string) (string, error) {
-	if isBool(str1) && isBool(str2) {
-		if str1 == "1" || str2 == "1" {
-			return "1", nil
+// ParseLayouts converts the layouts of the date fields to time.Parse ones once,
+// so that rows are not parsed with an invalid layout.
+func (h *Head) ParseLayouts() error {
+	for i, f := range h.Fields {
+		if f.Type != TypeDate || f.Layout == "" {
+			continue
+		}
+		layout, err := goLayout(f.Layout)
+		if err != nil {
+			return fmt.Errorf("field %q: %w", f.Name, err)
 		}
-		return "0", nil
+		h.Fields[i].layout = layout
 	}
-	return "", fmt.Errorf("syntax error: %s is not bool(expected '0' or '1')", str2)
+	return nil
+}
+
+func (h *Head) NewRow() *Row {
+	return &Row{Head: h}
 }
 
-func and(str1, str2 string) (string, error) {
-	if isBool(str1) && isBool(str2) {
-		if str1 == "1" && str2 == "1" {
-			return "1", nil
+// resolve returns the index of the column, a non-empty table must match Field.Table.
+// An unqualified name found in several tables is ambiguous.
+func (h *Head) resolve(table, name string) (int, error) {
+	found := -1
+	for i, f := range h.Fields {
+		if !strings.EqualFold(f.Name, name) || table != "" && !strings.EqualFold(f.Table, table) {
+			continue
+		}
+		if found < 0 {
+			found = i
+		} else if !strings.EqualFold(h.Fields[found].Table, f.Table) {
+			return -1, fmt.Errorf("column %q is ambiguous", name)
+		}
+	}
+	if found < 0 {
+		if table != "" {
+			name = table + "." + name
 		}
-		return "0", nil
+		return -1, fmt.Errorf("unknown column %q", name)
 	}
-	return "", fmt.Errorf("syntax error: %s is not bool(expected '0' or '1')", str2)
+	return found, nil
 }
 
-func isBool(str string) bool {
-	switch str {
-	case "1", "0":
-		return true
-	default:
-		return false
+// Qualify sets the table name or alias of the fields.
+func (h *Head) Qualify(table string) {
+	fields := make([]Field, len(h.Fields))
+	for i, f := range h.Fields {
+		f.Table = table
+		fields[i] = f
+	}
+	h.Fields = fields
+}
+
+// JoinHeads returns the head of rows made of the fields of left followed by the fields of right.
+func JoinHeads(left, right *Head) *Head {
+	head := *left
+	head.Fields = append(append([]Field(nil), left.Fields...), right.Fields...)
+	return &head
+}
+
+// FieldIndex returns the index of the field with the given name ignoring case, or -1.
+func (h *Head) FieldIndex(name string) int {
+	for i, field := range h.Fields {
+		if strings.EqualFold(field.Name, name) {
+			return i
+		}
 	}
+	return -1
 }
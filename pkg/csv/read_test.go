@@ -68,13 +68,10 @@ func TestGetLex(t *testing.T) {
 	want := []string{"(", "continent", "=", "'Asia'", "AND", "(", "date", ">", "'2020-04-14'", "AND", "date", "<", "'2020-04-20'", ")", "OR", "(", "continent", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "date", ")", ")"}
 	got := csv.GetLex(where)
 	assert.Equal(t, want, got, "they should be equal")
-}
-func TestInfixToPostfix(t *testing.T) {
-	want := []string{"CONTINENT", "'ASIA'", "=", "DATE", "'2020-04-14'", ">", "DATE", "'2020-04-20'", "<", "AND", "CONTINENT", "'AFRICA'", "=", "'2020-04-14'", "DATE", "!=", "AND", "OR", "AND"}
-	got := csv.InfixToPostfix(csv.GetLex(where))
-	assert.Equal(t, want, got, "func \"TestGetItem\": they should be equal")
-}
 
+	want = []string{"location", "NOT", "LIKE", "'A!%%'", "ESCAPE", "'!'", "AND", "total_cases", "IS", "NOT", "NULL"}
+	assert.Equal(t, want, csv.GetLex("location NOT LIKE 'A!%%' ESCAPE '!' AND total_cases IS NOT NULL"))
+}
 func TestGetFields(t *testing.T) {
 	want := []string{
 		"iso_code", "continent", "location", "date", "total_cases", "new_cases", "new_cases_smoothed",
@@ -90,64 +87,12 @@ func TestGetFields(t *testing.T) {
 		"aged_65_older", "aged_70_older", "gdp_per_capita", "extreme_poverty", "cardiovasc_death_rate", "diabetes_prevalence",
 		"female_smokers", "male_smokers", "handwashing_facilities", "hospital_beds_per_thousand", "life_expectancy", "human_development_index",
 	}
+	fields := make([]csv.Field, len(want))
 	for i := range want {
-		want[i] = strings.ToUpper(want[i])
+		fields[i] = csv.Field{Name: strings.ToUpper(want[i]), Type: csv.TypeString}
 	}
 	got := csv.GetFields(firstRow, ",")
-	assert.Equal(t, want, got, "func \"TestGetItem\": they should be equal")
-}
-
-func TestReplaceFieldsToValues(t *testing.T) {
-	lex := []string{"(", "CONTINENT", "=", "'Asia'", "AND", "(", "DATE", ">", "'2020-04-14'", "AND", "DATE", "<", "'2020-04-20'", ")", "OR", "(", "CONTINENT", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "DATE", ")", ")"}
-	want := [][]string{
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-02-24'", ">", "'2020-04-14'", "AND", "'2020-02-24'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-02-24'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-02-25'", ">", "'2020-04-14'", "AND", "'2020-02-25'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-02-25'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-02-26'", ">", "'2020-04-14'", "AND", "'2020-02-26'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-02-26'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-02-27'", ">", "'2020-04-14'", "AND", "'2020-02-27'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-02-27'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-02-28'", ">", "'2020-04-14'", "AND", "'2020-02-28'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-02-28'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-02-29'", ">", "'2020-04-14'", "AND", "'2020-02-29'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-02-29'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-03-01'", ">", "'2020-04-14'", "AND", "'2020-03-01'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-03-01'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-03-02'", ">", "'2020-04-14'", "AND", "'2020-03-02'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-03-02'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-03-03'", ">", "'2020-04-14'", "AND", "'2020-03-03'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-03-03'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-03-04'", ">", "'2020-04-14'", "AND", "'2020-03-04'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-03-04'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-03-05'", ">", "'2020-04-14'", "AND", "'2020-03-05'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-03-05'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-03-06'", ">", "'2020-04-14'", "AND", "'2020-03-06'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-03-06'", ")", ")"},
-	}
-
-	head := csv.Head{}
-	head.Fields = csv.GetFields(firstRow, ",")
-	row := head.NewRow()
-	rowsStr := strings.Split(data, "\n")
-	for i, val := range rowsStr {
-		l := make([]string, len(lex))
-		copy(l, lex)
-		row.Values = strings.Split(val, ",")
-		csv.ReplaceFieldsToValues(l, row)
-		assert.Equal(t, want[i], l, "they should be equal")
-	}
-}
-
-func TestGetBoolResult(t *testing.T) {
-	input := [][]string{
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-02-24'", ">", "'2020-04-14'", "AND", "'2020-02-24'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-02-24'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-02-25'", ">", "'2020-04-14'", "AND", "'2020-02-25'", "<", "'2020-04-20'", ")", "OR", "(", "'Africa'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-02-25'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-05-26'", ">", "'2020-04-14'", "AND", "'2020-02-26'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-02-26'", ")", ")"},
-		{"(", "'Asia'", "=", "'Asia'", "AND", "(", "'2020-02-27'", ">", "'2020-04-14'", "AND", "'2020-02-27'", "<", "'2020-04-20'", ")", "OR", "(", "'Asia'", "=", "'Africa'", "AND", "'2020-04-14'", "!=", "'2020-02-27'", ")", ")"},
-	}
-	type result struct {
-		res bool
-		err error
-	}
-	want := []result{
-		{res: false, err: nil},
-		{res: true, err: nil},
-		{res: true, err: nil},
-		{res: false, err: nil},
-	}
-	for i, val := range input {
-		got, err := csv.GetBoolResult(csv.InfixToPostfix(val))
-		assert.Equal(t, want[i], result{res: got, err: err})
-	}
+	assert.Equal(t, fields, got, "func \"TestGetItem\": they should be equal")
 }
 
 func TestIsMatch(t *testing.T) {
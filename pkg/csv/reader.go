@@ -0,0 +1,301 @@
+package csv
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+var (
+	ErrBareQuote      = errors.New("bare quote in non-quoted field")
+	ErrQuote          = errors.New("extraneous or missing quote in quoted field")
+	ErrRecordTooLarge = errors.New("record is too large")
+)
+
+// DefaultMaxRecordSize limits a record when ReaderOptions.MaxRecordSize is 0.
+const DefaultMaxRecordSize = 16 << 20
+
+// ReaderOptions describes the dialect of a CSV file.
+// Sep, Quote and Escape are single characters, Escape equal to Quote (the default)
+// means a quote inside a quoted field is doubled as RFC 4180 says.
+// LazyQuotes allows quotes in non-quoted fields and stray quotes in quoted ones.
+type ReaderOptions struct {
+	Sep           string
+	Quote         string
+	Escape        string
+	LazyQuotes    bool
+	MaxRecordSize int
+}
+
+// Reader reads records of a CSV file, quoted fields may contain
+// separators, escaped quotes and line breaks.
+type Reader struct {
+	r          *bufio.Reader
+	sep        byte
+	quote      byte
+	escape     byte
+	lazyQuotes bool
+	maxSize    int
+
+	offset int64
+	line   int
+	buf    []byte
+	field  []byte
+}
+
+func NewReader(r io.Reader, opts ReaderOptions) (*Reader, error) {
+	rd := &Reader{
+		r:          bufio.NewReader(r),
+		sep:        ',',
+		quote:      '"',
+		lazyQuotes: opts.LazyQuotes,
+		maxSize:    opts.MaxRecordSize,
+	}
+	for _, opt := range []struct {
+		name string
+		val  string
+		dst  *byte
+	}{{"sep", opts.Sep, &rd.sep}, {"quote", opts.Quote, &rd.quote}, {"escape", opts.Escape, &rd.escape}} {
+		switch {
+		case opt.val == "":
+		case len(opt.val) == 1 && opt.val[0] < utf8.RuneSelf && opt.val[0] != '\n' && opt.val[0] != '\r':
+			*opt.dst = opt.val[0]
+		default:
+			return nil, fmt.Errorf("csv reader: %s must be a single ASCII character, got %q", opt.name, opt.val)
+		}
+	}
+	if rd.escape == 0 {
+		rd.escape = rd.quote
+	}
+	if rd.sep == rd.quote {
+		return nil, fmt.Errorf("csv reader: sep and quote must differ")
+	}
+	if rd.maxSize <= 0 {
+		rd.maxSize = DefaultMaxRecordSize
+	}
+	return rd, nil
+}
+
+// Offset returns the byte offset of the next record in the input.
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
+
+// Reset makes the reader read from src positioned at offset, the dialect is kept.
+// It is used to read records found by an index after seeking the file.
+func (r *Reader) Reset(src io.Reader, offset int64) {
+	r.r.Reset(src)
+	r.offset = offset
+	r.line = 0
+}
+
+// Line returns the number of the last line read.
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// readLine reads a line with its line break, the line is valid until the next call.
+func (r *Reader) readLine(size int) ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		r.buf = append(r.buf[:0], line...)
+		for err == bufio.ErrBufferFull {
+			if size+len(r.buf) > r.maxSize {
+				return nil, ErrRecordTooLarge
+			}
+			line, err = r.r.ReadSlice('\n')
+			r.buf = append(r.buf, line...)
+		}
+		line = r.buf
+	}
+	if len(line) > 0 {
+		r.line++
+		r.offset += int64(len(line))
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	if size+len(line) > r.maxSize {
+		return nil, ErrRecordTooLarge
+	}
+	return line, err
+}
+
+// Read returns the next record, empty lines are skipped. At the end of input it returns io.EOF.
+func (r *Reader) Read() ([]string, error) {
+	var (
+		line []byte
+		err  error
+	)
+	for {
+		if line, err = r.readLine(0); err != nil {
+			return nil, r.wrap(err)
+		}
+		if len(trimEOL(line)) > 0 {
+			break
+		}
+	}
+	record, err := r.parseRecord(line)
+	if err != nil {
+		return nil, r.wrap(err)
+	}
+	return record, nil
+}
+
+func (r *Reader) wrap(err error) error {
+	if err == io.EOF {
+		return err
+	}
+	return fmt.Errorf("csv line %d: %w", r.line, err)
+}
+
+func (r *Reader) parseRecord(line []byte) ([]string, error) {
+	var (
+		record []string
+		size   int
+		err    error
+	)
+	for {
+		var field string
+		if r.quote != 0 && len(line) > 0 && line[0] == r.quote {
+			field, line, size, err = r.parseQuoted(line[1:], size)
+		} else {
+			field, line, err = r.parseBare(line)
+		}
+		if err != nil {
+			return nil, err
+		}
+		record = append(record, field)
+		if len(line) == 0 {
+			return record, nil
+		}
+		// line starts with the separator
+		line = line[1:]
+	}
+}
+
+// parseBare cuts a non-quoted field off the line.
+func (r *Reader) parseBare(line []byte) (field string, rest []byte, err error) {
+	i := bytes.IndexByte(line, r.sep)
+	if i < 0 {
+		line = trimEOL(line)
+		i = len(line)
+	}
+	if !r.lazyQuotes && bytes.IndexByte(line[:i], r.quote) >= 0 {
+		return "", nil, ErrBareQuote
+	}
+	return string(line[:i]), line[i:], nil
+}
+
+// parseQuoted reads a quoted field starting right after the opening quote,
+// continuing on the next lines of input when the field contains line breaks.
+func (r *Reader) parseQuoted(line []byte, size int) (field string, rest []byte, n int, err error) {
+	r.field = r.field[:0]
+	for {
+		i := bytes.IndexByte(line, r.quote)
+		if r.escape != r.quote {
+			if j := bytes.IndexByte(line, r.escape); j >= 0 && (i < 0 || j < i) && j+1 < len(line) {
+				r.field = append(r.field, line[:j]...)
+				r.field = append(r.field, line[j+1])
+				line = line[j+2:]
+				continue
+			}
+		}
+		if i < 0 {
+			// the field goes on on the next line
+			r.field = append(r.field, line...)
+			size += len(line)
+			if line, err = r.readLine(size); err != nil {
+				if err != io.EOF {
+					return "", nil, size, err
+				}
+				if r.lazyQuotes {
+					return string(r.field), nil, size, nil
+				}
+				return "", nil, size, ErrQuote
+			}
+			continue
+		}
+		r.field = append(r.field, line[:i]...)
+		line = line[i+1:]
+		switch {
+		case r.escape == r.quote && len(line) > 0 && line[0] == r.quote:
+			r.field = append(r.field, r.quote)
+			line = line[1:]
+		case len(line) > 0 && line[0] == r.sep:
+			return string(r.field), line, size, nil
+		case len(trimEOL(line)) == 0:
+			return string(r.field), nil, size, nil
+		case r.lazyQuotes:
+			r.field = append(r.field, r.quote)
+		default:
+			return "", nil, size, ErrQuote
+		}
+	}
+}
+
+// readRaw appends the text of the next record with its line break to buf without
+// parsing the fields, following quoted fields over line breaks the way Read does.
+// Malformed quotes are left to be reported by Read of the text.
+func (r *Reader) readRaw(buf []byte) ([]byte, error) {
+	line, err := r.readLine(0)
+	if err != nil {
+		return buf, err
+	}
+	buf = append(buf, line...)
+	size := len(line)
+	quoted := false
+	for {
+		if !quoted {
+			if r.quote == 0 || len(line) == 0 || line[0] != r.quote {
+				i := bytes.IndexByte(line, r.sep)
+				if i < 0 {
+					return buf, nil
+				}
+				line = line[i+1:]
+				continue
+			}
+			quoted, line = true, line[1:]
+		}
+		i := bytes.IndexByte(line, r.quote)
+		if r.escape != r.quote {
+			if j := bytes.IndexByte(line, r.escape); j >= 0 && (i < 0 || j < i) && j+1 < len(line) {
+				line = line[j+2:]
+				continue
+			}
+		}
+		if i < 0 {
+			if line, err = r.readLine(size); err != nil {
+				if err == io.EOF {
+					return buf, nil
+				}
+				return buf, err
+			}
+			buf = append(buf, line...)
+			size += len(line)
+			continue
+		}
+		line = line[i+1:]
+		switch {
+		case r.escape == r.quote && len(line) > 0 && line[0] == r.quote:
+			line = line[1:]
+		case len(trimEOL(line)) == 0:
+			return buf, nil
+		case line[0] == r.sep, !r.lazyQuotes:
+			quoted = false
+		}
+	}
+}
+
+func trimEOL(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+		if n := len(line); n > 0 && line[n-1] == '\r' {
+			line = line[:n-1]
+		}
+	}
+	return line
+}
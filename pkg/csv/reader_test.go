@@ -0,0 +1,114 @@
+package csv_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func readAll(t *testing.T, r io.Reader, opts csv.ReaderOptions) ([][]string, error) {
+	t.Helper()
+	rd, err := csv.NewReader(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	var records [][]string
+	for {
+		record, err := rd.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func TestReaderOWID(t *testing.T) {
+	file, err := os.Open("testdata/owid-covid-sample.csv")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+
+	records, err := readAll(t, file, csv.ReaderOptions{})
+	assert.NoError(t, err)
+	if !assert.Len(t, records, 7) {
+		return
+	}
+	for _, record := range records {
+		assert.Len(t, record, 8)
+	}
+	assert.Equal(t, "Bonaire Sint Eustatius and Saba", records[2][2])
+	assert.Equal(t, "Korea, North", records[3][2])
+	assert.Equal(t, `Cote d'Ivoire "Ivory Coast"`, records[4][2])
+	assert.Equal(t, "units\r\nunclear", records[5][6])
+	assert.Equal(t, "145934460.0", records[6][7])
+}
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		opts    csv.ReaderOptions
+		want    [][]string
+		wantErr error
+	}{
+		{name: "empty fields", input: "a,,\n,b,\n", want: [][]string{{"a", "", ""}, {"", "b", ""}}},
+		{name: "semicolon", input: "a;\"b;c\"\n", opts: csv.ReaderOptions{Sep: ";"}, want: [][]string{{"a", "b;c"}}},
+		{name: "escape char", input: `"a\"b",c` + "\n", opts: csv.ReaderOptions{Escape: `\`}, want: [][]string{{`a"b`, "c"}}},
+		{name: "single quote", input: "'a,b',c\n", opts: csv.ReaderOptions{Quote: "'"}, want: [][]string{{"a,b", "c"}}},
+		{name: "bare quote", input: "a\"b,c\n", wantErr: csv.ErrBareQuote},
+		{name: "lazy bare quote", input: "a\"b,c\n", opts: csv.ReaderOptions{LazyQuotes: true}, want: [][]string{{`a"b`, "c"}}},
+		{name: "stray quote", input: "\"a\"b,c\n", wantErr: csv.ErrQuote},
+		{name: "lazy stray quote", input: "\"a\"b\",c\n", opts: csv.ReaderOptions{LazyQuotes: true}, want: [][]string{{`a"b`, "c"}}},
+		{name: "unterminated", input: "\"a,b\nc,d\n", wantErr: csv.ErrQuote},
+		{name: "too large", input: "a,b,c,d\n", opts: csv.ReaderOptions{MaxRecordSize: 4}, wantErr: csv.ErrRecordTooLarge},
+		{name: "too large multiline", input: "\"a\nb\nc\nd\ne\"\n", opts: csv.ReaderOptions{MaxRecordSize: 6}, wantErr: csv.ErrRecordTooLarge},
+	}
+	for _, tt := range tests {
+		got, err := readAll(t, strings.NewReader(tt.input), tt.opts)
+		if tt.wantErr != nil {
+			assert.True(t, errors.Is(err, tt.wantErr), "%s: %v", tt.name, err)
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+}
+
+func TestReaderLongLine(t *testing.T) {
+	long := strings.Repeat("x", 100000)
+	got, err := readAll(t, strings.NewReader("a,"+long+"\n\""+long+"\n\",b\n"), csv.ReaderOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", long}, {long + "\n", "b"}}, got)
+}
+
+func TestReaderOffset(t *testing.T) {
+	input := "a,b\n\"c\nd\",e\nf,g"
+	rd, err := csv.NewReader(strings.NewReader(input), csv.ReaderOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var offsets []int64
+	for {
+		offsets = append(offsets, rd.Offset())
+		if _, err := rd.Read(); err != nil {
+			break
+		}
+	}
+	assert.Equal(t, []int64{0, 4, 12, 15}, offsets)
+}
+
+func TestNewReaderOptions(t *testing.T) {
+	_, err := csv.NewReader(strings.NewReader(""), csv.ReaderOptions{Sep: "::"})
+	assert.Error(t, err)
+	_, err = csv.NewReader(strings.NewReader(""), csv.ReaderOptions{Sep: `"`})
+	assert.Error(t, err)
+}
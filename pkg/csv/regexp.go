@@ -0,0 +1,164 @@
+package csv
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync"
+)
+
+// RegexpExpr matches the text of X with the regular expression Pattern:
+// x REGEXP p, x ~ p, or x ~* p ignoring case. NoCase is set by bind
+// for ~* and for operands collated NOCASE.
+type RegexpExpr struct {
+	X, Pattern Expr
+	Op         string
+	Offset     int
+	NoCase     bool
+	// re is compiled by bind if Pattern is a literal
+	re *regexp.Regexp
+}
+
+func (e *RegexpExpr) Pos() int { return e.Offset }
+
+func (e *RegexpExpr) String() string {
+	return "(" + e.X.String() + " " + e.Op + " " + e.Pattern.String() + ")"
+}
+
+func (e *RegexpExpr) eval(row *Row) (Value, error) {
+	x, err := e.X.eval(row)
+	if err != nil || x.IsNull() {
+		return Null, err
+	}
+	re := e.re
+	if re == nil {
+		p, err := e.Pattern.eval(row)
+		if err != nil || p.IsNull() {
+			return Null, err
+		}
+		if re, err = compileRegexp(p.String(), e.NoCase); err != nil {
+			return Null, fmt.Errorf("%s at position %d: %w", e.Op, e.Offset, err)
+		}
+	}
+	return BoolValue(re.MatchString(x.String())), nil
+}
+
+// compile compiles a literal pattern once, the pattern is already checked by the parser.
+func (e *RegexpExpr) compile() error {
+	p, ok := literal(e.Pattern)
+	if !ok || p.IsNull() {
+		return nil
+	}
+	re, err := compileRegexp(p.String(), e.NoCase)
+	if err != nil {
+		return fmt.Errorf("%s at position %d: %w", e.Op, e.Offset, err)
+	}
+	e.re = re
+	return nil
+}
+
+// checkRegexp returns a syntax error if the expression is a string literal
+// that is not a valid regular expression.
+func checkRegexp(e Expr) error {
+	lit, ok := e.(*Literal)
+	if !ok || lit.Value.Type != TypeString {
+		return nil
+	}
+	if _, err := regexp.Compile(lit.Value.Str); err != nil {
+		expected := "regular expression"
+		if serr, ok := err.(*syntax.Error); ok {
+			expected += " (" + string(serr.Code) + ")"
+		}
+		return &SyntaxError{Pos: lit.Offset, Token: lit.String(), Expected: expected}
+	}
+	return nil
+}
+
+// maxRegexps limits the cache of compiled patterns that are not literals.
+const maxRegexps = 256
+
+var regexps = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: map[string]*regexp.Regexp{}}
+
+// compileRegexp compiles the pattern, patterns computed per row are cached.
+func compileRegexp(pattern string, noCase bool) (*regexp.Regexp, error) {
+	if noCase {
+		pattern = "(?i)" + pattern
+	}
+	regexps.Lock()
+	defer regexps.Unlock()
+	if re, ok := regexps.m[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(regexps.m) >= maxRegexps {
+		regexps.m = map[string]*regexp.Regexp{}
+	}
+	regexps.m[pattern] = re
+	return re, nil
+}
+
+// compile compiles the literal pattern of REGEXP_EXTRACT once,
+// the pattern is already checked by the parser.
+func (e *CallExpr) compile() error {
+	if !strings.EqualFold(e.Name, "REGEXP_EXTRACT") || len(e.Args) < 2 {
+		return nil
+	}
+	p, ok := literal(e.Args[1])
+	if !ok || p.IsNull() {
+		return nil
+	}
+	re, err := regexp.Compile(p.String())
+	if err != nil {
+		return fmt.Errorf("%s at position %d: %w", e.Name, e.Offset, err)
+	}
+	e.re = re
+	return nil
+}
+
+// regexpExtract returns the group of the first match of the pattern in the text,
+// the first group by default or the whole match if the pattern has no groups.
+// It is NULL if there is no match.
+func regexpExtract(args []Value) (Value, error) {
+	if args[1].IsNull() {
+		return Null, nil
+	}
+	re, err := compileRegexp(args[1].String(), false)
+	if err != nil {
+		return Null, err
+	}
+	return extractGroup(re, args)
+}
+
+// extractGroup is regexpExtract with the pattern compiled.
+func extractGroup(re *regexp.Regexp, args []Value) (Value, error) {
+	for _, arg := range args {
+		if arg.IsNull() {
+			return Null, nil
+		}
+	}
+	group := int64(1)
+	if len(args) > 2 {
+		g, err := coerce(args[2], TypeInt)
+		if err != nil {
+			return Null, fmt.Errorf("group: %w", err)
+		}
+		group = g.Int
+	} else if re.NumSubexp() == 0 {
+		group = 0
+	}
+	if group < 0 || group > int64(re.NumSubexp()) {
+		return Null, fmt.Errorf("pattern %q has no group %d", re.String(), group)
+	}
+	m := re.FindStringSubmatchIndex(args[0].String())
+	if m == nil || m[2*group] < 0 {
+		return Null, nil
+	}
+	return StringValue(args[0].String()[m[2*group]:m[2*group+1]]), nil
+}
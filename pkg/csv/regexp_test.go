@@ -0,0 +1,116 @@
+package csv_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegexp(t *testing.T) {
+	head := &csv.Head{Fields: []csv.Field{{Name: "location", Type: csv.TypeString}, {Name: "p", Type: csv.TypeString}}}
+	tests := []struct {
+		location, query string
+		want            bool
+	}{
+		{"Afghanistan", "location REGEXP '^A.*stan$'", true},
+		{"Afghanistan", "location ~ 'stan'", true},
+		{"Afghanistan", "location ~ '^a'", false},
+		{"Afghanistan", "location ~* '^a'", true},
+		{"Afghanistan", "location ~ '(?i)^a'", true},
+		{"Afghanistan", "location ~ '^a' COLLATE NOCASE", true},
+		{"Afghanistan", "location !~ 'stan'", false},
+		{"Afghanistan", "location !~* '^AF'", false},
+		{"Afghanistan", "location NOT REGEXP '^Ka'", true},
+		{"Kazakhstan", "location ~ p", true},
+		{"", "location ~ '.*'", false},
+	}
+	for _, tt := range tests {
+		pred, err := csv.Compile(tt.query, head)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		row := head.NewRow()
+		row.Values = []string{tt.location, "^K.z"}
+		got, err := pred(row)
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.want, got, tt.location+" "+tt.query)
+	}
+
+	pred, err := csv.Compile("location ~ p", head)
+	if assert.NoError(t, err) {
+		row := head.NewRow()
+		row.Values = []string{"Oman", "(a"}
+		_, err = pred(row)
+		assert.Error(t, err)
+	}
+}
+
+func TestRegexpSyntaxError(t *testing.T) {
+	for _, query := range []string{
+		"location ~ '[a'",
+		"location NOT REGEXP 'a)'",
+		"SELECT regexp_extract(location, '(a', 1)",
+	} {
+		_, err := csv.ParseStatement(query)
+		var syntaxErr *csv.SyntaxError
+		if assert.True(t, errors.As(err, &syntaxErr), query) {
+			assert.Contains(t, syntaxErr.Expected, "regular expression", query)
+		}
+	}
+}
+
+func TestRegexpExtract(t *testing.T) {
+	head := &csv.Head{Fields: []csv.Field{{Name: "s", Type: csv.TypeString}}}
+	tests := []struct {
+		query string
+		want  csv.Value
+	}{
+		{"SELECT regexp_extract(s, '(\\d+)-(\\d+)', 2)", csv.StringValue("04")},
+		{"SELECT regexp_extract(s, '(\\d+)-(\\d+)')", csv.StringValue("2020")},
+		{"SELECT regexp_extract(s, '\\d+-\\d+')", csv.StringValue("2020-04")},
+		{"SELECT regexp_extract(s, '(\\d+)-(\\d+)', 0)", csv.StringValue("2020-04")},
+		{"SELECT regexp_extract(s, 'x(\\d)')", csv.Null},
+		{"SELECT regexp_extract(s, '(x)?\\d')", csv.Null},
+		{"SELECT regexp_extract(NULL, '(\\d+)')", csv.Null},
+	}
+	for _, tt := range tests {
+		stmt, err := csv.ParseStatement(tt.query)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		q, err := csv.Prepare(stmt, head)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		row := head.NewRow()
+		row.Values = []string{"date 2020-04-14"}
+		got, err := q.Project(row)
+		if assert.NoError(t, err, tt.query) {
+			assert.Equal(t, tt.want, got[0], tt.query)
+		}
+	}
+
+	// a pattern of a column is compiled per row
+	patterns := &csv.Head{Fields: []csv.Field{{Name: "s", Type: csv.TypeString}, {Name: "p", Type: csv.TypeString}}}
+	pred, err := csv.Compile("regexp_extract(s, p, 2) = '04'", patterns)
+	if assert.NoError(t, err) {
+		row := patterns.NewRow()
+		row.Values = []string{"date 2020-04-14", "(\\d+)-(\\d+)"}
+		got, err := pred(row)
+		assert.NoError(t, err)
+		assert.True(t, got)
+	}
+
+	stmt, err := csv.ParseStatement("SELECT regexp_extract(s, '(\\d+)', 2)")
+	if assert.NoError(t, err) {
+		q, err := csv.Prepare(stmt, head)
+		if assert.NoError(t, err) {
+			row := head.NewRow()
+			row.Values = []string{"1"}
+			_, err = q.Project(row)
+			assert.Error(t, err)
+		}
+	}
+}
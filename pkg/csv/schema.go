@@ -0,0 +1,142 @@
+package csv
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InferOptions controls InferSchema. Rows is the number of rows
+// sampled after the header, 0 means DefaultInferRows.
+type InferOptions struct {
+	ReaderOptions
+	Rows int
+}
+
+const DefaultInferRows = 1000
+
+// inferLayouts are the date layouts InferSchema can detect.
+var inferLayouts = []string{"2006-01-02", "02.01.2006", time.RFC3339, "2006-01-02 15:04:05"}
+
+// candidate tracks which types every sampled value of a column still fits.
+type candidate struct {
+	seen          bool
+	isBool, isInt bool
+	isFloat       bool
+	layouts       []string
+}
+
+func newCandidate() *candidate {
+	layouts := make([]string, len(inferLayouts))
+	copy(layouts, inferLayouts)
+	return &candidate{isBool: true, isInt: true, isFloat: true, layouts: layouts}
+}
+
+func (c *candidate) add(raw string) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return
+	}
+	c.seen = true
+	if c.isBool {
+		c.isBool = strings.EqualFold(s, "true") || strings.EqualFold(s, "false")
+	}
+	if c.isInt {
+		_, err := strconv.ParseInt(s, 10, 64)
+		c.isInt = err == nil
+	}
+	if c.isFloat {
+		_, err := strconv.ParseFloat(s, 64)
+		c.isFloat = err == nil
+	}
+	layouts := c.layouts[:0]
+	for _, layout := range c.layouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			layouts = append(layouts, layout)
+		}
+	}
+	c.layouts = layouts
+}
+
+func (c *candidate) field(name string) Field {
+	switch {
+	case !c.seen:
+		return Field{Name: name, Type: TypeString}
+	case c.isBool:
+		return Field{Name: name, Type: TypeBool}
+	case c.isInt:
+		return Field{Name: name, Type: TypeInt}
+	case c.isFloat:
+		return Field{Name: name, Type: TypeFloat}
+	case len(c.layouts) > 0:
+		return Field{Name: name, Type: TypeDate, Layout: c.layouts[0]}
+	default:
+		return Field{Name: name, Type: TypeString}
+	}
+}
+
+// InferSchema takes field names from the header row of r and guesses
+// the type of every column from the rows that follow.
+// A column without a single non-empty value is a string.
+func InferSchema(r io.Reader, opts InferOptions) ([]Field, error) {
+	if opts.Rows <= 0 {
+		opts.Rows = DefaultInferRows
+	}
+	rd, err := NewReader(r, opts.ReaderOptions)
+	if err != nil {
+		return nil, err
+	}
+	names, err := rd.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("infer schema: no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]*candidate, len(names))
+	for i := range candidates {
+		candidates[i] = newCandidate()
+	}
+	for n := 0; n < opts.Rows; n++ {
+		record, err := rd.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, value := range record {
+			if i < len(candidates) {
+				candidates[i].add(value)
+			}
+		}
+	}
+	fields := make([]Field, len(names))
+	for i, name := range names {
+		fields[i] = candidates[i].field(strings.TrimSpace(name))
+	}
+	return fields, nil
+}
+
+// SchemaTOML formats fields as a [head] block of config.toml.
+func SchemaTOML(path string, fields []Field) string {
+	var b strings.Builder
+	b.WriteString("[head]\n")
+	fmt.Fprintf(&b, "path = %s\n", strconv.Quote(path))
+	b.WriteString("fields = [\n")
+	for i, field := range fields {
+		fmt.Fprintf(&b, "    {name = %s, type = %q", strconv.Quote(field.Name), field.Type)
+		if field.Layout != "" {
+			fmt.Fprintf(&b, ", layout = %s", strconv.Quote(field.Layout))
+		}
+		b.WriteString("}")
+		if i < len(fields)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("    ]\n")
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package csv_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	toml "github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/assert"
+)
+
+const sample = `iso_code,date,total_cases,new_cases,is_island,updated,comment
+AFG,2020-02-24,1.0,1,false,24.02.2020,
+AFG,2020-02-25,,0,false,25.02.2020,first
+RUS,2020-02-26,3.5,2,FALSE,26.02.2020,
+`
+
+func TestInferSchema(t *testing.T) {
+	want := []csv.Field{
+		{Name: "iso_code", Type: csv.TypeString},
+		{Name: "date", Type: csv.TypeDate, Layout: "2006-01-02"},
+		{Name: "total_cases", Type: csv.TypeFloat},
+		{Name: "new_cases", Type: csv.TypeInt},
+		{Name: "is_island", Type: csv.TypeBool},
+		{Name: "updated", Type: csv.TypeDate, Layout: "02.01.2006"},
+		{Name: "comment", Type: csv.TypeString},
+	}
+	got, err := csv.InferSchema(strings.NewReader(sample), csv.InferOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	got, err = csv.InferSchema(strings.NewReader(sample+"ZZZ,yesterday,,1.5,1,,\n"), csv.InferOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []csv.Type{csv.TypeString, csv.TypeFloat, csv.TypeString}, []csv.Type{got[1].Type, got[3].Type, got[4].Type})
+
+	got, err = csv.InferSchema(strings.NewReader(sample+"ZZZ,yesterday,,1.5,1,,\n"), csv.InferOptions{Rows: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []csv.Type{csv.TypeDate, csv.TypeInt, csv.TypeBool}, []csv.Type{got[1].Type, got[3].Type, got[4].Type})
+
+	_, err = csv.InferSchema(strings.NewReader(""), csv.InferOptions{})
+	assert.Error(t, err)
+}
+
+func TestSchemaTOML(t *testing.T) {
+	fields, err := csv.InferSchema(strings.NewReader(sample), csv.InferOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var config struct {
+		Head csv.Head
+	}
+	err = toml.Unmarshal([]byte(csv.SchemaTOML("data/covid.csv", fields)), &config)
+	assert.NoError(t, err)
+	assert.Equal(t, "data/covid.csv", config.Head.Path)
+	assert.Equal(t, fields, config.Head.Fields)
+}
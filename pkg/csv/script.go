@@ -0,0 +1,56 @@
+package csv
+
+import "strings"
+
+// SplitScript splits text into statements ending with ';' and returns the text
+// following the last one, which is an incomplete statement or only spaces.
+// A line starting with a backslash is a meta-command ending at the line break.
+// Semicolons in quotes are not separators, comments from -- to the end of line
+// are removed. Statements are trimmed, empty ones are skipped.
+// The last statement of a script may lack ';', SplitScript(rest+"\n;") ends it.
+func SplitScript(text string) (stmts []string, rest string) {
+	var (
+		b     strings.Builder
+		start int
+		quote byte
+	)
+	end := func(i int) {
+		if s := strings.TrimSpace(b.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		b.Reset()
+		start = i
+	}
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\\' && strings.TrimSpace(b.String()) == "":
+			n := strings.IndexByte(text[i:], '\n')
+			if n < 0 {
+				return stmts, text[start:]
+			}
+			b.WriteString(text[i : i+n])
+			i += n
+			end(i + 1)
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '-' && strings.HasPrefix(text[i:], "--"):
+			n := strings.IndexByte(text[i:], '\n')
+			if n < 0 {
+				n = len(text) - i
+			}
+			i += n - 1
+			continue
+		case c == ';':
+			end(i + 1)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return stmts, text[start:]
+}
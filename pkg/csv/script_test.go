@@ -0,0 +1,36 @@
+package csv_test
+
+import (
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitScript(t *testing.T) {
+	tests := []struct {
+		text  string
+		stmts []string
+		rest  string
+	}{
+		{"SELECT 1; SELECT 2;", []string{"SELECT 1", "SELECT 2"}, ""},
+		{"SELECT 1;\nSELECT a\nFROM x", []string{"SELECT 1"}, "\nSELECT a\nFROM x"},
+		{"SELECT ';' AS \"a;b\", `c;d`;", []string{"SELECT ';' AS \"a;b\", `c;d`"}, ""},
+		{"SELECT 'it''s;';", []string{"SELECT 'it''s;'"}, ""},
+		{"-- top; comment\nSELECT 1 -- one;\n;", []string{"SELECT 1"}, ""},
+		{"\\format csv\nSELECT 1;\n  \\o out.csv\n\\q", []string{`\format csv`, "SELECT 1", `\o out.csv`}, `\q`},
+		{"SELECT '\\x';\n", []string{`SELECT '\x'`}, "\n"},
+		{";;  ;\n", nil, "\n"},
+		{"SELECT 'a;", nil, "SELECT 'a;"},
+	}
+	for _, tt := range tests {
+		stmts, rest := csv.SplitScript(tt.text)
+		assert.Equal(t, tt.stmts, stmts, tt.text)
+		assert.Equal(t, tt.rest, rest, tt.text)
+	}
+
+	stmts, _ := csv.SplitScript("\\q" + "\n;")
+	assert.Equal(t, []string{`\q`}, stmts)
+	stmts, _ = csv.SplitScript("SELECT 1 -- last" + "\n;")
+	assert.Equal(t, []string{"SELECT 1"}, stmts)
+}
@@ -0,0 +1,387 @@
+package csv
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultSortMemory limits the rows a Sorter keeps in memory when SortOptions.Memory is 0.
+const DefaultSortMemory = 64 << 20
+
+// SortOptions sets the memory budget of a Sorter and the directory of its
+// temporary files, os.TempDir() if empty.
+type SortOptions struct {
+	Memory  int64
+	TempDir string
+}
+
+// sortRow is a result row with the values of the ORDER BY keys,
+// seq keeps the order of rows with equal keys.
+type sortRow struct {
+	keys   []Value
+	values []Value
+	seq    int64
+}
+
+// Sorter orders result rows by ORDER BY of a query and applies LIMIT and OFFSET.
+// Rows beyond the memory budget are sorted in runs written to temporary files
+// and merged at the end. With LIMIT only the first OFFSET+LIMIT rows are kept
+// in a heap while they fit in the budget, beyond it the rows are written in runs
+// as without LIMIT.
+type Sorter struct {
+	query *Query
+	opts  SortOptions
+	rows  []sortRow
+	size  int64
+	seq   int64
+	runs  []string
+	// top is the number of rows kept with LIMIT, -1 without it
+	top int64
+}
+
+// NewSorter returns a sorter of the rows of q.
+func NewSorter(q *Query, opts SortOptions) *Sorter {
+	if opts.Memory <= 0 {
+		opts.Memory = DefaultSortMemory
+	}
+	s := &Sorter{query: q, opts: opts, top: -1}
+	if q.Statement.Limit != nil {
+		s.top = *q.Statement.Limit + q.Statement.Offset
+	}
+	return s
+}
+
+// Add adds the row projected to values.
+func (s *Sorter) Add(row *Row, values []Value) error {
+	keys, err := s.query.sortKeys(row, values)
+	if err != nil {
+		return err
+	}
+	s.seq++
+	r := sortRow{keys: keys, values: values, seq: s.seq}
+	if s.top >= 0 && len(s.runs) == 0 {
+		s.addTop(r)
+	} else {
+		s.rows = append(s.rows, r)
+		s.size += rowSize(keys) + rowSize(values)
+	}
+	if s.size > s.opts.Memory {
+		return s.spill()
+	}
+	return nil
+}
+
+// addTop keeps the row if it is among the first s.top rows,
+// s.rows is a heap with the last of them on top.
+func (s *Sorter) addTop(r sortRow) {
+	h := (*topHeap)(s)
+	switch {
+	case int64(len(s.rows)) < s.top:
+		heap.Push(h, r)
+		s.size += rowSize(r.keys) + rowSize(r.values)
+	case len(s.rows) > 0 && s.compareRows(r, s.rows[0]) < 0:
+		s.size += rowSize(r.keys) + rowSize(r.values) - rowSize(s.rows[0].keys) - rowSize(s.rows[0].values)
+		s.rows[0] = r
+		heap.Fix(h, 0)
+	}
+}
+
+type topHeap Sorter
+
+func (h *topHeap) Len() int           { return len(h.rows) }
+func (h *topHeap) Less(i, j int) bool { return (*Sorter)(h).compareRows(h.rows[i], h.rows[j]) > 0 }
+func (h *topHeap) Swap(i, j int)      { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+func (h *topHeap) Push(x interface{}) { h.rows = append(h.rows, x.(sortRow)) }
+
+func (h *topHeap) Pop() interface{} {
+	r := h.rows[len(h.rows)-1]
+	h.rows = h.rows[:len(h.rows)-1]
+	return r
+}
+
+func (s *Sorter) compareRows(a, b sortRow) int {
+	if c := s.query.compareKeys(a.keys, b.keys); c != 0 {
+		return c
+	}
+	return compareInt(a.seq, b.seq)
+}
+
+// rowSize estimates the memory taken by the values.
+func rowSize(values []Value) int64 {
+	size := int64(24)
+	for _, v := range values {
+		size += 64 + int64(len(v.Str))
+	}
+	return size
+}
+
+func (s *Sorter) sortRows() {
+	sort.Slice(s.rows, func(i, j int) bool {
+		return s.compareRows(s.rows[i], s.rows[j]) < 0
+	})
+}
+
+// spill writes the sorted rows in memory to a temporary file.
+func (s *Sorter) spill() error {
+	s.sortRows()
+	file, err := ioutil.TempFile(s.opts.TempDir, "csvq-sort-*")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, file.Name())
+	w := bufio.NewWriter(file)
+	for _, row := range s.rows {
+		writeUvarint(w, uint64(row.seq))
+		writeValues(w, row.keys)
+		writeValues(w, row.values)
+	}
+	if err = w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	s.rows, s.size = s.rows[:0], 0
+	return file.Close()
+}
+
+// errLimit stops Each after LIMIT rows.
+var errLimit = errors.New("limit reached")
+
+// Each calls fn for the rows in order, skipping OFFSET rows and stopping after
+// LIMIT ones, until fn returns an error.
+func (s *Sorter) Each(fn func(values []Value) error) error {
+	offset, limit := s.query.Statement.Offset, s.top
+	err := s.each(func(values []Value) error {
+		if limit >= 0 {
+			if limit == 0 {
+				return errLimit
+			}
+			limit--
+		}
+		if offset > 0 {
+			offset--
+			return nil
+		}
+		return fn(values)
+	})
+	if err == errLimit {
+		return nil
+	}
+	return err
+}
+
+func (s *Sorter) each(fn func(values []Value) error) error {
+	m, err := s.merge()
+	if err != nil {
+		return err
+	}
+	defer m.close()
+	for {
+		row, ok, err := m.next()
+		if err != nil || !ok {
+			return err
+		}
+		if err = fn(row.values); err != nil {
+			return err
+		}
+	}
+}
+
+// merge sorts the rows in memory and returns the merger of them with the runs on disk.
+func (s *Sorter) merge() (*merger, error) {
+	s.sortRows()
+	m := &merger{sorter: s}
+	for _, name := range s.runs {
+		file, err := os.Open(name)
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		m.files = append(m.files, file)
+		if err = m.push(&runReader{r: bufio.NewReader(file)}); err != nil {
+			m.close()
+			return nil, err
+		}
+	}
+	if err := m.push(&runReader{rows: s.rows}); err != nil {
+		m.close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Close removes the temporary files.
+func (s *Sorter) Close() error {
+	var err error
+	for _, name := range s.runs {
+		if e := os.Remove(name); e != nil && err == nil {
+			err = e
+		}
+	}
+	s.runs, s.rows = nil, nil
+	return err
+}
+
+// runReader reads sorted rows of a run from a file or from memory.
+type runReader struct {
+	r    *bufio.Reader
+	rows []sortRow
+	row  sortRow
+}
+
+func (run *runReader) next() (bool, error) {
+	if run.r == nil {
+		if len(run.rows) == 0 {
+			return false, nil
+		}
+		run.row, run.rows = run.rows[0], run.rows[1:]
+		return true, nil
+	}
+	seq, err := binary.ReadUvarint(run.r)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	keys, err := readValues(run.r)
+	if err != nil {
+		return false, unexpectedEOF(err)
+	}
+	values, err := readValues(run.r)
+	if err != nil {
+		return false, unexpectedEOF(err)
+	}
+	run.row = sortRow{keys: keys, values: values, seq: int64(seq)}
+	return true, nil
+}
+
+// merger is a heap of runs ordered by their current rows.
+type merger struct {
+	sorter *Sorter
+	runs   []*runReader
+	files  []*os.File
+	// taken is set when the row of the top run is returned by next
+	taken bool
+}
+
+// next returns the rows of all runs in order.
+func (m *merger) next() (sortRow, bool, error) {
+	if m.taken && len(m.runs) > 0 {
+		ok, err := m.runs[0].next()
+		if err != nil {
+			return sortRow{}, false, err
+		}
+		if ok {
+			heap.Fix(m, 0)
+		} else {
+			heap.Pop(m)
+		}
+	}
+	if len(m.runs) == 0 {
+		return sortRow{}, false, nil
+	}
+	m.taken = true
+	return m.runs[0].row, true, nil
+}
+
+func (m *merger) push(run *runReader) error {
+	ok, err := run.next()
+	if ok {
+		heap.Push(m, run)
+	}
+	return err
+}
+
+func (m *merger) close() {
+	for _, file := range m.files {
+		file.Close()
+	}
+}
+
+func (m *merger) Len() int { return len(m.runs) }
+
+func (m *merger) Less(i, j int) bool {
+	return m.sorter.compareRows(m.runs[i].row, m.runs[j].row) < 0
+}
+
+func (m *merger) Swap(i, j int) { m.runs[i], m.runs[j] = m.runs[j], m.runs[i] }
+
+func (m *merger) Push(x interface{}) { m.runs = append(m.runs, x.(*runReader)) }
+
+func (m *merger) Pop() interface{} {
+	run := m.runs[len(m.runs)-1]
+	m.runs = m.runs[:len(m.runs)-1]
+	return run
+}
+
+// orderValues is a total order of values: comparable values are compared,
+// others are ordered by type and text. NULL is not expected here.
+func orderValues(a, b Value) int {
+	if c, ok := compare(a, b); ok {
+		return c
+	}
+	if a.Type != b.Type {
+		return compareInt(int64(a.Type), int64(b.Type))
+	}
+	return strings.Compare(a.String(), b.String())
+}
+
+func writeValues(w *bufio.Writer, values []Value) {
+	writeUvarint(w, uint64(len(values)))
+	for _, v := range values {
+		writeUvarint(w, uint64(v.Type))
+		if !v.IsNull() {
+			writeKey(w, v)
+		}
+		// the zone of a date is kept, so it is printed as read
+		if v.Type == TypeDate {
+			_, offset := v.Time.Zone()
+			writeVarint(w, int64(offset))
+		}
+	}
+}
+
+func readValues(r *bufio.Reader) ([]Value, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]Value, n)
+	for i := range values {
+		t, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if Type(t) == TypeNull {
+			continue
+		}
+		if values[i], err = readKey(r, Type(t)); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if Type(t) == TypeDate {
+			offset, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			if offset != 0 {
+				values[i].Time = values[i].Time.In(time.FixedZone("", int(offset)))
+			}
+		}
+	}
+	return values, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+package csv_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+var sortRecords = [][]string{
+	{"Ivan", "41", "2020-04-14"},
+	{"Petr", "", "2020-04-15"},
+	{"anna", "33", ""},
+	{"Olga", "41", "2020-04-13"},
+	{"Oleg", "7", "2020-04-16T10:00:00+03:00"},
+}
+
+func sortedNames(t *testing.T, query string, opts csv.SortOptions) []string {
+	t.Helper()
+	head := &csv.Head{Fields: []csv.Field{
+		{Name: "name", Type: csv.TypeString},
+		{Name: "age", Type: csv.TypeInt},
+		{Name: "day", Type: csv.TypeDate},
+	}}
+	stmt, err := csv.ParseStatement(query)
+	if !assert.NoError(t, err, query) {
+		return nil
+	}
+	q, err := csv.Prepare(stmt, head)
+	if !assert.NoError(t, err, query) {
+		return nil
+	}
+	assert.True(t, q.Ordered(), query)
+	sorter := csv.NewSorter(q, opts)
+	defer sorter.Close()
+	for _, record := range sortRecords {
+		row := head.NewRow()
+		row.Values = record
+		values, err := q.Project(row)
+		if !assert.NoError(t, err, query) {
+			return nil
+		}
+		assert.NoError(t, sorter.Add(row, values), query)
+	}
+	var names []string
+	assert.NoError(t, sorter.Each(func(values []csv.Value) error {
+		names = append(names, values[0].String())
+		return nil
+	}))
+	return names
+}
+
+func TestSorter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csvq")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT name ORDER BY age", []string{"Oleg", "anna", "Ivan", "Olga", "Petr"}},
+		{"SELECT name ORDER BY age DESC", []string{"Petr", "Ivan", "Olga", "anna", "Oleg"}},
+		{"SELECT name ORDER BY age NULLS FIRST, name DESC", []string{"Petr", "Oleg", "anna", "Olga", "Ivan"}},
+		{"SELECT name ORDER BY age DESC NULLS LAST, 1", []string{"Ivan", "Olga", "anna", "Oleg", "Petr"}},
+		{"SELECT name, age AS years ORDER BY years, day", []string{"Oleg", "anna", "Olga", "Ivan", "Petr"}},
+		{"SELECT name ORDER BY day", []string{"Olga", "Ivan", "Petr", "Oleg", "anna"}},
+		{"SELECT name ORDER BY lower(name)", []string{"anna", "Ivan", "Oleg", "Olga", "Petr"}},
+		{"age > 10 ORDER BY name", []string{"Ivan", "Oleg", "Olga", "Petr", "anna"}},
+		{"SELECT name ORDER BY age LIMIT 2", []string{"Oleg", "anna"}},
+		{"SELECT name ORDER BY age DESC LIMIT 2 OFFSET 1", []string{"Ivan", "Olga"}},
+		{"SELECT name ORDER BY age OFFSET 3", []string{"Olga", "Petr"}},
+		{"SELECT name ORDER BY age LIMIT 10 OFFSET 4", []string{"Petr"}},
+		{"SELECT name ORDER BY age LIMIT 0", nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, sortedNames(t, tt.query, csv.SortOptions{}), tt.query)
+		// every row is spilled to its own run
+		assert.Equal(t, tt.want, sortedNames(t, tt.query, csv.SortOptions{Memory: 1, TempDir: dir}), tt.query)
+	}
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+
+	head := &csv.Head{Fields: []csv.Field{{Name: "name", Type: csv.TypeString}}}
+	for _, query := range []string{"SELECT name ORDER BY 2", "SELECT name ORDER BY age"} {
+		stmt, err := csv.ParseStatement(query)
+		if assert.NoError(t, err, query) {
+			_, err = csv.Prepare(stmt, head)
+			assert.Error(t, err, query)
+		}
+	}
+}
+
+func TestSorterQualified(t *testing.T) {
+	left := &csv.Head{Fields: []csv.Field{{Name: "id", Type: csv.TypeInt}}}
+	right := &csv.Head{Fields: []csv.Field{{Name: "id", Type: csv.TypeInt}}}
+	left.Qualify("a")
+	right.Qualify("b")
+	head := csv.JoinHeads(left, right)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT a.id, b.id FROM x AS a JOIN y AS b ON a.id = b.id ORDER BY b.id", []string{"1", "2", "3"}},
+		{"SELECT a.id, b.id FROM x AS a JOIN y AS b ON a.id = b.id ORDER BY a.id DESC", []string{"2", "1", "3"}},
+		{"SELECT a.id FROM x AS a JOIN y AS b ON a.id = b.id ORDER BY b.id DESC", []string{"1", "3", "2"}},
+		{"SELECT b.id AS id, a.id FROM x AS a JOIN y AS b ON a.id = b.id ORDER BY b.id", []string{"2", "3", "1"}},
+	}
+	for _, tt := range tests {
+		stmt, err := csv.ParseStatement(tt.query)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		q, err := csv.Prepare(stmt, head)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		sorter := csv.NewSorter(q, csv.SortOptions{})
+		for _, record := range [][]string{{"1", "3"}, {"2", "1"}, {"3", "2"}} {
+			row := head.NewRow()
+			row.Values = record
+			values, err := q.Project(row)
+			if assert.NoError(t, err, tt.query) {
+				assert.NoError(t, sorter.Add(row, values), tt.query)
+			}
+		}
+		var got []string
+		assert.NoError(t, sorter.Each(func(values []csv.Value) error {
+			got = append(got, values[len(values)-1].String())
+			return nil
+		}))
+		sorter.Close()
+		assert.Equal(t, tt.want, got, tt.query)
+	}
+}
+
+func TestSorterText(t *testing.T) {
+	head := &csv.Head{Fields: []csv.Field{{Name: "s", Type: csv.TypeString}}}
+	stmt, err := csv.ParseStatement("SELECT s ORDER BY s")
+	if !assert.NoError(t, err) {
+		return
+	}
+	q, err := csv.Prepare(stmt, head)
+	if !assert.NoError(t, err) {
+		return
+	}
+	sorter := csv.NewSorter(q, csv.SortOptions{})
+	defer sorter.Close()
+	for _, s := range []string{"9a", "100", "abc", "2", "10", "1a", "9"} {
+		row := head.NewRow()
+		row.Values = []string{s}
+		values, err := q.Project(row)
+		if assert.NoError(t, err) {
+			assert.NoError(t, sorter.Add(row, values))
+		}
+	}
+	var got []string
+	assert.NoError(t, sorter.Each(func(values []csv.Value) error {
+		got = append(got, values[0].String())
+		return nil
+	}))
+	// numeric-looking strings are text too, so the order is transitive
+	assert.Equal(t, []string{"10", "100", "1a", "2", "9", "9a", "abc"}, got)
+}
+
+func TestSorterTopSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csvq")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	head := &csv.Head{Fields: []csv.Field{{Name: "name", Type: csv.TypeString}}}
+	stmt, err := csv.ParseStatement("SELECT name ORDER BY name LIMIT 3")
+	if !assert.NoError(t, err) {
+		return
+	}
+	q, err := csv.Prepare(stmt, head)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// the heap of the first rows outgrows the budget and goes to disk
+	sorter := csv.NewSorter(q, csv.SortOptions{Memory: 1, TempDir: dir})
+	for _, name := range []string{"e", "b", "d", "a", "c"} {
+		row := head.NewRow()
+		row.Values = []string{name}
+		values, err := q.Project(row)
+		if assert.NoError(t, err) {
+			assert.NoError(t, sorter.Add(row, values))
+		}
+	}
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	var names []string
+	assert.NoError(t, sorter.Each(func(values []csv.Value) error {
+		names = append(names, values[0].String())
+		return nil
+	}))
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+	assert.NoError(t, sorter.Close())
+	files, err = ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,455 @@
+package csv
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Statement is a parsed query
+//
+//	SELECT first_name, last_name AS name FROM my.csv WHERE age > 40 ORDER BY name LIMIT 20
+//	SELECT continent, SUM(new_cases) FROM covid GROUP BY continent HAVING COUNT(*) > 10
+//
+// A bare condition is a statement selecting * from the default table.
+// Limit is nil without LIMIT. Into is the path of INTO 'out.csv' ending
+// the statement, the result is written to the file instead of the terminal.
+type Statement struct {
+	Columns []SelectItem
+	From    *TableRef
+	Joins   []Join
+	Where   Expr
+	GroupBy []Expr
+	Having  Expr
+	OrderBy []OrderItem
+	Limit   *int64
+	Offset  int64
+	Into    string
+}
+
+// SelectItem is an entry of the select list, Star stands for all columns
+// or all columns of Table if it is not empty.
+type SelectItem struct {
+	Expr  Expr
+	Alias string
+	Star  bool
+	Table string
+}
+
+// Join is a JOIN clause, Kind is INNER, LEFT or CROSS. On is nil for CROSS JOIN.
+type Join struct {
+	Kind  string
+	Table *TableRef
+	On    Expr
+}
+
+// OrderItem is a key of ORDER BY: an expression, a name of a result column
+// or its number counting from 1. NULLs go last in ascending order and first
+// in descending one unless NULLS FIRST or NULLS LAST is given.
+type OrderItem struct {
+	Expr       Expr
+	Desc       bool
+	NullsFirst bool
+}
+
+// TableRef names a file path or a table configured in config.toml.
+type TableRef struct {
+	Name   string
+	Alias  string
+	Offset int
+}
+
+// Qualifier returns the name qualifying columns of the table: the alias,
+// or the file name without directory and extension.
+func (r *TableRef) Qualifier() string {
+	if r.Alias != "" {
+		return r.Alias
+	}
+	name := filepath.Base(r.Name)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+func (r *TableRef) String() string {
+	if r.Alias != "" {
+		return r.Name + " AS " + r.Alias
+	}
+	return r.Name
+}
+
+func (s *Statement) String() string {
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	for i, item := range s.Columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(item.String())
+	}
+	if s.From != nil {
+		b.WriteString(" FROM " + s.From.String())
+	}
+	for _, join := range s.Joins {
+		b.WriteString(" " + join.Kind + " JOIN " + join.Table.String())
+		if join.On != nil {
+			b.WriteString(" ON " + join.On.String())
+		}
+	}
+	if s.Where != nil {
+		b.WriteString(" WHERE " + s.Where.String())
+	}
+	for i, e := range s.GroupBy {
+		if i == 0 {
+			b.WriteString(" GROUP BY ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(e.String())
+	}
+	if s.Having != nil {
+		b.WriteString(" HAVING " + s.Having.String())
+	}
+	for i, item := range s.OrderBy {
+		if i == 0 {
+			b.WriteString(" ORDER BY ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(item.String())
+	}
+	if s.Limit != nil {
+		b.WriteString(" LIMIT " + strconv.FormatInt(*s.Limit, 10))
+	}
+	if s.Offset > 0 {
+		b.WriteString(" OFFSET " + strconv.FormatInt(s.Offset, 10))
+	}
+	if s.Into != "" {
+		b.WriteString(" INTO '" + strings.ReplaceAll(s.Into, "'", "''") + "'")
+	}
+	return b.String()
+}
+
+func (item OrderItem) String() string {
+	s := item.Expr.String()
+	if item.Desc {
+		s += " DESC"
+	}
+	if item.NullsFirst != item.Desc {
+		if item.NullsFirst {
+			s += " NULLS FIRST"
+		} else {
+			s += " NULLS LAST"
+		}
+	}
+	return s
+}
+
+func (item SelectItem) String() string {
+	if item.Star && item.Table != "" {
+		return item.Table + ".*"
+	}
+	if item.Star {
+		return "*"
+	}
+	if item.Alias != "" {
+		return item.Expr.String() + " AS " + item.Alias
+	}
+	return item.Expr.String()
+}
+
+// ParseStatement parses a SELECT statement or a bare condition.
+// Errors are of type *SyntaxError.
+func ParseStatement(query string) (*Statement, error) {
+	toks, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: query, toks: toks}
+	stmt := &Statement{}
+	switch tok := p.peek(); {
+	case isKeyword(tok, "SELECT"):
+		p.next()
+		if err = p.parseSelect(stmt); err != nil {
+			return nil, err
+		}
+	case tok.Kind == tokEOF:
+		stmt.Columns = []SelectItem{{Star: true}}
+		return stmt, nil
+	case isKeyword(tok, "ORDER"), isKeyword(tok, "LIMIT"), isKeyword(tok, "OFFSET"):
+		stmt.Columns = []SelectItem{{Star: true}}
+	default:
+		stmt.Columns = []SelectItem{{Star: true}}
+		if isKeyword(tok, "WHERE") {
+			p.next()
+		}
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if isKeyword(p.peek(), "ORDER") {
+		if stmt.OrderBy, err = p.parseOrderBy(); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.parseLimit(stmt); err != nil {
+		return nil, err
+	}
+	if isKeyword(p.peek(), "INTO") {
+		p.next()
+		tok := p.next()
+		if tok.Kind != tokString || tok.Val == "" {
+			return nil, p.unexpected(tok, "file name")
+		}
+		stmt.Into = tok.Val
+	}
+	if tok := p.peek(); tok.Kind != tokEOF {
+		return nil, p.unexpected(tok, "end of query")
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseSelect(stmt *Statement) (err error) {
+	if stmt.Columns, err = p.parseSelectList(); err != nil {
+		return err
+	}
+	if isKeyword(p.peek(), "FROM") {
+		p.next()
+		if stmt.From, err = p.parseTableRef(); err != nil {
+			return err
+		}
+		if stmt.Joins, err = p.parseJoins(); err != nil {
+			return err
+		}
+	}
+	if isKeyword(p.peek(), "WHERE") {
+		p.next()
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return err
+		}
+	}
+	if isKeyword(p.peek(), "GROUP") {
+		p.next()
+		if tok := p.next(); !isKeyword(tok, "BY") {
+			return p.unexpected(tok, "BY")
+		}
+		if stmt.GroupBy, err = p.parseExprList(); err != nil {
+			return err
+		}
+	}
+	if isKeyword(p.peek(), "HAVING") {
+		p.next()
+		if stmt.Having, err = p.parseExpr(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseJoins parses [INNER] JOIN t ON cond, LEFT [OUTER] JOIN t ON cond and CROSS JOIN t.
+func (p *parser) parseJoins() ([]Join, error) {
+	var joins []Join
+	for {
+		join := Join{Kind: "INNER"}
+		switch tok := p.peek(); {
+		case isKeyword(tok, "JOIN"):
+		case isKeyword(tok, "INNER"):
+			p.next()
+		case isKeyword(tok, "LEFT"):
+			p.next()
+			join.Kind = "LEFT"
+			if isKeyword(p.peek(), "OUTER") {
+				p.next()
+			}
+		case isKeyword(tok, "CROSS"):
+			p.next()
+			join.Kind = "CROSS"
+		default:
+			return joins, nil
+		}
+		if tok := p.next(); !isKeyword(tok, "JOIN") {
+			return nil, p.unexpected(tok, "JOIN")
+		}
+		var err error
+		if join.Table, err = p.parseTableRef(); err != nil {
+			return nil, err
+		}
+		if join.Kind != "CROSS" {
+			if tok := p.next(); !isKeyword(tok, "ON") {
+				return nil, p.unexpected(tok, "ON")
+			}
+			if join.On, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+		joins = append(joins, join)
+	}
+}
+
+// parseExprList parses expressions separated by commas.
+func (p *parser) parseExprList() ([]Expr, error) {
+	var list []Expr
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+		if !isOp(p.peek(), ",") {
+			return list, nil
+		}
+		p.next()
+	}
+}
+
+// parseOrderBy parses ORDER BY key [ASC|DESC] [NULLS FIRST|LAST], ...
+func (p *parser) parseOrderBy() ([]OrderItem, error) {
+	p.next()
+	if tok := p.next(); !isKeyword(tok, "BY") {
+		return nil, p.unexpected(tok, "BY")
+	}
+	var items []OrderItem
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		item := OrderItem{Expr: expr}
+		switch tok := p.peek(); {
+		case isKeyword(tok, "DESC"):
+			p.next()
+			item.Desc = true
+		case isKeyword(tok, "ASC"):
+			p.next()
+		}
+		item.NullsFirst = item.Desc
+		if isKeyword(p.peek(), "NULLS") {
+			p.next()
+			switch tok := p.next(); {
+			case isKeyword(tok, "FIRST"):
+				item.NullsFirst = true
+			case isKeyword(tok, "LAST"):
+				item.NullsFirst = false
+			default:
+				return nil, p.unexpected(tok, "FIRST or LAST")
+			}
+		}
+		items = append(items, item)
+		if !isOp(p.peek(), ",") {
+			return items, nil
+		}
+		p.next()
+	}
+}
+
+// parseLimit parses optional LIMIT n and OFFSET m.
+func (p *parser) parseLimit(stmt *Statement) error {
+	if isKeyword(p.peek(), "LIMIT") {
+		p.next()
+		n, err := p.parseCount()
+		if err != nil {
+			return err
+		}
+		stmt.Limit = &n
+	}
+	if isKeyword(p.peek(), "OFFSET") {
+		p.next()
+		n, err := p.parseCount()
+		if err != nil {
+			return err
+		}
+		stmt.Offset = n
+	}
+	return nil
+}
+
+// parseCount parses a non-negative number of rows.
+func (p *parser) parseCount() (int64, error) {
+	tok := p.next()
+	if tok.Kind != tokNumber {
+		return 0, p.unexpected(tok, "number of rows")
+	}
+	n, err := strconv.ParseInt(tok.Text, 10, 64)
+	if err != nil {
+		return 0, p.unexpected(tok, "number of rows")
+	}
+	return n, nil
+}
+
+func (p *parser) parseSelectList() ([]SelectItem, error) {
+	var items []SelectItem
+	for {
+		var item SelectItem
+		switch {
+		case isOp(p.peek(), "*"):
+			p.next()
+			item.Star = true
+		case p.peek().Kind == tokIdent && isOp(p.toks[p.i+1], ".") && isOp(p.toks[p.i+2], "*"):
+			item.Star, item.Table = true, p.next().Val
+			p.next()
+			p.next()
+		default:
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item.Expr = expr
+			if item.Alias, err = p.parseAlias(); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+		if !isOp(p.peek(), ",") {
+			return items, nil
+		}
+		p.next()
+	}
+}
+
+// parseAlias parses an optional [AS] name.
+func (p *parser) parseAlias() (string, error) {
+	tok := p.peek()
+	if isKeyword(tok, "AS") {
+		p.next()
+		tok = p.next()
+		if tok.Kind != tokIdent && tok.Kind != tokQuotedIdent && tok.Kind != tokString || isReserved(tok) {
+			return "", p.unexpected(tok, "alias")
+		}
+		return tok.Val, nil
+	}
+	// LEFT is not reserved to keep it a valid name, but it starts LEFT JOIN after a table
+	if tok.Kind == tokQuotedIdent || tok.Kind == tokIdent && !isReserved(tok) && !isKeyword(tok, "LEFT") {
+		p.next()
+		return tok.Val, nil
+	}
+	return "", nil
+}
+
+// parseTableRef parses a quoted path or a table name, an unquoted path
+// like data/owid-covid-data.csv is the run of tokens without spaces between them.
+func (p *parser) parseTableRef() (*TableRef, error) {
+	tok := p.next()
+	ref := &TableRef{Name: tok.Val, Offset: tok.Pos}
+	switch {
+	case tok.Kind == tokString || tok.Kind == tokQuotedIdent:
+	case tok.Kind == tokIdent && !isReserved(tok) || isOp(tok, ".", "/"):
+		end := tok.End
+		for next := p.peek(); next.Pos == end && isPathPart(next); next = p.peek() {
+			p.next()
+			end = next.End
+		}
+		ref.Name = p.source(tok.Pos, end)
+	default:
+		return nil, p.unexpected(tok, "file or table name")
+	}
+	var err error
+	ref.Alias, err = p.parseAlias()
+	return ref, err
+}
+
+func isPathPart(tok token) bool {
+	return tok.Kind == tokIdent || tok.Kind == tokNumber || isOp(tok, ".", "/", "-")
+}
+
+// source returns the query text between two offsets.
+func (p *parser) source(from, to int) string {
+	return p.src[from:to]
+}
@@ -0,0 +1,99 @@
+package csv_test
+
+import (
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{"continent='Asia' AND date>'2020-04-14'", "SELECT * WHERE ((continent = 'Asia') AND (date > '2020-04-14'))"},
+		{"WHERE age > 40", "SELECT * WHERE (age > 40)"},
+		{"", "SELECT *"},
+		{`SELECT first_name, last_name FROM my.csv WHERE age > 40 AND status = "sick"`,
+			"SELECT first_name, last_name FROM my.csv WHERE ((age > 40) AND (status = 'sick'))"},
+		{"select *, location AS loc, `date` d from test/data/owid-covid-data.csv as o",
+			"SELECT *, location AS loc, date AS d FROM test/data/owid-covid-data.csv AS o"},
+		{"SELECT upper(iso_code) AS code FROM 'C:\\data\\my file.csv'", "SELECT UPPER(iso_code) AS code FROM C:\\data\\my file.csv"},
+		{"SELECT * FROM covid", "SELECT * FROM covid"},
+		{"SELECT a FROM x WHERE b > 1 ORDER BY a DESC, lower(c) NULLS FIRST, 2 desc nulls last",
+			"SELECT a FROM x WHERE (b > 1) ORDER BY a DESC, LOWER(c) NULLS FIRST, 2 DESC NULLS LAST"},
+		{"age > 40 ORDER BY age", "SELECT * WHERE (age > 40) ORDER BY age"},
+		{"ORDER BY age", "SELECT * ORDER BY age"},
+		{"SELECT a FROM x ORDER BY a LIMIT 20 OFFSET 40", "SELECT a FROM x ORDER BY a LIMIT 20 OFFSET 40"},
+		{"age > 40 limit 0", "SELECT * WHERE (age > 40) LIMIT 0"},
+		{"OFFSET 5", "SELECT * OFFSET 5"},
+		{"SELECT continent, count(*), SUM(DISTINCT new_cases) FROM covid WHERE x > 1 GROUP BY continent, y HAVING count(*) > 1",
+			"SELECT continent, COUNT(*), SUM(DISTINCT new_cases) FROM covid WHERE (x > 1) GROUP BY continent, y HAVING (COUNT(*) > 1)"},
+		{"SELECT a.*, b.region FROM a.csv AS a JOIN b.csv AS b ON a.iso_code = b.code",
+			"SELECT a.*, b.region FROM a.csv AS a INNER JOIN b.csv AS b ON (a.iso_code = b.code)"},
+		{"SELECT * FROM a left outer join b on a.x = b.y AND b.z > 1", "SELECT * FROM a LEFT JOIN b ON ((a.x = b.y) AND (b.z > 1))"},
+		{"SELECT * FROM a CROSS JOIN b WHERE a.x = 1", "SELECT * FROM a CROSS JOIN b WHERE (a.x = 1)"},
+		{"SELECT a FROM x ORDER BY a LIMIT 10 INTO 'out/top''s.csv.gz'", "SELECT a FROM x ORDER BY a LIMIT 10 INTO 'out/top''s.csv.gz'"},
+		{"age > 40 into \"out.json\"", "SELECT * WHERE (age > 40) INTO 'out.json'"},
+	}
+	for _, tt := range tests {
+		got, err := csv.ParseStatement(tt.query)
+		if assert.NoError(t, err, tt.query) {
+			assert.Equal(t, tt.want, got.String(), tt.query)
+		}
+	}
+
+	for _, query := range []string{
+		"SELECT", "SELECT FROM x", "SELECT a FROM", "SELECT a, FROM x", "SELECT a FROM x WHERE", "SELECT a AS FROM x",
+		"SELECT a FROM my .csv", "SELECT a FROM x y z",
+		"SELECT a ORDER a", "SELECT a ORDER BY", "SELECT a ORDER BY a NULLS", "SELECT a ORDER BY a,",
+		"SELECT a LIMIT", "SELECT a LIMIT -1", "SELECT a LIMIT 1.5", "SELECT a LIMIT 1 OFFSET x", "SELECT a OFFSET 1 LIMIT 1",
+		"SELECT a GROUP a", "SELECT a GROUP BY", "SELECT SUM(*)", "SELECT COUNT(DISTINCT *)", "SELECT COUNT(a, b)",
+		"SELECT * FROM a JOIN b", "SELECT * FROM a JOIN ON x", "SELECT * FROM a LEFT b ON x", "SELECT * FROM a CROSS JOIN b ON x",
+		"SELECT a. FROM x", "SELECT a.b.c FROM x",
+		"SELECT a INTO", "SELECT a INTO out.csv", "SELECT a INTO ''", "SELECT a INTO 'out.csv' LIMIT 1",
+	} {
+		_, err := csv.ParseStatement(query)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	head := &csv.Head{Fields: []csv.Field{
+		{Name: "first_name", Type: csv.TypeString},
+		{Name: "last_name", Type: csv.TypeString},
+		{Name: "age", Type: csv.TypeInt},
+	}}
+	stmt, err := csv.ParseStatement("SELECT last_name AS name, age, lower(first_name), * FROM my.csv WHERE age > 40")
+	if !assert.NoError(t, err) {
+		return
+	}
+	q, err := csv.Prepare(stmt, head)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []csv.Field{
+		{Name: "name", Type: csv.TypeString},
+		{Name: "age", Type: csv.TypeInt},
+		{Name: "LOWER(first_name)", Type: csv.TypeNull},
+		{Name: "first_name", Type: csv.TypeString},
+		{Name: "last_name", Type: csv.TypeString},
+		{Name: "age", Type: csv.TypeInt},
+	}, q.Columns)
+
+	row := head.NewRow()
+	row.Values = []string{"Ivan", "Petrov", "41"}
+	ok, err := q.Match(row)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	values, err := q.Project(row)
+	assert.NoError(t, err)
+	assert.Equal(t, []csv.Value{
+		csv.StringValue("Petrov"), csv.IntValue(41), csv.StringValue("ivan"),
+		csv.StringValue("Ivan"), csv.StringValue("Petrov"), csv.IntValue(41),
+	}, values)
+
+	stmt, _ = csv.ParseStatement("SELECT middle_name FROM my.csv")
+	_, err = csv.Prepare(stmt, head)
+	assert.Error(t, err)
+}
@@ -0,0 +1,293 @@
+package csv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is a data type of a value.
+type Type int
+
+const (
+	TypeNull Type = iota
+	TypeString
+	TypeInt
+	TypeFloat
+	TypeBool
+	TypeDate
+)
+
+// ParseType returns the type with the given name as written in config.toml.
+func ParseType(name string) (Type, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "string", "":
+		return TypeString, nil
+	case "int":
+		return TypeInt, nil
+	case "float":
+		return TypeFloat, nil
+	case "bool":
+		return TypeBool, nil
+	case "date", "datetime":
+		return TypeDate, nil
+	default:
+		return TypeNull, fmt.Errorf("unknown type %q", name)
+	}
+}
+
+func (t *Type) UnmarshalText(text []byte) (err error) {
+	*t, err = ParseType(string(text))
+	return err
+}
+
+func (t Type) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t Type) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeInt:
+		return "int"
+	case TypeFloat:
+		return "float"
+	case TypeBool:
+		return "bool"
+	case TypeDate:
+		return "date"
+	default:
+		return "null"
+	}
+}
+
+// Value is a typed result of an expression.
+type Value struct {
+	Type  Type
+	Str   string
+	Int   int64
+	Float float64
+	Bool  bool
+	Time  time.Time
+}
+
+var Null = Value{Type: TypeNull}
+
+func StringValue(s string) Value {
+	return Value{Type: TypeString, Str: s}
+}
+
+func IntValue(i int64) Value {
+	return Value{Type: TypeInt, Int: i}
+}
+
+func FloatValue(f float64) Value {
+	return Value{Type: TypeFloat, Float: f}
+}
+
+func BoolValue(b bool) Value {
+	return Value{Type: TypeBool, Bool: b}
+}
+
+func DateValue(t time.Time) Value {
+	return Value{Type: TypeDate, Time: t}
+}
+
+func (v Value) IsNull() bool {
+	return v.Type == TypeNull
+}
+
+func (v Value) String() string {
+	switch v.Type {
+	case TypeString:
+		return v.Str
+	case TypeInt:
+		return strconv.FormatInt(v.Int, 10)
+	case TypeFloat:
+		return strconv.FormatFloat(v.Float, 'f', -1, 64)
+	case TypeBool:
+		return strconv.FormatBool(v.Bool)
+	case TypeDate:
+		if v.Time.Hour() == 0 && v.Time.Minute() == 0 && v.Time.Second() == 0 && v.Time.Nanosecond() == 0 {
+			return v.Time.Format(dateLayouts[0])
+		}
+		return v.Time.Format(time.RFC3339)
+	default:
+		return ""
+	}
+}
+
+// dateLayouts are tried in turn when a date is parsed.
+var dateLayouts = []string{"2006-01-02", time.RFC3339, "2006-01-02 15:04:05", "02.01.2006"}
+
+func parseDate(s string) (time.Time, error) {
+	var err error
+	for _, layout := range dateLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as date", s)
+}
+
+// ParseValue converts the raw text of a field to type t.
+// An empty field is NULL, as well as a blank one of a non-string type.
+func ParseValue(raw string, t Type) (Value, error) {
+	if raw == "" {
+		return Null, nil
+	}
+	if t == TypeString {
+		return StringValue(raw), nil
+	}
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return Null, nil
+	}
+	switch t {
+	case TypeInt:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return IntValue(i), nil
+		}
+		// "1.0" is a valid int in exported data
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f == float64(int64(f)) {
+			return IntValue(int64(f)), nil
+		}
+	case TypeFloat:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return FloatValue(f), nil
+		}
+	case TypeBool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return BoolValue(b), nil
+		}
+	case TypeDate:
+		if d, err := parseDate(s); err == nil {
+			return DateValue(d), nil
+		}
+	}
+	return Null, fmt.Errorf("cannot parse %q as %s", raw, t)
+}
+
+// coerce converts v to type t, strings are parsed and ints widened to floats.
+func coerce(v Value, t Type) (Value, error) {
+	switch {
+	case v.IsNull() || v.Type == t:
+		return v, nil
+	case v.Type == TypeString:
+		return ParseValue(v.Str, t)
+	case v.Type == TypeInt && t == TypeFloat:
+		return FloatValue(float64(v.Int)), nil
+	case v.Type == TypeFloat && t == TypeInt && v.Float == float64(int64(v.Float)):
+		return IntValue(int64(v.Float)), nil
+	case t == TypeString:
+		return StringValue(v.String()), nil
+	default:
+		return Null, fmt.Errorf("cannot use %s as %s", v, t)
+	}
+}
+
+// foldCase lower-cases a string value for case-insensitive comparison.
+func foldCase(v Value) Value {
+	if v.Type != TypeString {
+		return v
+	}
+	return StringValue(strings.ToLower(v.Str))
+}
+
+// number returns a numeric view of the value, strings are parsed.
+func (v Value) number() (float64, bool) {
+	switch v.Type {
+	case TypeInt:
+		return float64(v.Int), true
+	case TypeFloat:
+		return v.Float, true
+	case TypeString:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v.Str), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// compare orders two values, ok is false if one of them is NULL.
+// Values are compared by type: two strings as text, numbers and a number with
+// a numeric string as numbers, dates as time, everything else as text.
+func compare(a, b Value) (res int, ok bool) {
+	if a.IsNull() || b.IsNull() {
+		return 0, false
+	}
+	switch {
+	case a.Type == TypeString && b.Type == TypeString:
+		return strings.Compare(a.Str, b.Str), true
+	case a.Type == TypeString:
+		res, ok = compare(b, a)
+		return -res, ok
+	}
+	switch {
+	case a.Type == TypeBool && b.Type == TypeBool:
+		return compareBool(a.Bool, b.Bool), true
+	case a.Type == TypeInt && b.Type == TypeInt:
+		return compareInt(a.Int, b.Int), true
+	case a.Type == TypeDate:
+		if d, err := coerce(b, TypeDate); err == nil && !d.IsNull() {
+			return compareTime(a.Time, d.Time), true
+		}
+	case a.Type == TypeBool:
+		if d, err := coerce(b, TypeBool); err == nil && !d.IsNull() {
+			return compareBool(a.Bool, d.Bool), true
+		}
+	}
+	if x, isNum := a.number(); isNum {
+		if y, isNum := b.number(); isNum {
+			return compareFloat(x, y), true
+		}
+	}
+	return strings.Compare(a.String(), b.String()), true
+}
+
+func compareFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareInt(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareTime(x, y time.Time) int {
+	switch {
+	case x.Before(y):
+		return -1
+	case x.After(y):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareBool(x, y bool) int {
+	switch {
+	case x == y:
+		return 0
+	case y:
+		return -1
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,129 @@
+package csv_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		raw     string
+		typ     csv.Type
+		want    csv.Value
+		wantErr bool
+	}{
+		{"99.0", csv.TypeFloat, csv.FloatValue(99), false},
+		{"100", csv.TypeInt, csv.IntValue(100), false},
+		{"1.0", csv.TypeInt, csv.IntValue(1), false},
+		{"1.5", csv.TypeInt, csv.Null, true},
+		{"", csv.TypeInt, csv.Null, false},
+		{"true", csv.TypeBool, csv.BoolValue(true), false},
+		{"2020-04-14", csv.TypeDate, csv.DateValue(time.Date(2020, 4, 14, 0, 0, 0, 0, time.UTC)), false},
+		{"2020/04/14", csv.TypeDate, csv.Null, true},
+		{"", csv.TypeString, csv.Null, false},
+		{" ", csv.TypeString, csv.StringValue(" "), false},
+	}
+	for _, tt := range tests {
+		got, err := csv.ParseValue(tt.raw, tt.typ)
+		assert.Equal(t, tt.wantErr, err != nil, tt.raw)
+		assert.Equal(t, tt.want, got, tt.raw)
+	}
+}
+
+func TestTypedCompile(t *testing.T) {
+	head := &csv.Head{Fields: []csv.Field{
+		{Name: "total_cases", Type: csv.TypeFloat},
+		{Name: "date", Type: csv.TypeDate},
+		{Name: "flag", Type: csv.TypeBool},
+	}}
+	tests := []struct {
+		query  string
+		values []string
+		want   bool
+	}{
+		{"total_cases > 100", []string{"99.0", "", ""}, false},
+		{"total_cases > 100", []string{"100.5", "", ""}, true},
+		{"total_cases > '100'", []string{"1000.0", "", ""}, true},
+		{"date > '2020-04-14'", []string{"", "2020-04-15", ""}, true},
+		{"date >= '2020-04-14T00:00:00Z'", []string{"", "2020-04-14", ""}, true},
+		{"flag = true", []string{"", "", "TRUE"}, true},
+		{"total_cases > 1 or date > '2020-01-01'", []string{"oops", "2020-04-15", ""}, true},
+		{"total_cases < 1", []string{"oops", "", ""}, false},
+	}
+	for _, tt := range tests {
+		pred, err := csv.Compile(tt.query, head)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		row := head.NewRow()
+		row.Values = tt.values
+		got, err := pred(row)
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.want, got, tt.query)
+	}
+
+	_, err := csv.Compile("date > 'yesterday'", head)
+	assert.Error(t, err)
+
+	strict := *head
+	strict.Strict = true
+	pred, err := csv.Compile("total_cases < 1", &strict)
+	if assert.NoError(t, err) {
+		row := strict.NewRow()
+		row.Values = []string{"oops", "", ""}
+		_, err = pred(row)
+		assert.Error(t, err)
+	}
+
+	ints := &csv.Head{Fields: []csv.Field{{Name: "v", Type: csv.TypeInt}}}
+	for _, tt := range []struct {
+		query string
+		value string
+		want  bool
+	}{
+		{"v > 7.5", "8", true},
+		{"v > 7.5", "7", false},
+		{"v < '7.5'", "7", true},
+		{"v = 7.5", "7", false},
+		{"v BETWEEN 6.5 AND 7.5", "7", true},
+		{"v IN (7.5, 8.0)", "8", true},
+	} {
+		pred, err := csv.Compile(tt.query, ints)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		row := ints.NewRow()
+		row.Values = []string{tt.value}
+		got, err := pred(row)
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.want, got, tt.query)
+	}
+}
+
+func TestCompareText(t *testing.T) {
+	head := &csv.Head{Fields: []csv.Field{{Name: "s", Type: csv.TypeString}}}
+	tests := []struct {
+		query string
+		value string
+		want  bool
+	}{
+		{"s = '1'", "1.0", false},
+		{"s < '9'", "10", true},
+		{"s > 9", "10", true},
+		{"s = 1", "1.0", true},
+	}
+	for _, tt := range tests {
+		pred, err := csv.Compile(tt.query, head)
+		if !assert.NoError(t, err, tt.query) {
+			continue
+		}
+		row := head.NewRow()
+		row.Values = []string{tt.value}
+		got, err := pred(row)
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.want, got, tt.query)
+	}
+}
@@ -0,0 +1,403 @@
+package csv
+
+import (
+	"bufio"
+	stdcsv "encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Output formats of result rows.
+const (
+	FormatTable    = "table"
+	FormatCSV      = "csv"
+	FormatTSV      = "tsv"
+	FormatJSON     = "json"
+	FormatNDJSON   = "ndjson"
+	FormatMarkdown = "markdown"
+)
+
+// RowWriter writes result rows in some format. Flush writes what is buffered
+// and completes the output, no rows are written after it.
+type RowWriter interface {
+	WriteRow(values []Value) error
+	Flush() error
+}
+
+// Writers is the registry of output formats by lower-case name. A program
+// embedding the package may add its own format:
+//
+//	csv.Writers["xml"] = newXMLWriter
+var Writers = map[string]func(w io.Writer, columns []Field) RowWriter{
+	FormatTable:    newTableWriter,
+	FormatCSV:      newCSVWriter,
+	FormatTSV:      newTSVWriter,
+	FormatJSON:     newJSONWriter,
+	FormatNDJSON:   newNDJSONWriter,
+	FormatMarkdown: newMarkdownWriter,
+}
+
+// NewRowWriter returns the writer of the format for the result columns,
+// an empty format is a table.
+func NewRowWriter(format string, w io.Writer, columns []Field) (RowWriter, error) {
+	if format == "" {
+		format = FormatTable
+	}
+	newWriter, ok := Writers[strings.ToLower(format)]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(FormatNames(), ", "))
+	}
+	return newWriter(w, columns), nil
+}
+
+// FormatNames returns the sorted names of the registered formats.
+func FormatNames() []string {
+	names := make([]string, 0, len(Writers))
+	for name := range Writers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tableEscaper replaces the characters that break the lines of a table.
+var tableEscaper = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ")
+
+// tableRows is the number of the first rows the widths of the columns are
+// taken from. The rows after them are written at once, a wider value only
+// widens its own line.
+const tableRows = 1000
+
+// tableWriter aligns the columns to the first rows, NULL is printed as NULL.
+type tableWriter struct {
+	w       *bufio.Writer
+	columns []Field
+	rows    [][]string
+	widths  []int
+	border  string
+	count   int
+}
+
+func newTableWriter(w io.Writer, columns []Field) RowWriter {
+	return &tableWriter{w: bufio.NewWriter(w), columns: columns}
+}
+
+func (t *tableWriter) WriteRow(values []Value) error {
+	row := make([]string, len(values))
+	for i, v := range values {
+		row[i] = "NULL"
+		if !v.IsNull() {
+			row[i] = tableEscaper.Replace(v.String())
+		}
+	}
+	t.count++
+	if t.widths != nil {
+		t.line(row, t.widths, true)
+		return nil
+	}
+	t.rows = append(t.rows, row)
+	if len(t.rows) >= tableRows {
+		t.writeHeader()
+	}
+	return nil
+}
+
+// writeHeader takes the widths of the columns from the rows kept and writes
+// the header and the rows.
+func (t *tableWriter) writeHeader() {
+	t.widths = make([]int, len(t.columns))
+	for i, column := range t.columns {
+		t.widths[i] = utf8.RuneCountInString(column.Name)
+	}
+	for _, row := range t.rows {
+		for i, s := range row {
+			if n := utf8.RuneCountInString(s); i < len(t.widths) && n > t.widths[i] {
+				t.widths[i] = n
+			}
+		}
+	}
+	t.border = "+"
+	for _, width := range t.widths {
+		t.border += strings.Repeat("-", width+2) + "+"
+	}
+	fmt.Fprintln(t.w, t.border)
+	t.line(columnNames(t.columns), t.widths, false)
+	fmt.Fprintln(t.w, t.border)
+	for _, row := range t.rows {
+		t.line(row, t.widths, true)
+	}
+	t.rows = nil
+}
+
+func (t *tableWriter) Flush() error {
+	if t.widths == nil {
+		t.writeHeader()
+	}
+	if t.count > 0 {
+		fmt.Fprintln(t.w, t.border)
+	}
+	if t.count == 1 {
+		fmt.Fprintln(t.w, "(1 row)")
+	} else {
+		fmt.Fprintf(t.w, "(%d rows)\n", t.count)
+	}
+	t.widths, t.count = nil, 0
+	return t.w.Flush()
+}
+
+// line writes the cells padded to widths, numbers are aligned to the right.
+func (t *tableWriter) line(cells []string, widths []int, values bool) {
+	t.w.WriteString("|")
+	for i, s := range cells {
+		if i >= len(widths) {
+			break
+		}
+		pad := ""
+		if n := widths[i] - utf8.RuneCountInString(s); n > 0 {
+			pad = strings.Repeat(" ", n)
+		}
+		if values && isNumeric(t.columns[i].Type) {
+			s = pad + s
+		} else {
+			s += pad
+		}
+		t.w.WriteString(" " + s + " |")
+	}
+	t.w.WriteString("\n")
+}
+
+func isNumeric(t Type) bool {
+	return t == TypeInt || t == TypeFloat
+}
+
+// csvWriter writes RFC 4180 records with a header, NULL is an empty field.
+type csvWriter struct {
+	w      *stdcsv.Writer
+	header []string
+}
+
+func newCSVWriter(w io.Writer, columns []Field) RowWriter {
+	return &csvWriter{w: stdcsv.NewWriter(w), header: columnNames(columns)}
+}
+
+func (c *csvWriter) WriteRow(values []Value) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = v.String()
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.header == nil {
+		return nil
+	}
+	err := c.w.Write(c.header)
+	c.header = nil
+	return err
+}
+
+func (c *csvWriter) Flush() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func columnNames(columns []Field) []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// tsvEscaper escapes the characters that cannot appear in a TSV field.
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// tsvWriter writes tab separated lines with a header, tabs, line breaks
+// and backslashes in values are escaped as \t, \n, \r and \\.
+type tsvWriter struct {
+	w      *bufio.Writer
+	header []string
+}
+
+func newTSVWriter(w io.Writer, columns []Field) RowWriter {
+	return &tsvWriter{w: bufio.NewWriter(w), header: columnNames(columns)}
+}
+
+func (t *tsvWriter) WriteRow(values []Value) error {
+	t.writeHeader()
+	for i, v := range values {
+		if i > 0 {
+			t.w.WriteByte('\t')
+		}
+		t.w.WriteString(tsvEscaper.Replace(v.String()))
+	}
+	_, err := t.w.WriteString("\n")
+	return err
+}
+
+func (t *tsvWriter) writeHeader() {
+	if t.header == nil {
+		return
+	}
+	for i, name := range t.header {
+		if i > 0 {
+			t.w.WriteByte('\t')
+		}
+		t.w.WriteString(tsvEscaper.Replace(name))
+	}
+	t.w.WriteString("\n")
+	t.header = nil
+}
+
+func (t *tsvWriter) Flush() error {
+	t.writeHeader()
+	return t.w.Flush()
+}
+
+// jsonObject encodes the row as an object with the column names as keys in
+// the order of the columns. Numbers and booleans are JSON ones, dates are strings.
+func jsonObject(b *bufio.Writer, keys []string, values []Value) error {
+	b.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key := ""
+		if i < len(keys) {
+			key = keys[i]
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		switch v.Type {
+		case TypeNull:
+			b.WriteString("null")
+		case TypeInt, TypeFloat, TypeBool:
+			b.WriteString(v.String())
+		default:
+			s, err := json.Marshal(v.String())
+			if err != nil {
+				return err
+			}
+			b.Write(s)
+		}
+	}
+	b.WriteByte('}')
+	return nil
+}
+
+// jsonWriter writes an array of objects, one object per line.
+type jsonWriter struct {
+	w    *bufio.Writer
+	keys []string
+	rows int
+}
+
+func newJSONWriter(w io.Writer, columns []Field) RowWriter {
+	return &jsonWriter{w: bufio.NewWriter(w), keys: columnNames(columns)}
+}
+
+func (j *jsonWriter) WriteRow(values []Value) error {
+	if j.rows == 0 {
+		j.w.WriteString("[\n")
+	} else {
+		j.w.WriteString(",\n")
+	}
+	j.rows++
+	return jsonObject(j.w, j.keys, values)
+}
+
+func (j *jsonWriter) Flush() error {
+	if j.rows == 0 {
+		j.w.WriteString("[]\n")
+	} else {
+		j.w.WriteString("\n]\n")
+	}
+	return j.w.Flush()
+}
+
+// ndjsonWriter writes an object per line.
+type ndjsonWriter struct {
+	w    *bufio.Writer
+	keys []string
+}
+
+func newNDJSONWriter(w io.Writer, columns []Field) RowWriter {
+	return &ndjsonWriter{w: bufio.NewWriter(w), keys: columnNames(columns)}
+}
+
+func (n *ndjsonWriter) WriteRow(values []Value) error {
+	if err := jsonObject(n.w, n.keys, values); err != nil {
+		return err
+	}
+	return n.w.WriteByte('\n')
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
+
+// markdownEscaper escapes the pipes and line breaks in a table cell.
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+// markdownWriter writes a GitHub flavored Markdown table, numeric columns
+// are aligned to the right.
+type markdownWriter struct {
+	w       *bufio.Writer
+	columns []Field
+	header  bool
+}
+
+func newMarkdownWriter(w io.Writer, columns []Field) RowWriter {
+	return &markdownWriter{w: bufio.NewWriter(w), columns: columns, header: true}
+}
+
+func (m *markdownWriter) WriteRow(values []Value) error {
+	m.writeHeader()
+	cells := make([]string, len(values))
+	for i, v := range values {
+		cells[i] = "NULL"
+		if !v.IsNull() {
+			cells[i] = markdownEscaper.Replace(v.String())
+		}
+	}
+	_, err := m.w.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	return err
+}
+
+func (m *markdownWriter) writeHeader() {
+	if !m.header {
+		return
+	}
+	names := make([]string, len(m.columns))
+	rules := make([]string, len(m.columns))
+	for i, column := range m.columns {
+		names[i] = markdownEscaper.Replace(column.Name)
+		rules[i] = "---"
+		if isNumeric(column.Type) {
+			rules[i] = "--:"
+		}
+	}
+	m.w.WriteString("| " + strings.Join(names, " | ") + " |\n")
+	m.w.WriteString("|" + strings.Join(rules, "|") + "|\n")
+	m.header = false
+}
+
+func (m *markdownWriter) Flush() error {
+	m.writeHeader()
+	return m.w.Flush()
+}
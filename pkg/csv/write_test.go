@@ -0,0 +1,124 @@
+package csv_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AleksandrMac/csv_query/pkg/csv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRowWriters(t *testing.T) {
+	columns := []csv.Field{
+		{Name: "location", Type: csv.TypeString},
+		{Name: "cases", Type: csv.TypeInt},
+		{Name: "rate", Type: csv.TypeFloat},
+		{Name: "date", Type: csv.TypeDate},
+	}
+	rows := [][]csv.Value{
+		{csv.StringValue("Côte d'Ivoire"), csv.IntValue(12), csv.FloatValue(0.5), date(2020, 4, 14)},
+		{csv.StringValue("a, \"b\"\tc|d\ne"), csv.IntValue(-3), csv.Null, csv.Null},
+	}
+	tests := []struct {
+		format, want string
+	}{
+		{csv.FormatTable, "" +
+			"+---------------+-------+------+------------+\n" +
+			"| location      | cases | rate | date       |\n" +
+			"+---------------+-------+------+------------+\n" +
+			"| Côte d'Ivoire |    12 |  0.5 | 2020-04-14 |\n" +
+			"| a, \"b\" c|d e  |    -3 | NULL | NULL       |\n" +
+			"+---------------+-------+------+------------+\n" +
+			"(2 rows)\n"},
+		{csv.FormatCSV, "" +
+			"location,cases,rate,date\n" +
+			"Côte d'Ivoire,12,0.5,2020-04-14\n" +
+			"\"a, \"\"b\"\"\tc|d\ne\",-3,,\n"},
+		{"TSV", "" +
+			"location\tcases\trate\tdate\n" +
+			"Côte d'Ivoire\t12\t0.5\t2020-04-14\n" +
+			"a, \"b\"\\tc|d\\ne\t-3\t\t\n"},
+		{csv.FormatJSON, "" +
+			"[\n" +
+			`{"location":"Côte d'Ivoire","cases":12,"rate":0.5,"date":"2020-04-14"},` + "\n" +
+			`{"location":"a, \"b\"\tc|d\ne","cases":-3,"rate":null,"date":null}` + "\n" +
+			"]\n"},
+		{csv.FormatNDJSON, "" +
+			`{"location":"Côte d'Ivoire","cases":12,"rate":0.5,"date":"2020-04-14"}` + "\n" +
+			`{"location":"a, \"b\"\tc|d\ne","cases":-3,"rate":null,"date":null}` + "\n"},
+		{csv.FormatMarkdown, "" +
+			"| location | cases | rate | date |\n" +
+			"|---|--:|--:|---|\n" +
+			"| Côte d'Ivoire | 12 | 0.5 | 2020-04-14 |\n" +
+			"| a, \"b\"\tc\\|d<br>e | -3 | NULL | NULL |\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w, err := csv.NewRowWriter(tt.format, &buf, columns)
+		if !assert.NoError(t, err, tt.format) {
+			continue
+		}
+		for _, row := range rows {
+			assert.NoError(t, w.WriteRow(row), tt.format)
+		}
+		assert.NoError(t, w.Flush(), tt.format)
+		assert.Equal(t, tt.want, buf.String(), tt.format)
+	}
+}
+
+func TestRowWritersEmpty(t *testing.T) {
+	columns := []csv.Field{{Name: "a", Type: csv.TypeInt}, {Name: "b", Type: csv.TypeString}}
+	tests := []struct {
+		format, want string
+	}{
+		{"", "+---+---+\n| a | b |\n+---+---+\n(0 rows)\n"},
+		{csv.FormatCSV, "a,b\n"},
+		{csv.FormatTSV, "a\tb\n"},
+		{csv.FormatJSON, "[]\n"},
+		{csv.FormatNDJSON, ""},
+		{csv.FormatMarkdown, "| a | b |\n|--:|---|\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w, err := csv.NewRowWriter(tt.format, &buf, columns)
+		if assert.NoError(t, err, tt.format) {
+			assert.NoError(t, w.Flush(), tt.format)
+			assert.Equal(t, tt.want, buf.String(), tt.format)
+		}
+	}
+
+	_, err := csv.NewRowWriter("xml", &bytes.Buffer{}, columns)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"csv", "json", "markdown", "ndjson", "table", "tsv"}, csv.FormatNames())
+}
+
+func TestTableWriterStream(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := csv.NewRowWriter(csv.FormatTable, &buf, []csv.Field{{Name: "name", Type: csv.TypeString}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	// the widths are taken from the first 1000 rows, which are written then
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, w.WriteRow([]csv.Value{csv.StringValue("ab")}))
+	}
+	assert.NotZero(t, buf.Len())
+	assert.NoError(t, w.WriteRow([]csv.Value{csv.StringValue("longer")}))
+	assert.NoError(t, w.Flush())
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, []string{"+------+", "| name |", "+------+", "| ab   |"}, lines[:4])
+	assert.Equal(t, []string{"| longer |", "+------+", "(1001 rows)", ""}, lines[len(lines)-4:])
+}
+
+func TestRowWriterDatetime(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := csv.NewRowWriter(csv.FormatNDJSON, &buf, []csv.Field{{Name: "at", Type: csv.TypeDate}, {Name: "ok"}})
+	if assert.NoError(t, err) {
+		at := csv.DateValue(time.Date(2020, 4, 14, 10, 30, 0, 0, time.UTC))
+		assert.NoError(t, w.WriteRow([]csv.Value{at, csv.BoolValue(true)}))
+		assert.NoError(t, w.Flush())
+		assert.Equal(t, `{"at":"2020-04-14T10:30:00Z","ok":true}`+"\n", buf.String())
+	}
+}
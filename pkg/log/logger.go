@@ -19,10 +19,10 @@ func New(conf Config) (*zap.Logger, error) {
 		err   error
 	)
 
-	if fInfo, err = os.OpenFile(conf.OutputPath, os.O_APPEND|os.O_CREATE, 0755); err != nil {
+	if fInfo, err = os.OpenFile(conf.OutputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
 		return nil, err
 	}
-	if fErr, err = os.OpenFile(conf.ErrorOutputPath, os.O_APPEND|os.O_CREATE, 0755); err != nil {
+	if fErr, err = os.OpenFile(conf.ErrorOutputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,380 @@
+// Package readline reads lines from a terminal with editing, history,
+// reverse search and completion.
+package readline
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInterrupt is returned by ReadLine when Ctrl-C is pressed.
+var ErrInterrupt = errors.New("interrupted")
+
+// Completer returns the candidates completing the word of the line that ends
+// at the byte offset pos of the cursor and starts at the byte offset start.
+type Completer func(line string, pos int) (start int, candidates []string)
+
+// Editor reads lines from the keys of a terminal in raw mode:
+//
+//	Left, Right, Home, End, Ctrl-A, Ctrl-E, Ctrl-B, Ctrl-F  move the cursor
+//	Backspace, Delete, Ctrl-K, Ctrl-U, Ctrl-W               delete
+//	Up, Down, Ctrl-P, Ctrl-N                                browse the history
+//	Ctrl-R                                                  search the history backwards
+//	Tab                                                     complete the word
+//	Ctrl-C                                                  discard the line
+//	Ctrl-D                                                  end of input on an empty line
+//
+// A character is assumed to take one column and the line to fit the screen.
+type Editor struct {
+	History  *History
+	Complete Completer
+
+	in  *bufio.Reader
+	out *bufio.Writer
+
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+// New returns an editor reading keys from in and drawing the line on out.
+func New(in io.Reader, out io.Writer) *Editor {
+	return &Editor{in: bufio.NewReader(in), out: bufio.NewWriter(out)}
+}
+
+// keys other than characters.
+const (
+	keyNone = -iota - 1
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyEsc
+)
+
+// control characters.
+const (
+	ctrlA     = 1
+	ctrlB     = 2
+	ctrlC     = 3
+	ctrlD     = 4
+	ctrlE     = 5
+	ctrlF     = 6
+	ctrlG     = 7
+	ctrlH     = 8
+	tab       = 9
+	lf        = 10
+	ctrlK     = 11
+	ctrlL     = 12
+	cr        = 13
+	ctrlN     = 14
+	ctrlP     = 16
+	ctrlR     = 18
+	ctrlU     = 21
+	ctrlW     = 23
+	esc       = 27
+	backspace = 127
+)
+
+// escapes are the keys sent as escape sequences.
+var escapes = map[string]rune{
+	"[A": keyUp, "[B": keyDown, "[C": keyRight, "[D": keyLeft,
+	"[H": keyHome, "[F": keyEnd, "OH": keyHome, "OF": keyEnd,
+	"[1~": keyHome, "[7~": keyHome, "[4~": keyEnd, "[8~": keyEnd, "[3~": keyDelete,
+	"OA": keyUp, "OB": keyDown, "OC": keyRight, "OD": keyLeft,
+}
+
+// readKey returns a character, a control character or one of the keys.
+func (e *Editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != esc {
+		return r, err
+	}
+	// a terminal sends an escape sequence at once, Esc alone is a key
+	if e.in.Buffered() == 0 {
+		return keyEsc, nil
+	}
+	b, err := e.in.ReadByte()
+	if err != nil {
+		return keyEsc, nil
+	}
+	if b != '[' && b != 'O' {
+		e.in.UnreadByte()
+		return keyEsc, nil
+	}
+	seq := []byte{b}
+	for len(seq) < 8 {
+		if b, err = e.in.ReadByte(); err != nil {
+			return keyNone, nil
+		}
+		seq = append(seq, b)
+		if b >= 0x40 && b <= 0x7e {
+			break
+		}
+	}
+	if key, ok := escapes[string(seq)]; ok {
+		return key, nil
+	}
+	return keyNone, nil
+}
+
+// ReadLine shows the prompt and returns the line entered. It returns ErrInterrupt
+// on Ctrl-C and io.EOF on Ctrl-D or the end of input on an empty line.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	e.prompt, e.buf, e.pos = prompt, nil, 0
+	var (
+		hist  = -1
+		saved []rune
+	)
+	e.refresh()
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			if len(e.buf) > 0 && err == io.EOF {
+				return e.enter(), nil
+			}
+			e.out.WriteString("\r\n")
+			e.out.Flush()
+			return "", err
+		}
+		if key == ctrlR {
+			if key = e.search(); key == keyNone {
+				continue
+			}
+		}
+		switch key {
+		case cr, lf:
+			return e.enter(), nil
+		case ctrlC:
+			e.out.WriteString("^C\r\n")
+			e.out.Flush()
+			return "", ErrInterrupt
+		case ctrlD:
+			if len(e.buf) == 0 {
+				e.out.WriteString("\r\n")
+				e.out.Flush()
+				return "", io.EOF
+			}
+			e.delete(e.pos, e.pos+1)
+		case keyUp, ctrlP, keyDown, ctrlN:
+			hist, saved = e.browse(key == keyUp || key == ctrlP, hist, saved)
+		default:
+			e.edit(key)
+		}
+		e.refresh()
+	}
+}
+
+// enter ends the line.
+func (e *Editor) enter() string {
+	e.pos = len(e.buf)
+	e.refresh()
+	e.out.WriteString("\r\n")
+	e.out.Flush()
+	return string(e.buf)
+}
+
+// edit handles the keys changing the line or moving the cursor.
+func (e *Editor) edit(key rune) {
+	switch key {
+	case keyLeft, ctrlB:
+		if e.pos > 0 {
+			e.pos--
+		}
+	case keyRight, ctrlF:
+		if e.pos < len(e.buf) {
+			e.pos++
+		}
+	case keyHome, ctrlA:
+		e.pos = 0
+	case keyEnd, ctrlE:
+		e.pos = len(e.buf)
+	case backspace, ctrlH:
+		e.delete(e.pos-1, e.pos)
+	case keyDelete:
+		e.delete(e.pos, e.pos+1)
+	case ctrlK:
+		e.delete(e.pos, len(e.buf))
+	case ctrlU:
+		e.delete(0, e.pos)
+	case ctrlW:
+		i := e.pos
+		for i > 0 && e.buf[i-1] == ' ' {
+			i--
+		}
+		for i > 0 && e.buf[i-1] != ' ' {
+			i--
+		}
+		e.delete(i, e.pos)
+	case ctrlL:
+		e.out.WriteString("\x1b[H\x1b[2J")
+	case tab:
+		e.complete()
+	default:
+		if key >= ' ' && key != backspace {
+			e.insert([]rune{key})
+		}
+	}
+}
+
+func (e *Editor) insert(text []rune) {
+	buf := make([]rune, 0, len(e.buf)+len(text))
+	buf = append(append(append(buf, e.buf[:e.pos]...), text...), e.buf[e.pos:]...)
+	e.buf = buf
+	e.pos += len(text)
+}
+
+// delete removes the characters from i to j, the cursor stays at i.
+func (e *Editor) delete(i, j int) {
+	if i < 0 {
+		i = 0
+	}
+	if j > len(e.buf) {
+		j = len(e.buf)
+	}
+	if i >= j {
+		return
+	}
+	e.buf = append(e.buf[:i], e.buf[j:]...)
+	e.pos = i
+}
+
+// browse shows the previous or the next line of the history. hist is the index
+// of the line shown, -1 for the line being entered which is kept in saved.
+func (e *Editor) browse(back bool, hist int, saved []rune) (int, []rune) {
+	if e.History == nil {
+		return hist, saved
+	}
+	lines := e.History.Lines()
+	switch {
+	case back && hist == -1 && len(lines) > 0:
+		hist, saved = len(lines)-1, e.buf
+	case back && hist > 0:
+		hist--
+	case !back && hist >= 0 && hist < len(lines)-1:
+		hist++
+	case !back && hist >= 0:
+		e.buf, e.pos = saved, len(saved)
+		return -1, nil
+	default:
+		return hist, saved
+	}
+	e.buf = []rune(lines[hist])
+	e.pos = len(e.buf)
+	return hist, saved
+}
+
+// search finds the lines of the history containing the text typed, Ctrl-R goes
+// on to an older one. Enter or another key ends the search keeping the line found
+// and is returned to be handled, Ctrl-G, Esc or Ctrl-C restores the line and
+// keyNone is returned.
+func (e *Editor) search() rune {
+	var lines []string
+	if e.History != nil {
+		lines = e.History.Lines()
+	}
+	var (
+		query []rune
+		found = -1
+		match = string(e.buf)
+	)
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(lines[i], string(query)) {
+				found, match = i, lines[i]
+				return
+			}
+		}
+		found = -1
+	}
+	for {
+		state := "reverse-i-search"
+		if found < 0 && len(query) > 0 {
+			state = "failed reverse-i-search"
+		}
+		fmt.Fprintf(e.out, "\r(%s)`%s': %s\x1b[K", state, string(query), match)
+		e.out.Flush()
+		key, err := e.readKey()
+		if err != nil {
+			key = ctrlG
+		}
+		switch {
+		case key == ctrlR:
+			from := found - 1
+			if found < 0 {
+				from = len(lines) - 1
+			}
+			if len(query) > 0 {
+				find(from)
+			}
+		case key == backspace || key == ctrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(lines) - 1)
+			}
+		case key == ctrlG || key == ctrlC || key == keyEsc:
+			return keyNone
+		case key >= ' ':
+			query = append(query, key)
+			from := found
+			if found < 0 {
+				from = len(lines) - 1
+			}
+			find(from)
+		default:
+			e.buf = []rune(match)
+			e.pos = len(e.buf)
+			return key
+		}
+	}
+}
+
+// complete replaces the word before the cursor with the only candidate or the
+// prefix common to the candidates. If there is nothing to add the candidates are listed.
+func (e *Editor) complete() {
+	if e.Complete == nil {
+		return
+	}
+	text := string(e.buf[:e.pos])
+	start, candidates := e.Complete(string(e.buf), len(text))
+	if len(candidates) == 0 || start < 0 || start > len(text) {
+		e.out.WriteString("\a")
+		return
+	}
+	word := text[start:]
+	wordLen := utf8.RuneCountInString(word)
+	if len(candidates) == 1 {
+		e.delete(e.pos-wordLen, e.pos)
+		e.insert([]rune(candidates[0] + " "))
+		return
+	}
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	if len(prefix) > len(word) && strings.HasPrefix(strings.ToLower(prefix), strings.ToLower(word)) {
+		e.delete(e.pos-wordLen, e.pos)
+		e.insert([]rune(prefix))
+		return
+	}
+	e.out.WriteString("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+}
+
+// refresh draws the prompt and the line and puts the cursor in place.
+func (e *Editor) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+	if n := len(e.buf) - e.pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+	e.out.Flush()
+}
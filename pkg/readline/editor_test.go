@@ -0,0 +1,102 @@
+package readline_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/readline"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEditor(keys string, history ...string) *readline.Editor {
+	e := readline.New(strings.NewReader(keys), io.Discard)
+	e.History, _ = readline.OpenHistory("", 0)
+	for _, line := range history {
+		e.History.Add(line)
+	}
+	return e
+}
+
+func TestReadLine(t *testing.T) {
+	history := []string{"SELECT a FROM x", "SELECT b FROM y", `\d`}
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{"enter", "SELECT 1\r", "SELECT 1"},
+		{"end of input", "SELECT 1", "SELECT 1"},
+		{"backspace", "SELECTT\x7f 1\r", "SELECT 1"},
+		{"left and insert", "SELET 1\x1b[D\x1b[D\x1b[DC\r", "SELECT 1"},
+		{"home and end", "ELECT\x01S\x05 1\r", "SELECT 1"},
+		{"home and end keys", "ELECT\x1b[HS\x1b[F 1\r", "SELECT 1"},
+		{"delete", "SELECT 21\x1b[D\x1b[D\x1b[3~\r", "SELECT 1"},
+		{"kill to end", "SELECT 1 FROM x\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x0b\r", "SELECT 1"},
+		{"kill to start", "abc\x15SELECT 1\r", "SELECT 1"},
+		{"kill word", "SELECT abc  \x171\r", "SELECT 1"},
+		{"ctrl-d deletes", "SELECT 21\x02\x02\x04\r", "SELECT 1"},
+		{"history up", "\x1b[A\x1b[A\r", "SELECT b FROM y"},
+		{"history ctrl-p", "\x10\x10\x10\x10\r", "SELECT a FROM x"},
+		{"history down", "SEL\x1b[A\x1b[A\x1b[B\x1b[B\r", "SEL"},
+		{"search", "\x12FROM\r", "SELECT b FROM y"},
+		{"search older", "\x12FROM\x12\r", "SELECT a FROM x"},
+		{"search edits", "\x12a F\x05 WHERE\r", "SELECT a FROM x WHERE"},
+		{"search cancel", "SEL\x12FROM\x07ECT 1\r", "SELECT 1"},
+		{"search backspace", "\x12d\x7fFROM\r", "SELECT b FROM y"},
+		{"unknown escape", "SELECT\x1b[5~ 1\r", "SELECT 1"},
+		{"utf-8", "город\x1b[D\x7fд\r", "гордд"},
+	}
+	for _, tt := range tests {
+		e := newEditor(tt.keys, history...)
+		got, err := e.ReadLine("> ")
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+
+	e := newEditor("SELECT\x03SELECT 1\r")
+	_, err := e.ReadLine("> ")
+	assert.Equal(t, readline.ErrInterrupt, err)
+	got, err := e.ReadLine("> ")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT 1", got)
+
+	for _, keys := range []string{"\x04", ""} {
+		_, err = newEditor(keys).ReadLine("> ")
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	words := []string{"SELECT", "SET", "sales", "salary"}
+	complete := func(line string, pos int) (int, []string) {
+		text := line[:pos]
+		start := strings.LastIndexAny(text, " (") + 1
+		var candidates []string
+		for _, w := range words {
+			if strings.HasPrefix(strings.ToLower(w), strings.ToLower(text[start:])) {
+				candidates = append(candidates, w)
+			}
+		}
+		return start, candidates
+	}
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"sel\t*\r", "SELECT *"},
+		{"SELECT a FROM sa\t\r", "SELECT a FROM sal"},
+		{"SELECT a FROM sale\tx\r", "SELECT a FROM sales x"},
+		{"S\t\r", "S"},
+		{"SELECT x\t\r", "SELECT x"},
+		{"count(sel\t\r", "count(SELECT "},
+		{"sel FROM x\x01\x06\x06\x06\t\r", "SELECT  FROM x"},
+	}
+	for _, tt := range tests {
+		e := newEditor(tt.keys)
+		e.Complete = complete
+		got, err := e.ReadLine("> ")
+		assert.NoError(t, err, tt.keys)
+		assert.Equal(t, tt.want, got, tt.keys)
+	}
+}
@@ -0,0 +1,110 @@
+package readline
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultHistorySize is the number of lines kept when OpenHistory is given 0.
+const DefaultHistorySize = 1000
+
+// History is the list of entered lines, oldest first. Lines are appended
+// to its file, so the history is kept between sessions.
+type History struct {
+	path  string
+	size  int
+	lines []string
+	// written is the number of lines in the file, it is rewritten
+	// with the last size lines when it holds twice as many
+	written int
+}
+
+// OpenHistory reads the last size lines of the history file, a missing file
+// is an empty history. An empty path keeps the history in memory only.
+func OpenHistory(path string, size int) (*History, error) {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	h := &History{path: path, size: size}
+	if path == "" {
+		return h, nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		if line := sc.Text(); line != "" {
+			h.lines = append(h.lines, line)
+			h.written++
+		}
+	}
+	if len(h.lines) > size {
+		h.lines = h.lines[len(h.lines)-size:]
+	}
+	return h, sc.Err()
+}
+
+// Lines returns the lines of the history, oldest first.
+func (h *History) Lines() []string {
+	return h.lines
+}
+
+// Add appends the line to the history and its file. Line breaks of a multi-line
+// statement are replaced by spaces, an empty line or a repeat of the last one is skipped.
+func (h *History) Add(line string) error {
+	line = strings.Join(strings.Fields(line), " ")
+	if line == "" || len(h.lines) > 0 && h.lines[len(h.lines)-1] == line {
+		return nil
+	}
+	if h.lines = append(h.lines, line); len(h.lines) > h.size {
+		h.lines = h.lines[len(h.lines)-h.size:]
+	}
+	if h.path == "" {
+		return nil
+	}
+	if h.written+1 > 2*h.size {
+		return h.rewrite()
+	}
+	file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = file.WriteString(line + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+	h.written++
+	return file.Close()
+}
+
+// rewrite replaces the file with the lines kept in memory.
+func (h *History) rewrite() error {
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for _, line := range h.lines {
+		w.WriteString(line + "\n")
+	}
+	if err = w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	h.written = len(h.lines)
+	return os.Rename(tmp.Name(), h.path)
+}
@@ -0,0 +1,49 @@
+package readline_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AleksandrMac/csv_query/pkg/readline"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h, err := readline.OpenHistory(path, 3)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, h.Lines())
+
+	for _, line := range []string{"SELECT 1", "SELECT 1", "  ", "SELECT a\n  FROM x", "\\d"} {
+		assert.NoError(t, h.Add(line))
+	}
+	assert.Equal(t, []string{"SELECT 1", "SELECT a FROM x", `\d`}, h.Lines())
+
+	h, err = readline.OpenHistory(path, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SELECT 1", "SELECT a FROM x", `\d`}, h.Lines())
+
+	// the file is cut to the size when it holds twice as many lines
+	for _, line := range []string{"a", "b", "c", "d"} {
+		assert.NoError(t, h.Add(line))
+	}
+	assert.Equal(t, []string{"b", "c", "d"}, h.Lines())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "b\nc\nd\n", string(data))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	h, err = readline.OpenHistory("", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, h.Add("SELECT 1"))
+	assert.Equal(t, []string{"SELECT 1"}, h.Lines())
+
+	_, err = readline.OpenHistory(t.TempDir(), 0)
+	assert.True(t, err != nil && strings.Contains(err.Error(), "directory"), err)
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package readline
+
+import "errors"
+
+// IsTerminal reports whether fd is a terminal, it is always false where raw mode
+// is not supported and lines are read without editing.
+func IsTerminal(fd int) bool {
+	return false
+}
+
+// MakeRaw is not supported on this system.
+func MakeRaw(fd int) (restore func() error, err error) {
+	return nil, errors.New("raw terminal mode is not supported")
+}